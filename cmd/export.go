@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/friend0/go-meshcat/internal"
+)
+
+// export writes the persisted scene, or a recording and the scene it started
+// from, to a standalone HTML file: `go-meshcat export-html --out scene.html`.
+func export(ctx context.Context, args []string) error {
+	var out, session, file, title string
+	var loop bool
+	cfg, _, err := internal.LoadConfig(args, func(fs *flag.FlagSet) {
+		fs.StringVar(&out, "out", "meshcat-scene.html", "HTML file to write")
+		fs.StringVar(&session, "session", "", "recording session to bundle")
+		fs.StringVar(&file, "file", "", "recording file of the session, defaults to the newest")
+		fs.StringVar(&title, "title", "", "page title")
+		fs.BoolVar(&loop, "loop", false, "loop the recording")
+	})
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	bundle, err := internal.ReadViewerBundle(cfg.HTTP.StaticDir)
+	if err != nil {
+		return err
+	}
+	var scene []internal.SceneEntry
+	if cfg.Persistence.Enabled && session == "" {
+		if scene, err = internal.LoadPersistedScene(ctx, cfg); err != nil {
+			return err
+		}
+	}
+	opts := internal.ExportOptions{Title: title, Loop: loop}
+	if session != "" {
+		recordings := internal.NewRecordings(cfg.Recording, func(*internal.Recorder) {}, nil)
+		if file == "" {
+			infos, err := recordings.List()
+			if err != nil {
+				return err
+			}
+			for _, info := range infos {
+				if info.Session == session {
+					file = info.File
+					break
+				}
+			}
+		}
+		name, err := recordings.Path(session, file)
+		if err != nil {
+			return err
+		}
+		var header internal.RecordingHeader
+		if header, opts.Frames, err = internal.ReadRecording(name); err != nil {
+			return err
+		}
+		// The recording is played from the scene it started from.
+		scene = header.Scene
+	}
+	if len(scene) == 0 && len(opts.Frames) == 0 {
+		return fmt.Errorf("nothing to export: enable scene persistence or pass --session")
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := internal.ExportHTML(f, bundle, scene, opts); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s (%d scene commands, %d recorded frames)\n", out, len(scene), len(opts.Frames))
+	return nil
+}
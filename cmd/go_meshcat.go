@@ -2,50 +2,73 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"runtime"
-	"time"
+	"syscall"
 
 	"github.com/friend0/go-meshcat/internal"
 	"github.com/joho/godotenv"
 )
 
-func run(ctx context.Context) (err error) {
-	err = godotenv.Load()
+func run(ctx context.Context, args []string) (err error) {
+	// The .env file is a development convenience; a missing one is not an error.
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error loading .env file: %v", err)
+	}
+	if len(args) > 0 && args[0] == "export-html" {
+		return export(ctx, args[1:])
+	}
+	cfg, printConfig, err := internal.LoadConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
 		return err
 	}
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	s, err := internal.NewServer(ctx)
-	if err != nil {
-		log.Fatal(err)
+	if printConfig {
+		return cfg.Print(os.Stdout)
 	}
-	defer s.Router.Shutdown(ctx)
-	defer s.NATS.Close()
-	if err := s.Router.Start(":8080"); err != http.ErrServerClosed {
+
+	slog.SetDefault(internal.NewLogger(cfg.Log, os.Stdout))
+	s, err := internal.NewServer(ctx, cfg)
+	if err != nil {
 		return err
 	}
-	runtime.Goexit()
-	return nil
-}
 
-func main() {
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
+	serveErr := make(chan error, 1)
 	go func() {
-		if err := run(ctx); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "%s\n", err)
-			os.Exit(1)
-		}
+		serveErr <- s.Start()
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 10 seconds.
-	<-ctx.Done()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	select {
+	case err = <-serveErr:
+		if err == http.ErrServerClosed {
+			err = nil
+		}
+	case <-ctx.Done():
+		slog.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	}
+
+	// Wait for in-flight work to wind down, with a timeout.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
+	if shutdownErr := s.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, os.Args[1:]); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
 }
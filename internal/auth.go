@@ -0,0 +1,311 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Role is the level of access granted to a viewer or API client.
+type Role int
+
+const (
+	RoleNone Role = iota
+	// RoleViewer may load the viewer and receive scene updates.
+	RoleViewer
+	// RoleControl may additionally send inbound events and drive the scene.
+	RoleControl
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleControl:
+		return "control"
+	default:
+		return "none"
+	}
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) (err error) {
+	*r, err = ParseRole(string(text))
+	return err
+}
+
+func ParseRole(s string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "none", "":
+		return RoleNone, nil
+	case "viewer", "read-only", "readonly":
+		return RoleViewer, nil
+	case "control":
+		return RoleControl, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role %q", s)
+	}
+}
+
+const (
+	// Credentials passed in the query string are echoed back as a cookie of the
+	// same name prefixed with authCookiePrefix, so the viewer's asset and
+	// websocket requests made after the first page load stay authenticated.
+	tokenParam       = "token"
+	shareParam       = "share"
+	authCookiePrefix = "meshcat_"
+)
+
+// Authenticator resolves the role of an incoming request. ok is false when the
+// request does not carry a credential the authenticator recognises.
+type Authenticator interface {
+	Authenticate(r *http.Request) (role Role, ok bool)
+}
+
+// credential returns a credential from the query string or its cookie.
+func credential(r *http.Request, param string) string {
+	if v := r.URL.Query().Get(param); v != "" {
+		return v
+	}
+	if c, err := r.Cookie(authCookiePrefix + param); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// TokenAuth accepts static bearer tokens, either in the Authorization header
+// or as a `token` query parameter for browser links.
+type TokenAuth map[string]Role
+
+// UnmarshalText parses the "<token>:<role>,..." form used in the environment.
+func (ta *TokenAuth) UnmarshalText(text []byte) (err error) {
+	*ta, err = ParseTokens(string(text))
+	return err
+}
+
+func (ta TokenAuth) Authenticate(r *http.Request) (Role, bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		token = credential(r, tokenParam)
+	}
+	if token == "" {
+		return RoleNone, false
+	}
+	for candidate, role := range ta {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			return role, true
+		}
+	}
+	return RoleNone, false
+}
+
+type BasicCredential struct {
+	Password string `yaml:"password" toml:"password"`
+	Role     Role   `yaml:"role" toml:"role"`
+}
+
+// BasicAuth accepts HTTP basic auth against a fixed set of users.
+type BasicAuth map[string]BasicCredential
+
+// UnmarshalText parses the "<user>:<password>:<role>,..." form used in the environment.
+func (ba *BasicAuth) UnmarshalText(text []byte) (err error) {
+	*ba, err = ParseBasicCredentials(string(text))
+	return err
+}
+
+func (ba BasicAuth) Authenticate(r *http.Request) (Role, bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return RoleNone, false
+	}
+	cred, ok := ba[user]
+	if !ok || subtle.ConstantTimeCompare([]byte(cred.Password), []byte(password)) != 1 {
+		return RoleNone, false
+	}
+	return cred.Role, true
+}
+
+// ShareLinkAuth accepts signed, expiring share links of the form
+// `?share=<role>.<unix expiry>.<signature>`.
+type ShareLinkAuth struct {
+	Secret []byte
+	now    func() time.Time
+}
+
+func (sa ShareLinkAuth) sign(payload string) string {
+	mac := hmac.New(sha256.New, sa.Secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (sa ShareLinkAuth) clock() time.Time {
+	if sa.now != nil {
+		return sa.now()
+	}
+	return time.Now()
+}
+
+// NewShareToken signs a share token granting role until expires.
+func (sa ShareLinkAuth) NewShareToken(role Role, expires time.Time) string {
+	payload := fmt.Sprintf("%s.%d", role, expires.Unix())
+	return payload + "." + sa.sign(payload)
+}
+
+func (sa ShareLinkAuth) Authenticate(r *http.Request) (Role, bool) {
+	token := credential(r, shareParam)
+	if token == "" || len(sa.Secret) == 0 {
+		return RoleNone, false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return RoleNone, false
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(sa.sign(payload)), []byte(parts[2])) {
+		return RoleNone, false
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || sa.clock().After(time.Unix(expiry, 0)) {
+		return RoleNone, false
+	}
+	role, err := ParseRole(parts[0])
+	if err != nil {
+		return RoleNone, false
+	}
+	return role, true
+}
+
+// AuthConfig configures who may load the viewer and connect to `/ws`.
+// With no credentials configured authentication is disabled and every
+// client gets RoleControl, matching the server's original behaviour.
+type AuthConfig struct {
+	// Tokens are static bearer tokens, "<token>:<role>,..." in the environment.
+	Tokens TokenAuth `env:"MESHCAT_AUTH_TOKENS" yaml:"tokens" toml:"tokens"`
+	// Basic are HTTP basic users, "<user>:<password>:<role>,..." in the environment.
+	Basic BasicAuth `env:"MESHCAT_AUTH_BASIC" yaml:"basic" toml:"basic"`
+	// ShareSecret is the HMAC key for signed share links.
+	ShareSecret string `env:"MESHCAT_SHARE_SECRET" yaml:"share_secret" toml:"share_secret"`
+	// AnonymousRole is granted to requests without credentials when authentication is enabled.
+	AnonymousRole Role `env:"MESHCAT_ANONYMOUS_ROLE" yaml:"anonymous_role" toml:"anonymous_role"`
+	// AllowedOrigins restricts the Origin of websocket upgrades. Entries may use a
+	// leading wildcard host, e.g. "https://*.example.com". Empty allows any origin.
+	AllowedOrigins []string `env:"MESHCAT_ALLOWED_ORIGINS" yaml:"allowed_origins" toml:"allowed_origins"`
+	// AllowMissingOrigin lets websocket upgrades without an Origin header, i.e.
+	// from non-browser clients, past AllowedOrigins.
+	AllowMissingOrigin bool `env:"MESHCAT_ALLOW_MISSING_ORIGIN" yaml:"allow_missing_origin" toml:"allow_missing_origin"`
+}
+
+func (cfg AuthConfig) Enabled() bool {
+	return len(cfg.Tokens) > 0 || len(cfg.Basic) > 0 || cfg.ShareSecret != ""
+}
+
+func (cfg AuthConfig) authenticators() []Authenticator {
+	var auths []Authenticator
+	if len(cfg.Tokens) > 0 {
+		auths = append(auths, cfg.Tokens)
+	}
+	if len(cfg.Basic) > 0 {
+		auths = append(auths, cfg.Basic)
+	}
+	if cfg.ShareSecret != "" {
+		auths = append(auths, ShareLinkAuth{Secret: []byte(cfg.ShareSecret)})
+	}
+	return auths
+}
+
+// Authenticate resolves the role for r, falling back to AnonymousRole.
+func (cfg AuthConfig) Authenticate(r *http.Request) Role {
+	if !cfg.Enabled() {
+		return RoleControl
+	}
+	for _, auth := range cfg.authenticators() {
+		if role, ok := auth.Authenticate(r); ok {
+			return role
+		}
+	}
+	return cfg.AnonymousRole
+}
+
+// CheckOrigin reports whether a websocket upgrade from r's Origin is allowed.
+// Requests without an Origin header are only allowed when no origins are
+// configured or AllowMissingOrigin is set.
+func (cfg AuthConfig) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(cfg.AllowedOrigins) == 0 {
+		return true
+	}
+	if origin == "" {
+		return cfg.AllowMissingOrigin
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if ok && strings.EqualFold(scheme, u.Scheme) && strings.HasSuffix(strings.ToLower(u.Hostname()), "."+strings.ToLower(host)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTokens parses "<token>:<role>" pairs. A token without a role is read-only.
+func ParseTokens(s string) (TokenAuth, error) {
+	tokens := TokenAuth{}
+	for _, entry := range splitList(s) {
+		token, roleName, _ := strings.Cut(entry, ":")
+		if roleName == "" {
+			roleName = RoleViewer.String()
+		}
+		role, err := ParseRole(roleName)
+		if err != nil {
+			return nil, err
+		}
+		tokens[token] = role
+	}
+	return tokens, nil
+}
+
+// ParseBasicCredentials parses "<user>:<password>:<role>" triples.
+func ParseBasicCredentials(s string) (BasicAuth, error) {
+	users := BasicAuth{}
+	for _, entry := range splitList(s) {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("expected <user>:<password>[:<role>], got %q", entry)
+		}
+		role := RoleViewer
+		if len(parts) == 3 {
+			var err error
+			if role, err = ParseRole(parts[2]); err != nil {
+				return nil, err
+			}
+		}
+		users[parts[0]] = BasicCredential{Password: parts[1], Role: role}
+	}
+	return users, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
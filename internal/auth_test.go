@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAuthConfigAuthenticate(t *testing.T) {
+	share := ShareLinkAuth{Secret: []byte("secret")}
+	cfg := AuthConfig{
+		Tokens:      TokenAuth{"ctl": RoleControl, "view": RoleViewer},
+		Basic:       BasicAuth{"alice": {Password: "pw", Role: RoleControl}},
+		ShareSecret: "secret",
+	}
+
+	tests := []struct {
+		name    string
+		prepare func(r *http.Request)
+		role    Role
+	}{
+		{"anonymous", func(r *http.Request) {}, RoleNone},
+		{"bearer control", func(r *http.Request) { r.Header.Set("Authorization", "Bearer ctl") }, RoleControl},
+		{"bearer unknown", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, RoleNone},
+		{"token query", func(r *http.Request) { r.URL.RawQuery = "token=view" }, RoleViewer},
+		{"token cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "meshcat_token", Value: "ctl"}) }, RoleControl},
+		{"basic", func(r *http.Request) { r.SetBasicAuth("alice", "pw") }, RoleControl},
+		{"basic wrong password", func(r *http.Request) { r.SetBasicAuth("alice", "nope") }, RoleNone},
+		{"share link", func(r *http.Request) {
+			r.URL.RawQuery = "share=" + share.NewShareToken(RoleViewer, time.Now().Add(time.Hour))
+		}, RoleViewer},
+		{"expired share link", func(r *http.Request) {
+			r.URL.RawQuery = "share=" + share.NewShareToken(RoleControl, time.Now().Add(-time.Minute))
+		}, RoleNone},
+		{"tampered share link", func(r *http.Request) {
+			token := share.NewShareToken(RoleViewer, time.Now().Add(time.Hour))
+			r.URL.RawQuery = "share=control" + token[len("viewer"):]
+		}, RoleNone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			test.prepare(r)
+			if got := cfg.Authenticate(r); got != test.role {
+				t.Errorf("Authenticate() = %v; want %v", got, test.role)
+			}
+		})
+	}
+
+	if got := (AuthConfig{}).Authenticate(httptest.NewRequest(http.MethodGet, "/", nil)); got != RoleControl {
+		t.Errorf("disabled auth should grant control, got %v", got)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	cfg := AuthConfig{AllowedOrigins: []string{"https://viewer.example.com", "https://*.lab.example.com"}}
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"", false},
+		{"https://viewer.example.com", true},
+		{"https://sim.lab.example.com", true},
+		{"https://sim.lab.example.com:8443", true},
+		{"http://sim.lab.example.com", false},
+		{"https://lab.example.com.evil.com", false},
+		{"https://evil.com", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if got := cfg.CheckOrigin(r); got != test.allowed {
+			t.Errorf("CheckOrigin(%q) = %v; want %v", test.origin, got, test.allowed)
+		}
+	}
+	cfg.AllowMissingOrigin = true
+	if !cfg.CheckOrigin(httptest.NewRequest(http.MethodGet, "/ws", nil)) {
+		t.Error("rejected a missing origin with AllowMissingOrigin set")
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	s := Server{Router: echo.New(), Auth: AuthConfig{Tokens: TokenAuth{"view": RoleViewer}}}
+	ok := func(c echo.Context) error { return c.String(http.StatusOK, RoleFromContext(c).String()) }
+	s.Router.GET("/view", ok, s.RequireRole(RoleViewer))
+	s.Router.GET("/control", ok, s.RequireRole(RoleControl))
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/view", http.StatusUnauthorized},
+		{"/view?token=view", http.StatusOK},
+		{"/control?token=view", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.target, nil))
+		if rec.Code != test.status {
+			t.Errorf("GET %s = %d; want %d", test.target, rec.Code, test.status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/view?token=view", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "meshcat_token" || cookies[0].Value != "view" || cookies[0].Secure {
+		t.Errorf("expected the query token to be stored in a cookie, got %v", cookies)
+	}
+
+	// Behind a TLS-terminating proxy the cookie is still marked secure.
+	rec = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/view?token=view", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	s.Router.ServeHTTP(rec, r)
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || !cookies[0].Secure {
+		t.Errorf("expected a secure cookie behind a proxy, got %v", cookies)
+	}
+}
+
+func TestRedactedURI(t *testing.T) {
+	for target, want := range map[string]string{
+		"/ws":                    "/ws",
+		"/ws?token=secret&x=1":   "/ws?token=REDACTED&x=1",
+		"/?share=signed.link":    "/?share=REDACTED",
+		"/api/objects/a?x=1%202": "/api/objects/a?x=1%202",
+	} {
+		u, _ := url.Parse(target)
+		if got := redactedURI(u); got != want {
+			t.Errorf("redactedURI(%s) = %s; want %s", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	MinClockScale = 0.1
+	MaxClockScale = 10.0
+)
+
+// clockStatusPath is the scene path of the clock label.
+const clockStatusPath = statusRoot + "/clock"
+
+type ClockMode string
+
+const (
+	ClockRealtime ClockMode = "realtime"
+	ClockScaled   ClockMode = "scaled"
+	ClockPaused   ClockMode = "paused"
+)
+
+// ClockConfig configures the simulation clock.
+type ClockConfig struct {
+	// Scale is how many seconds of simulation time pass per second.
+	Scale  float64 `env:"MESHCAT_CLOCK_SCALE" flag:"clock-scale" desc:"simulation seconds per wall clock second, between 0.1 and 10" yaml:"scale" toml:"scale"`
+	Paused bool    `env:"MESHCAT_CLOCK_PAUSED" flag:"clock-paused" desc:"start with the simulation clock paused" yaml:"paused" toml:"paused"`
+	// Step is how far a step request without a duration advances the clock.
+	Step time.Duration `env:"MESHCAT_CLOCK_STEP" yaml:"step" toml:"step"`
+	// BroadcastInterval is how often the viewers are sent the time while the
+	// clock runs, 0 to only tell them about changes.
+	BroadcastInterval time.Duration `env:"MESHCAT_CLOCK_BROADCAST_INTERVAL" yaml:"broadcast_interval" toml:"broadcast_interval"`
+}
+
+func DefaultClockConfig() ClockConfig {
+	return ClockConfig{Scale: 1, Step: 100 * time.Millisecond, BroadcastInterval: time.Second}
+}
+
+func (cfg ClockConfig) Validate() error {
+	if err := validClockScale(cfg.Scale); err != nil {
+		return err
+	}
+	if cfg.Step <= 0 || cfg.BroadcastInterval < 0 {
+		return fmt.Errorf("invalid clock timing: step %v, broadcast interval %v", cfg.Step, cfg.BroadcastInterval)
+	}
+	return nil
+}
+
+func validClockScale(scale float64) error {
+	if scale < MinClockScale || scale > MaxClockScale {
+		return fmt.Errorf("clock scale must be between %vx and %vx, got %v", MinClockScale, MaxClockScale, scale)
+	}
+	return nil
+}
+
+// ClockStatus describes the simulation clock. Time is the simulation time in
+// seconds since the clock started.
+type ClockStatus struct {
+	Time   float64   `json:"time" msgpack:"time"`
+	Scale  float64   `json:"scale" msgpack:"scale"`
+	Paused bool      `json:"paused" msgpack:"paused"`
+	Mode   ClockMode `json:"mode" msgpack:"mode"`
+}
+
+// Clock is the simulation time that missions, playbacks and the vehicle
+// simulation run on. It runs in real time or scaled, or is paused and
+// advanced a step at a time. A nil *Clock is the wall clock.
+type Clock struct {
+	cfg ClockConfig
+	// publish is told about every change, and periodically while running.
+	publish func(ClockStatus)
+
+	mu sync.Mutex
+	// epoch is the time the clock started at, and base the time it was at
+	// when the wall clock read anchor.
+	epoch  time.Time
+	base   time.Time
+	anchor time.Time
+	scale  float64
+	paused bool
+	// changed is closed, and replaced, whenever the clock is paused,
+	// resumed, scaled or stepped.
+	changed chan struct{}
+	// sleepers counts the callers of SleepUntil, so tests can step a fake
+	// clock once everything is waiting on it.
+	sleepers int
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewClock creates a clock starting at the current time.
+func NewClock(cfg ClockConfig, publish func(ClockStatus)) *Clock {
+	now := time.Now()
+	return &Clock{
+		cfg:     cfg,
+		publish: publish,
+		epoch:   now,
+		base:    now,
+		anchor:  now,
+		scale:   cfg.Scale,
+		paused:  cfg.Paused,
+		changed: make(chan struct{}),
+	}
+}
+
+// NewFakeClock creates a paused clock, which only moves when stepped, so
+// timing can be tested without sleeping.
+func NewFakeClock() *Clock {
+	cfg := DefaultClockConfig()
+	cfg.Paused = true
+	return NewClock(cfg, nil)
+}
+
+// Start broadcasts the time in the background until Stop.
+func (c *Clock) Start() {
+	if c.cfg.BroadcastInterval <= 0 || c.publish == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel, c.done = cancel, make(chan struct{})
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.cfg.BroadcastInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// A paused clock was broadcast when it paused.
+				if status := c.Status(); !status.Paused {
+					c.publish(status)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops broadcasting the time.
+func (c *Clock) Stop() {
+	if c == nil || c.cancel == nil {
+		return
+	}
+	c.cancel()
+	<-c.done
+}
+
+// Now returns the simulation time.
+func (c *Clock) Now() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now()
+}
+
+func (c *Clock) now() time.Time {
+	if c.paused {
+		return c.base
+	}
+	return c.base.Add(time.Duration(float64(time.Since(c.anchor)) * c.scale))
+}
+
+// Status returns the current state of the clock, which for the wall clock
+// has no time.
+func (c *Clock) Status() ClockStatus {
+	if c == nil {
+		return ClockStatus{Scale: 1, Mode: ClockRealtime}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status()
+}
+
+func (c *Clock) status() ClockStatus {
+	mode := ClockScaled
+	switch {
+	case c.paused:
+		mode = ClockPaused
+	case c.scale == 1:
+		mode = ClockRealtime
+	}
+	return ClockStatus{Time: c.now().Sub(c.epoch).Seconds(), Scale: c.scale, Paused: c.paused, Mode: mode}
+}
+
+// update changes the clock with f, re-anchoring it so the time carries on
+// from where it was, and wakes everything waiting on it.
+func (c *Clock) update(f func()) ClockStatus {
+	c.mu.Lock()
+	c.base, c.anchor = c.now(), time.Now()
+	f()
+	close(c.changed)
+	c.changed = make(chan struct{})
+	status := c.status()
+	c.mu.Unlock()
+	if c.publish != nil {
+		c.publish(status)
+	}
+	return status
+}
+
+func (c *Clock) Pause() ClockStatus {
+	return c.update(func() { c.paused = true })
+}
+
+func (c *Clock) Resume() ClockStatus {
+	return c.update(func() { c.paused = false })
+}
+
+// SetScale sets how many seconds of simulation time pass per second.
+func (c *Clock) SetScale(scale float64) (ClockStatus, error) {
+	if err := validClockScale(scale); err != nil {
+		return c.Status(), err
+	}
+	return c.update(func() { c.scale = scale }), nil
+}
+
+// Step pauses the clock and advances it by d.
+func (c *Clock) Step(d time.Duration) (ClockStatus, error) {
+	if d <= 0 {
+		return c.Status(), fmt.Errorf("clock step must be positive, got %v", d)
+	}
+	return c.update(func() {
+		c.paused = true
+		c.base = c.base.Add(d)
+	}), nil
+}
+
+// until returns how long the wall clock takes to reach deadline, or false if
+// the clock is paused short of it, along with a channel closed when the clock
+// next changes, which invalidates the answer.
+func (c *Clock) until(deadline time.Time) (time.Duration, bool, <-chan struct{}) {
+	if c == nil {
+		return time.Until(deadline), true, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	remaining := deadline.Sub(c.now())
+	switch {
+	case remaining <= 0:
+		return 0, true, c.changed
+	case c.paused:
+		return 0, false, c.changed
+	}
+	return time.Duration(float64(remaining) / c.scale), true, c.changed
+}
+
+// SleepUntil blocks until the clock reaches deadline, returning false if ctx
+// is cancelled first.
+func (c *Clock) SleepUntil(ctx context.Context, deadline time.Time) bool {
+	return c.sleepUntil(ctx, deadline, nil)
+}
+
+// sleepUntil is SleepUntil, also returning false once wake is closed.
+func (c *Clock) sleepUntil(ctx context.Context, deadline time.Time, wake <-chan struct{}) bool {
+	if c != nil {
+		c.mu.Lock()
+		c.sleepers++
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			c.sleepers--
+			c.mu.Unlock()
+		}()
+	}
+	for {
+		d, running, changed := c.until(deadline)
+		if running && d <= 0 {
+			return true
+		}
+		var due <-chan time.Time
+		var timer *time.Timer
+		if running {
+			timer = time.NewTimer(d)
+			due = timer.C
+		}
+		woken := false
+		select {
+		case <-ctx.Done():
+		case <-due:
+		case <-changed:
+		case <-wake:
+			woken = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if woken || ctx.Err() != nil {
+			return false
+		}
+	}
+}
+
+// sleeping returns the number of callers blocked in SleepUntil.
+func (c *Clock) sleeping() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sleepers
+}
+
+// clockControl is a request on `meshcat.clock.<action>`.
+type clockControl struct {
+	Scale   float64 `json:"scale,omitempty"`
+	Seconds float64 `json:"seconds,omitempty"`
+}
+
+// ClockReply is the response to the clock controls.
+type ClockReply struct {
+	Clock *ClockStatus `json:"clock,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// Control pauses, resumes, scales or steps the clock, or just reports its
+// status.
+func (c *Clock) Control(action string, cc clockControl) (ClockStatus, error) {
+	switch action {
+	case "pause":
+		return c.Pause(), nil
+	case "resume":
+		return c.Resume(), nil
+	case "scale":
+		return c.SetScale(cc.Scale)
+	case "step":
+		d := c.cfg.Step
+		if cc.Seconds != 0 {
+			d = time.Duration(cc.Seconds * float64(time.Second))
+		}
+		return c.Step(d)
+	case "status":
+		return c.Status(), nil
+	}
+	return c.Status(), fmt.Errorf("unknown clock action %q", action)
+}
+
+// clockSubscription serves the clock controls on `meshcat.clock.<action>`,
+// replying with the clock's status.
+func (s *Server) clockSubscription() (*nats.Subscription, error) {
+	sub, err := s.NATS.Subscribe("meshcat.clock.*", s.observed(s.handleClock))
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.clock.*", "error", err)
+	}
+	return sub, err
+}
+
+func (s *Server) handleClock(msg *nats.Msg) {
+	logger := s.natsLogger(msg)
+	action := strings.TrimPrefix(msg.Subject, "meshcat.clock.")
+	var cc clockControl
+	var reply ClockReply
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &cc); err != nil {
+			reply.Error = fmt.Sprintf("invalid clock request: %v", err)
+		}
+	}
+	if reply.Error == "" {
+		status, err := s.Clock.Control(action, cc)
+		reply.Clock = &status
+		if err != nil {
+			reply.Error = err.Error()
+		} else if action != "status" {
+			s.Logger.Info("clock changed", "subsystem", "clock", "action", action, "mode", status.Mode, "scale", status.Scale, "time", status.Time)
+		}
+	}
+	if reply.Error != "" {
+		logger.Warn("clock request failed", "error", reply.Error)
+	}
+	if msg.Reply == "" {
+		return
+	}
+	b, _ := json.Marshal(reply)
+	if err := msg.Respond(b); err != nil {
+		logger.Error("unable to reply", "error", err)
+	}
+}
+
+// broadcastClock tells the viewers the simulation time.
+func (s *Server) broadcastClock(status ClockStatus) {
+	if s.Hub == nil {
+		return
+	}
+	b, err := encodeClockStatus(status)
+	if err != nil {
+		s.Logger.Error("unable to encode clock status", "subsystem", "clock", "error", err)
+		return
+	}
+	s.Hub.WriteCommand("set_object", b)
+}
+
+func encodeClockStatus(status ClockStatus) ([]byte, error) {
+	var buf bytes.Buffer
+	text := fmt.Sprintf("t = %.1f s (%s, %gx)", status.Time, status.Mode, status.Scale)
+	err := msgpack.NewEncoder(&buf).Encode(SetClockStatus{
+		Command: Command{Type: "set_object", Path: clockStatusPath},
+		Object:  newStatusLabel(text, 1.2, status),
+	})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	clock := NewFakeClock()
+	start := clock.Now()
+	if status := clock.Status(); status.Mode != ClockPaused || status.Time != 0 {
+		t.Errorf("fake clock: %+v", status)
+	}
+	if status, err := clock.Step(1500 * time.Millisecond); err != nil || status.Time != 1.5 || clock.Now().Sub(start) != 1500*time.Millisecond {
+		t.Errorf("stepped: %+v, %v", status, err)
+	}
+	if _, err := clock.Step(0); err == nil {
+		t.Error("stepped by nothing")
+	}
+	if _, err := clock.SetScale(20); err == nil || !strings.Contains(err.Error(), "between 0.1x and 10x") {
+		t.Errorf("scale 20: %v", err)
+	}
+	if status, _ := clock.SetScale(2); status.Mode != ClockPaused || status.Scale != 2 {
+		t.Errorf("scaled while paused: %+v", status)
+	}
+	if status := clock.Resume(); status.Mode != ClockScaled {
+		t.Errorf("resumed: %+v", status)
+	}
+	if status := clock.Pause(); status.Time < 1.5 {
+		t.Errorf("time went back: %+v", status)
+	}
+	if _, err := clock.Control("rewind", clockControl{}); err == nil {
+		t.Error("unknown action succeeded")
+	}
+	// Without a duration, a step is the configured one.
+	before := clock.Now()
+	if _, err := clock.Control("step", clockControl{}); err != nil || clock.Now().Sub(before) != DefaultClockConfig().Step {
+		t.Errorf("default step: %v after %v", clock.Now().Sub(before), err)
+	}
+}
+
+func TestClockSleepUntil(t *testing.T) {
+	clock := NewFakeClock()
+	woke := make(chan bool, 1)
+	deadline := clock.Now().Add(time.Second)
+	go func() { woke <- clock.SleepUntil(context.Background(), deadline) }()
+
+	clock.Step(500 * time.Millisecond)
+	select {
+	case <-woke:
+		t.Fatal("woke half way")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Step(500 * time.Millisecond)
+	if ok := <-woke; !ok {
+		t.Error("sleep was cancelled")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { woke <- clock.SleepUntil(ctx, deadline.Add(time.Second)) }()
+	waitFor(t, func() bool { return clock.sleeping() == 1 })
+	cancel()
+	if ok := <-woke; ok {
+		t.Error("cancelled sleep completed")
+	}
+
+	// Scaled up, the wall clock takes a tenth of the time.
+	clock.SetScale(10)
+	clock.Resume()
+	start := time.Now()
+	clock.SleepUntil(context.Background(), clock.Now().Add(time.Second))
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("slept %v at 10x", elapsed)
+	}
+}
+
+func TestClockWaypoints(t *testing.T) {
+	clock := NewFakeClock()
+	var mu sync.Mutex
+	var published [][]float64
+	publish := func(wp []float64, w io.Writer) error {
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, wp)
+		return nil
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(published)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The third waypoint holds for 300 ms.
+		WaypointIterator(context.Background(), clock, io.Discard, [][]float64{{0, 0, 0}, {1, 0, 0}, {2, 0, 0, 300}, {3, 0, 0}}, publish, 100*time.Millisecond)
+	}()
+
+	waitFor(t, func() bool { return clock.sleeping() == 1 })
+	clock.Step(250 * time.Millisecond)
+	waitFor(t, func() bool { return count() == 2 })
+	clock.Step(250 * time.Millisecond)
+	waitFor(t, func() bool { return count() == 3 })
+	// Stepping past several waypoints publishes them all.
+	clock.Step(time.Second)
+	<-done
+	if len(published) != 4 || !floatsEqual(published[2], []float64{2, 0, 0}) {
+		t.Errorf("published %v", published)
+	}
+}
+
+func TestClockMissionPause(t *testing.T) {
+	clock := NewFakeClock()
+	run := newMissionRun(MissionStatus{Waypoints: 1}, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		iterateWaypoints(context.Background(), clock, io.Discard, [][]float64{{0, 0, 0}}, mock_publisher, time.Second, run)
+	}()
+	waitFor(t, func() bool { return clock.sleeping() == 1 })
+	clock.Step(500 * time.Millisecond)
+
+	// Pausing half way through the interval stops the wait at once.
+	run.Control(missionControl{Action: "pause"})
+	waitFor(t, func() bool { return clock.sleeping() == 0 })
+	run.Control(missionControl{Action: "resume"})
+	// Resumed, the mission waits out the rest of the interval.
+	waitFor(t, func() bool { return clock.sleeping() == 1 })
+	if n := run.Status().Waypoint; n != 0 {
+		t.Errorf("published %d waypoints before they were due", n)
+	}
+	clock.Step(500 * time.Millisecond)
+	<-done
+	if n := run.Status().Waypoint; n != 1 {
+		t.Errorf("published %d waypoints", n)
+	}
+}
+
+func TestClockSim(t *testing.T) {
+	clock := NewFakeClock()
+	poses := make(chan []float64, 10)
+	sim := NewSim(SimConfig{Step: 100 * time.Millisecond, CommandTimeout: time.Second}, nil, clock, func(path string, pose []float64) {
+		poses <- pose
+	})
+	sim.Start()
+	defer sim.Stop()
+	// Without a vehicle, nothing steps.
+	time.Sleep(20 * time.Millisecond)
+	if n := clock.sleeping(); n != 0 {
+		t.Fatalf("%d sleeping with no vehicles", n)
+	}
+	if _, err := sim.Control("rover", ControlCommand{Model: "point_mass", Velocity: []float64{1, 0, 0}}, clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return clock.sleeping() == 1 })
+	clock.Step(300 * time.Millisecond)
+	var pose []float64
+	for range 3 {
+		pose = <-poses
+	}
+	if math.Abs(pose[0]-0.3) > 1e-9 {
+		t.Errorf("after 3 steps at %v", pose)
+	}
+	select {
+	case pose := <-poses:
+		t.Errorf("moved to %v while paused", pose)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestClockControl(t *testing.T) {
+	s, srv := newTestServer(t)
+	conn := dialViewer(t, srv)
+	request := func(action, data string) ClockReply {
+		t.Helper()
+		msg, err := s.NATS.Request("meshcat.clock."+action, []byte(data), 2*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reply ClockReply
+		if err := json.Unmarshal(msg.Data, &reply); err != nil || reply.Clock == nil {
+			t.Fatalf("%s reply %s: %v", action, msg.Data, err)
+		}
+		return reply
+	}
+
+	if reply := request("status", ""); reply.Clock.Mode != ClockRealtime {
+		t.Errorf("status: %+v", reply.Clock)
+	}
+	paused := request("pause", "").Clock
+	if reply := request("step", `{"seconds": 0.5}`); reply.Error != "" || math.Abs(reply.Clock.Time-paused.Time-0.5) > 1e-9 {
+		t.Errorf("step from %+v: %+v", paused, reply.Clock)
+	}
+	if reply := request("scale", `{"scale": 0.01}`); reply.Error == "" {
+		t.Errorf("scale 0.01: %+v", reply)
+	}
+	if reply := request("scale", `{"scale": 4}`); reply.Error != "" || reply.Clock.Scale != 4 {
+		t.Errorf("scale 4: %+v", reply)
+	}
+	if reply := request("resume", ""); reply.Clock.Mode != ClockScaled {
+		t.Errorf("resume: %+v", reply.Clock)
+	}
+
+	// The viewer is told about every change, ending with the resume.
+	var status SetClockStatus
+	for status.Path != clockStatusPath || status.Object.Object.UserData.Mode != ClockScaled {
+		readCommand(t, conn, "set_object", &status)
+	}
+	if label := status.Object.Textures[0].Text; status.Object.Object.UserData.Scale != 4 || !strings.HasSuffix(label, "(scaled, 4x)") {
+		t.Errorf("viewer clock %+v, labelled %q", status.Object.Object.UserData, label)
+	}
+}
@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// The command pipeline turns the JSON accepted on NATS and the REST API into
+// meshcat commands, and applies them to the scene and the viewers. Both
+// front ends call the same apply functions, so they cannot drift apart.
+
+// errInvalidCommand marks a payload that could not be decoded. NATS counts it
+// as a decode failure and the REST API answers 400.
+var errInvalidCommand = errors.New("invalid command")
+
+func invalidCommand(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errInvalidCommand, fmt.Sprintf(format, args...))
+}
+
+// PropertyRequest is the payload of a set_property command, e.g.
+// `{"property": "visible", "value": false}`.
+type PropertyRequest struct {
+	Property string      `json:"property"`
+	Value    interface{} `json:"value"`
+}
+
+// applyObject adds the geometry described by data, e.g.
+// `{"radius": 0.5, "position": [0, 0, 1]}`, at path.
+func (s *Server) applyObject(path string, data []byte) error {
+	var geom GenericGeom
+	if err := json.Unmarshal(data, &geom); err != nil {
+		return invalidCommand("unable to decode geometry: %v", err)
+	}
+	return s.setGeometry(path, geom)
+}
+
+func (s *Server) setGeometry(path string, geom GenericGeom) error {
+	if path == "" {
+		return invalidCommand("set_object needs a path")
+	}
+	if geom == nil {
+		return invalidCommand("set_object needs a geometry")
+	}
+	if err := geom.init_element(); err != nil {
+		return invalidCommand("%v", err)
+	}
+	return s.apply(SetObject{
+		Object:  Objectify(geom),
+		Command: Command{Type: "set_object", Path: path},
+	})
+}
+
+// applyTransform sets the transform at path from a matrix, or a translation
+// and rotation, in any of the forms accepted by decodeTransform.
+func (s *Server) applyTransform(path string, data []byte) error {
+	transformation_matrix, err := decodeTransform(data)
+	if err != nil {
+		return invalidCommand("%v", err)
+	}
+	return s.setTransform(path, transformation_matrix)
+}
+
+func (s *Server) setTransform(path string, transformation_matrix TransformationCommand) error {
+	if path == "" {
+		return invalidCommand("set_transform needs a path")
+	}
+	return s.apply(SetTransformationCommand{
+		Object:  transformation_matrix,
+		Command: Command{Type: "set_transform", Path: path},
+	})
+}
+
+// applyProperty sets a property of the object at path from a PropertyRequest.
+func (s *Server) applyProperty(path string, data []byte) error {
+	var req PropertyRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return invalidCommand("unable to decode property: %v", err)
+	}
+	return s.setProperty(path, req.Property, req.Value)
+}
+
+func (s *Server) setProperty(path, property string, value interface{}) error {
+	if path == "" {
+		return invalidCommand("set_property needs a path")
+	}
+	if property == "" {
+		return invalidCommand("set_property needs a property name")
+	}
+	return s.apply(SetProperty{
+		Command:  Command{Type: "set_property", Path: path},
+		Property: property,
+		Value:    value,
+	})
+}
+
+// setAnimation plays meshcat animation clips. The path only keys the
+// animation in the scene state; the clips name the objects they animate.
+func (s *Server) setAnimation(path string, animations interface{}, options AnimationOptions) error {
+	if animations == nil {
+		return invalidCommand("set_animation needs animations")
+	}
+	return s.apply(SetAnimation{
+		Command:    Command{Type: "set_animation", Path: path},
+		Animations: animations,
+		Options:    options,
+	})
+}
+
+// applyDelete removes the object at path and everything below it.
+func (s *Server) applyDelete(path string) error {
+	if path == "" {
+		return invalidCommand("delete needs a path")
+	}
+	return s.apply(Delete{Command{Type: "delete", Path: path}})
+}
+
+// apply encodes a command and dispatches it to the scene and the viewers.
+func (s *Server) apply(cmd interface{ command() Command }) error {
+	c := cmd.command()
+	start := time.Now()
+	b, err := msgpack.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("unable to encode %s: %v", c.Type, err)
+	}
+	s.Metrics.encoded(c.Type, start)
+	key := SceneKey{Type: c.Type, Path: c.Path}
+	if p, ok := cmd.(SetProperty); ok {
+		key.Property = p.Property
+	}
+	return s.dispatch(key, b)
+}
+
+// commandFailed logs a NATS command that could not be applied, counting
+// undecodable payloads as decode failures.
+func (s *Server) commandFailed(msg *nats.Msg, path string, err error) {
+	logger := s.natsLogger(msg).With("path", path)
+	if errors.Is(err, errInvalidCommand) {
+		s.Metrics.decodeFailed(msg)
+		logger.Warn("invalid command", "error", err)
+		return
+	}
+	logger.Error("unable to apply command", "error", err)
+}
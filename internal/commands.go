@@ -5,6 +5,8 @@ type Command struct {
 	Path string `json:"path" msgpack:"path"`
 }
 
+func (c Command) command() Command { return c }
+
 type SetObject struct {
 	Command
 	Object ThreeObject `json:"object" msgpack:"object"`
@@ -20,15 +22,15 @@ type Delete struct {
 }
 
 type SetAnimation struct {
-	Animations interface{}
 	Command
-	Options AnimationOptions
+	Animations interface{}      `json:"animations" msgpack:"animations"`
+	Options    AnimationOptions `json:"options" msgpack:"options"`
 }
 
 type SetProperty struct {
-	Value interface{}
 	Command
-	SetProperty string
+	Property string      `json:"property" msgpack:"property"`
+	Value    interface{} `json:"value" msgpack:"value"`
 }
 
 type CaptureImage struct {
@@ -37,7 +39,20 @@ type CaptureImage struct {
 	Yres int `json:"yres" msgpack:"yres"`
 }
 
+// SetStatus reports server health to the viewer, e.g. a lost telemetry link.
+// It is a set_object command for a text label.
+type SetStatus struct {
+	Command
+	Object StatusLabel[LinkStatus] `json:"object" msgpack:"object"`
+}
+
+// SetClockStatus shows the simulation time in the viewer, as a text label.
+type SetClockStatus struct {
+	Command
+	Object StatusLabel[ClockStatus] `json:"object" msgpack:"object"`
+}
+
 type AnimationOptions struct {
-	Play        bool
-	Repetitions int
+	Play        bool `json:"play" msgpack:"play"`
+	Repetitions int  `json:"repetitions" msgpack:"repetitions"`
 }
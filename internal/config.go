@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete server configuration.
+//
+// Every setting can come from, in increasing order of precedence, its
+// default, an optional YAML or TOML config file, the environment variable
+// named by its `env` tag and the command line flag named by its `flag` tag.
+type Config struct {
+	HTTP    HTTPConfig   `yaml:"http" toml:"http"`
+	WS      WSConfig     `yaml:"websocket" toml:"websocket"`
+	Auth    AuthConfig   `yaml:"auth" toml:"auth"`
+	NATS    NATSConfig   `yaml:"nats" toml:"nats"`
+	Workers WorkerConfig `yaml:"workers" toml:"workers"`
+	// Persistence keeps the scene state in JetStream across restarts.
+	Persistence PersistenceConfig `yaml:"persistence" toml:"persistence"`
+	Recording   RecordingConfig   `yaml:"recording" toml:"recording"`
+	Log         LogConfig         `yaml:"log" toml:"log"`
+	MQTT        MQTTConfig        `yaml:"mqtt" toml:"mqtt"`
+	GRPC        GRPCConfig        `yaml:"grpc" toml:"grpc"`
+	ROS         ROSConfig         `yaml:"ros" toml:"ros"`
+	// Vehicles sets the motion limits and models of vehicles, by scene path.
+	Vehicles map[string]VehicleConfig `yaml:"vehicles" toml:"vehicles"`
+	Sim      SimConfig                `yaml:"sim" toml:"sim"`
+	Clock    ClockConfig              `yaml:"clock" toml:"clock"`
+	// ShutdownTimeout bounds how long in-flight missions and viewers get to wind down.
+	ShutdownTimeout time.Duration `env:"MESHCAT_SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" desc:"time allowed for a graceful shutdown" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		HTTP:            DefaultHTTPConfig(),
+		WS:              DefaultWSConfig(),
+		NATS:            DefaultNATSConfig(),
+		Workers:         DefaultWorkerConfig(),
+		Persistence:     DefaultPersistenceConfig(),
+		Recording:       DefaultRecordingConfig(),
+		Log:             DefaultLogConfig(),
+		MQTT:            DefaultMQTTConfig(),
+		GRPC:            DefaultGRPCConfig(),
+		ROS:             DefaultROSConfig(),
+		Sim:             DefaultSimConfig(),
+		Clock:           DefaultClockConfig(),
+		ShutdownTimeout: 10 * time.Second,
+	}
+}
+
+func (cfg Config) Validate() error {
+	if cfg.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown timeout must be positive, got %v", cfg.ShutdownTimeout)
+	}
+	return errors.Join(
+		cfg.HTTP.Validate(),
+		cfg.WS.Validate(),
+		cfg.Workers.Validate(),
+		cfg.NATS.Embedded.Validate(),
+		cfg.Persistence.Validate(),
+		cfg.Recording.Validate(),
+		cfg.Log.Validate(),
+		cfg.MQTT.Validate(),
+		cfg.GRPC.Validate(),
+		cfg.ROS.Validate(),
+		validateVehicles(cfg.Vehicles),
+		cfg.Sim.Validate(),
+		cfg.Clock.Validate(),
+	)
+}
+
+// LoadConfig builds the configuration for the command line args (without the
+// program name). printConfig reports whether `--print-config` was passed.
+// extra registers the flags of a subcommand alongside the configuration flags.
+func LoadConfig(args []string, extra ...func(*flag.FlagSet)) (cfg Config, printConfig bool, err error) {
+	cfg = DefaultConfig()
+
+	fs := flag.NewFlagSet("go-meshcat", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("MESHCAT_CONFIG"), "optional YAML or TOML config file (env MESHCAT_CONFIG)")
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective configuration and exit")
+	var flagValues []func()
+	registerFlags(fs, reflect.ValueOf(&cfg).Elem(), &flagValues)
+	for _, register := range extra {
+		register(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile, &cfg); err != nil {
+			return cfg, false, err
+		}
+	}
+	if cfg, err = Getenv("", cfg); err != nil {
+		return cfg, false, err
+	}
+	for _, apply := range flagValues {
+		apply()
+	}
+	return cfg, printConfig, cfg.Validate()
+}
+
+// registerFlags adds a flag for every field of v tagged `flag:"name"`. Values
+// are parsed when the flags are, but only applied by calling the functions
+// appended to apply, so flags win over the config file and environment.
+func registerFlags(fs *flag.FlagSet, v reflect.Value, apply *[]func()) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, ok := field.Tag.Lookup("flag")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct {
+				registerFlags(fs, v.Field(i), apply)
+			}
+			continue
+		}
+		usage := field.Tag.Get("desc")
+		if env := field.Tag.Get("env"); env != "" {
+			usage = fmt.Sprintf("%s (env %s)", usage, env)
+		}
+		target := v.Field(i)
+		fs.Func(name, usage, func(s string) error {
+			parsed := reflect.New(target.Type()).Elem()
+			if err := setFromString(parsed, s); err != nil {
+				return err
+			}
+			*apply = append(*apply, func() { target.Set(parsed) })
+			return nil
+		})
+	}
+}
+
+func loadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %v", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file type %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Redacted returns a copy of cfg with credentials masked.
+func (cfg Config) Redacted() Config {
+	const redacted = "<redacted>"
+	if len(cfg.Auth.Tokens) > 0 {
+		tokens := TokenAuth{}
+		i := 0
+		for _, role := range cfg.Auth.Tokens {
+			i++
+			tokens[fmt.Sprintf("%s-%d", redacted, i)] = role
+		}
+		cfg.Auth.Tokens = tokens
+	}
+	if len(cfg.Auth.Basic) > 0 {
+		users := BasicAuth{}
+		for user, cred := range cfg.Auth.Basic {
+			users[user] = BasicCredential{Password: redacted, Role: cred.Role}
+		}
+		cfg.Auth.Basic = users
+	}
+	if cfg.Auth.ShareSecret != "" {
+		cfg.Auth.ShareSecret = redacted
+	}
+	return cfg
+}
+
+// Print writes the configuration, with credentials redacted, as YAML.
+func (cfg Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
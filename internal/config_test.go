@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "meshcat.yaml")
+	os.WriteFile(file, []byte(`
+http:
+  addr: ":7000"
+nats:
+  url: nats://from-file:4222
+workers:
+  workers: 4
+  queue_size: 50
+auth:
+  tokens:
+    secret-token: control
+shutdown_timeout: 3s
+`), 0o600)
+	t.Setenv("NATS_URL", "nats://from-env:4222")
+	t.Setenv("MESHCAT_QUEUE_SIZE", "60")
+
+	cfg, printConfig, err := LoadConfig([]string{"--config", file, "--queue-size", "70", "--print-config"})
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !printConfig {
+		t.Errorf("expected --print-config to be reported")
+	}
+	if cfg.HTTP.Addr != ":7000" {
+		t.Errorf("Addr = %s; want the file value", cfg.HTTP.Addr)
+	}
+	if cfg.NATS.URL != "nats://from-env:4222" {
+		t.Errorf("NATS URL = %s; want the environment value", cfg.NATS.URL)
+	}
+	if cfg.Workers.Workers != 4 || cfg.Workers.QueueSize != 70 {
+		t.Errorf("Workers = %+v; want 4 workers from the file and queue size 70 from the flag", cfg.Workers)
+	}
+	if cfg.ShutdownTimeout != 3*time.Second {
+		t.Errorf("ShutdownTimeout = %v", cfg.ShutdownTimeout)
+	}
+	if cfg.Auth.Tokens["secret-token"] != RoleControl {
+		t.Errorf("Tokens = %v", cfg.Auth.Tokens)
+	}
+	if cfg.HTTP.StaticDir != DefaultHTTPConfig().StaticDir {
+		t.Errorf("StaticDir = %s; want the default", cfg.HTTP.StaticDir)
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	if strings.Contains(out.String(), "secret-token") {
+		t.Errorf("printed config leaks a token:\n%s", out.String())
+	}
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "meshcat.toml")
+	os.WriteFile(file, []byte(`
+[http]
+addr = ":9000"
+
+[websocket]
+pong_wait = "5s"
+`), 0o600)
+	cfg, _, err := LoadConfig([]string{"--config", file})
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.HTTP.Addr != ":9000" || cfg.WS.PongWait != 5*time.Second {
+		t.Errorf("unexpected config %+v %+v", cfg.HTTP, cfg.WS)
+	}
+}
+
+func TestLoadConfigInvalidFlag(t *testing.T) {
+	if _, _, err := LoadConfig([]string{"--workers", "many"}); err == nil {
+		t.Errorf("expected an error for a non-numeric worker count")
+	}
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// EmbeddedNATSConfig configures a NATS server run inside the go-meshcat
+// process, so a single binary is a complete visualiser.
+type EmbeddedNATSConfig struct {
+	Enabled bool   `env:"MESHCAT_EMBEDDED_NATS" flag:"embedded-nats" desc:"run a NATS server in-process instead of connecting to NATS_URL" yaml:"enabled" toml:"enabled"`
+	Host    string `env:"MESHCAT_EMBEDDED_NATS_HOST" yaml:"host" toml:"host"`
+	// Port is the client port, -1 picks a free port.
+	Port int `env:"MESHCAT_EMBEDDED_NATS_PORT" flag:"embedded-nats-port" desc:"client port of the embedded NATS server" yaml:"port" toml:"port"`
+	// JetStream enables persistence, storing streams under StoreDir (a temporary directory if empty).
+	JetStream bool   `env:"MESHCAT_EMBEDDED_JETSTREAM" yaml:"jetstream" toml:"jetstream"`
+	StoreDir  string `env:"MESHCAT_JETSTREAM_STORE_DIR" flag:"jetstream-store-dir" desc:"JetStream storage directory of the embedded NATS server" yaml:"store_dir" toml:"store_dir"`
+	// MQTTPort and WebsocketPort enable the MQTT and NATS websocket listeners when non-zero.
+	MQTTPort      int `env:"MESHCAT_EMBEDDED_MQTT_PORT" flag:"mqtt-port" desc:"MQTT port of the embedded NATS server, 0 disables MQTT" yaml:"mqtt_port" toml:"mqtt_port"`
+	WebsocketPort int `env:"MESHCAT_EMBEDDED_NATS_WS_PORT" yaml:"websocket_port" toml:"websocket_port"`
+	// ReadyTimeout bounds how long startup waits for the server to accept clients.
+	ReadyTimeout time.Duration `env:"MESHCAT_EMBEDDED_NATS_READY_TIMEOUT" yaml:"ready_timeout" toml:"ready_timeout"`
+}
+
+func DefaultEmbeddedNATSConfig() EmbeddedNATSConfig {
+	return EmbeddedNATSConfig{
+		Host:         "127.0.0.1",
+		Port:         4222,
+		JetStream:    true,
+		ReadyTimeout: 10 * time.Second,
+	}
+}
+
+func (cfg EmbeddedNATSConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.MQTTPort != 0 && !cfg.JetStream {
+		return fmt.Errorf("the embedded MQTT listener requires JetStream")
+	}
+	return nil
+}
+
+// StartEmbeddedNATS starts a NATS server and waits for it to accept client connections.
+func StartEmbeddedNATS(cfg EmbeddedNATSConfig) (*server.Server, error) {
+	opts := &server.Options{
+		ServerName: "go-meshcat",
+		Host:       cfg.Host,
+		Port:       cfg.Port,
+		JetStream:  cfg.JetStream,
+		StoreDir:   cfg.StoreDir,
+		NoSigs:     true,
+	}
+	if cfg.MQTTPort != 0 {
+		opts.MQTT = server.MQTTOpts{Host: cfg.Host, Port: cfg.MQTTPort}
+	}
+	if cfg.WebsocketPort != 0 {
+		opts.Websocket = server.WebsocketOpts{Host: cfg.Host, Port: cfg.WebsocketPort, NoTLS: true}
+	}
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure embedded NATS server: %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(cfg.ReadyTimeout) {
+		ns.Shutdown()
+		return nil, fmt.Errorf("embedded NATS server not ready after %v", cfg.ReadyTimeout)
+	}
+	return ns, nil
+}
@@ -1,42 +1,160 @@
 package internal
 
 import (
+	"encoding"
 	"fmt"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
 )
 
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Getenv reads key from the environment and converts it to T, returning
+// fallback when the variable is unset. Scalars, durations ("1m30s"),
+// comma separated slices, "k=v" maps and encoding.TextUnmarshaler types are
+// supported.
+//
+// If T is a struct, Getenv instead binds every field tagged `env:"NAME"` from
+// the variable NAME, prefixed with key and an underscore if key is non-empty.
+// Untagged nested structs are descended into, and fields without a set
+// variable keep their value from fallback.
 func Getenv[T any](key string, fallback T) (T, error) {
-	var result T
-	valueType := reflect.TypeOf(result)
-	valuePtr := reflect.New(valueType)
-	returnValue := valuePtr.Elem()
+	result := fallback
+	returnValue := reflect.ValueOf(&result).Elem()
+
+	if returnValue.Kind() == reflect.Struct && !reflect.PointerTo(returnValue.Type()).Implements(textUnmarshalerType) {
+		if err := bindEnv(returnValue, key); err != nil {
+			return fallback, err
+		}
+		return result, nil
+	}
 
 	value := os.Getenv(key)
 	if value == "" {
 		return fallback, nil
 	}
-	switch returnValue.Kind() {
-	case reflect.Int:
-		intValue, err := strconv.Atoi(value)
+	if err := setFromString(returnValue, value); err != nil {
+		return fallback, fmt.Errorf("%s: %v", key, err)
+	}
+	return result, nil
+}
+
+func bindEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, tagged := field.Tag.Lookup("env")
+		if !tagged {
+			if field.Type.Kind() == reflect.Struct {
+				if err := bindEnv(v.Field(i), prefix); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if err := setFromString(v.Field(i), value); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// setFromString parses value into v according to v's type.
+func setFromString(v reflect.Value, value string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		intValue, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(intValue)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		uintValue, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(uintValue)
+	case reflect.Float32, reflect.Float64:
+		floatValue, err := strconv.ParseFloat(value, v.Type().Bits())
 		if err != nil {
-			return result, err
+			return err
 		}
-		returnValue.SetInt(int64(intValue))
-	case reflect.Float64:
-		floatValue, err := strconv.ParseFloat(value, 64)
+		v.SetFloat(floatValue)
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(value)
 		if err != nil {
-			return result, err
+			return err
 		}
-		returnValue.SetFloat(floatValue)
+		v.SetBool(boolValue)
 	case reflect.String:
-		returnValue.SetString(value)
+		v.SetString(value)
+	case reflect.Slice:
+		items := splitList(value)
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFromString(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Map:
+		// Entries are merged into the existing map, so a variable can
+		// override individual defaults.
+		m := reflect.MakeMap(v.Type())
+		iter := v.MapRange()
+		for iter.Next() {
+			m.SetMapIndex(iter.Key(), iter.Value())
+		}
+		for _, entry := range splitList(value) {
+			k, val, ok := strings.Cut(entry, "=")
+			if !ok {
+				return fmt.Errorf("expected <key>=<value>, got %q", entry)
+			}
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := setFromString(key, strings.TrimSpace(k)); err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setFromString(elem, strings.TrimSpace(val)); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+		}
+		v.Set(m)
 	case reflect.Struct:
-		return result, fmt.Errorf("struct casting not supported")
+		return fmt.Errorf("struct casting not supported")
 	default:
-		return result, fmt.Errorf("unsupported kind: %s", returnValue.Kind())
+		return fmt.Errorf("unsupported kind: %s", v.Kind())
 	}
-
-	return returnValue.Interface().(T), nil
+	return nil
 }
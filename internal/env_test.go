@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetenv(t *testing.T) {
+	t.Setenv("TEST_INT", "42")
+	t.Setenv("TEST_BOOL", "true")
+	t.Setenv("TEST_DURATION", "1m30s")
+	t.Setenv("TEST_SLICE", "a, b,c")
+	t.Setenv("TEST_FLOATS", "1.5,2")
+	t.Setenv("TEST_ROLE", "control")
+
+	if got, err := Getenv("TEST_INT", 1); err != nil || got != 42 {
+		t.Errorf("Getenv int = %v, %v", got, err)
+	}
+	if got, err := Getenv("TEST_UNSET", 7); err != nil || got != 7 {
+		t.Errorf("Getenv fallback = %v, %v", got, err)
+	}
+	if got, err := Getenv("TEST_BOOL", false); err != nil || !got {
+		t.Errorf("Getenv bool = %v, %v", got, err)
+	}
+	if got, err := Getenv("TEST_DURATION", time.Second); err != nil || got != 90*time.Second {
+		t.Errorf("Getenv duration = %v, %v", got, err)
+	}
+	if got, err := Getenv("TEST_SLICE", []string(nil)); err != nil || !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("Getenv []string = %v, %v", got, err)
+	}
+	if got, err := Getenv("TEST_FLOATS", []float64(nil)); err != nil || !reflect.DeepEqual(got, []float64{1.5, 2}) {
+		t.Errorf("Getenv []float64 = %v, %v", got, err)
+	}
+	if got, err := Getenv("TEST_ROLE", RoleNone); err != nil || got != RoleControl {
+		t.Errorf("Getenv Role = %v, %v", got, err)
+	}
+	if got, err := Getenv("TEST_BOOL", 0); err == nil {
+		t.Errorf("expected an error parsing a bool as int, got %v", got)
+	}
+}
+
+func TestGetenvStruct(t *testing.T) {
+	type inner struct {
+		Levels map[string]int `env:"LEVELS"`
+	}
+	type settings struct {
+		Name    string        `env:"NAME"`
+		Timeout time.Duration `env:"TIMEOUT"`
+		Ignored int
+		Nested  inner
+	}
+	t.Setenv("APP_NAME", "meshcat")
+	t.Setenv("APP_LEVELS", "b=2")
+
+	fallback := settings{Timeout: time.Second, Ignored: 3, Nested: inner{Levels: map[string]int{"a": 1}}}
+	got, err := Getenv("APP", fallback)
+	if err != nil {
+		t.Fatalf("Getenv struct: %v", err)
+	}
+	want := settings{Name: "meshcat", Timeout: time.Second, Ignored: 3, Nested: inner{Levels: map[string]int{"a": 1, "b": 2}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Getenv struct = %+v; want %+v", got, want)
+	}
+	if len(fallback.Nested.Levels) != 1 {
+		t.Errorf("Getenv modified the fallback map: %v", fallback.Nested.Levels)
+	}
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/labstack/echo/v4"
+)
+
+// viewerBundles are the file names the viewer build is looked up under in the static directory.
+var viewerBundles = []string{"main.min.js", "main.js"}
+
+// ReadViewerBundle reads the built viewer JS from the static directory.
+func ReadViewerBundle(staticDir string) ([]byte, error) {
+	for _, name := range viewerBundles {
+		b, err := os.ReadFile(filepath.Join(staticDir, name))
+		if err == nil {
+			return b, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("no viewer bundle (%v) in %s, build web/meshcat first", viewerBundles, staticDir)
+}
+
+// ExportOptions configures a standalone HTML export.
+type ExportOptions struct {
+	Title string
+	// Frames is an optional recorded animation, played on top of the scene.
+	Frames []Frame
+	// Loop restarts the animation from the scene when it ends.
+	Loop bool
+}
+
+type exportFrame struct {
+	T    float64 `json:"t"`
+	Data string  `json:"data"`
+}
+
+// exportTemplate mirrors meshcat-python's static_html: the viewer bundle is
+// inlined and the commands are fed to it as msgpack, base64 encoded.
+var exportTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>body { margin: 0; } #meshcat-pane { width: 100vw; height: 100vh; overflow: hidden; }</style>
+</head>
+<body>
+<div id="meshcat-pane"></div>
+<script>{{.Bundle}}</script>
+<script>
+(function () {
+  var scene = {{.Scene}};
+  var roots = {{.Roots}};
+  var frames = {{.Frames}};
+  var loop = {{.Loop}};
+  var viewer = new MeshCat.Viewer(document.getElementById("meshcat-pane"));
+  function decode(data) {
+    return Uint8Array.from(atob(data), function (c) { return c.charCodeAt(0); });
+  }
+  function load() {
+    scene.forEach(function (data) { viewer.handle_command_bytearray(decode(data)); });
+  }
+  function play() {
+    var start = performance.now();
+    var next = 0;
+    function tick() {
+      var t = (performance.now() - start) / 1000;
+      for (; next < frames.length && frames[next].t <= t; next++) {
+        viewer.handle_command_bytearray(decode(frames[next].data));
+      }
+      if (next < frames.length) {
+        requestAnimationFrame(tick);
+      } else if (loop) {
+        roots.forEach(function (path) { viewer.handle_command({type: "delete", path: path}); });
+        load();
+        play();
+      }
+    }
+    requestAnimationFrame(tick);
+  }
+  load();
+  if (frames.length > 0) {
+    play();
+  }
+})();
+</script>
+</body>
+</html>
+`))
+
+// ExportHTML writes a self-contained HTML page that shows the scene, and
+// plays the recorded frames if any, without a server. A looping animation
+// restarts by deleting the outermost paths of the scene and the frames.
+func ExportHTML(w io.Writer, bundle []byte, scene []SceneEntry, opts ExportOptions) error {
+	encoded := make([]string, len(scene))
+	paths := NewSceneState()
+	for i, entry := range scene {
+		encoded[i] = base64.StdEncoding.EncodeToString(entry.Data)
+		paths.Apply(entry.SceneKey, nil)
+	}
+	frames := []exportFrame{}
+	for _, f := range opts.Frames {
+		if f.Source != SourceViewer || statusFrame(f) {
+			continue
+		}
+		frames = append(frames, exportFrame{T: f.Offset.Seconds(), Data: base64.StdEncoding.EncodeToString(f.Data)})
+		if key, err := SceneKeyOf(f.Subject, f.Data); err == nil && key.Type != "delete" {
+			paths.Apply(key, nil)
+		}
+	}
+	title := opts.Title
+	if title == "" {
+		title = "MeshCat"
+	}
+	// A bundle containing "</script" would end the inline script early.
+	bundle = bytes.ReplaceAll(bundle, []byte("</script"), []byte(`<\/script`))
+	sceneJSON, err := json.Marshal(encoded)
+	if err != nil {
+		return err
+	}
+	framesJSON, err := json.Marshal(frames)
+	if err != nil {
+		return err
+	}
+	roots := sceneRoots(paths.Snapshot())
+	if roots == nil {
+		roots = []string{}
+	}
+	rootsJSON, err := json.Marshal(roots)
+	if err != nil {
+		return err
+	}
+	return exportTemplate.Execute(w, map[string]interface{}{
+		"Title":  title,
+		"Bundle": template.JS(bundle),
+		"Scene":  template.JS(sceneJSON),
+		"Roots":  template.JS(rootsJSON),
+		"Frames": template.JS(framesJSON),
+		"Loop":   opts.Loop,
+	})
+}
+
+// ExportHandler downloads the current scene as a standalone HTML page, e.g.
+// `GET /api/export/html?session=flight-12&file=...&loop=true`. Bundling a
+// recording requires the control role, like downloading it, and replaces the
+// current scene with the one the recording started from.
+func (s *Server) ExportHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		bundle, err := ReadViewerBundle(s.HTTP.StaticDir)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+		}
+		opts := ExportOptions{Title: c.QueryParam("title"), Loop: c.QueryParam("loop") == "true"}
+		scene := s.Scene.Snapshot()
+		if session := c.QueryParam("session"); session != "" {
+			if RoleFromContext(c) < RoleControl {
+				return echo.NewHTTPError(http.StatusForbidden, "exporting a recording requires the control role")
+			}
+			name, err := s.Recordings.Path(session, c.QueryParam("file"))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			var header RecordingHeader
+			if header, opts.Frames, err = ReadRecording(name); err != nil {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			scene = header.Scene
+		}
+		var buf bytes.Buffer
+		if err := ExportHTML(&buf, bundle, scene, opts); err != nil {
+			return err
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="meshcat-scene.html"`)
+		return c.Blob(http.StatusOK, echo.MIMETextHTMLCharsetUTF8, buf.Bytes())
+	}
+}
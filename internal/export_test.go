@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportHTML(t *testing.T) {
+	var buf bytes.Buffer
+	bundle := []byte(`var MeshCat = {}; // "</script>" in a string`)
+	scene := []SceneEntry{{SceneKey: SceneKey{Type: "set_object", Path: "/a"}, Data: []byte{0x81, 0xa1}}}
+	frames := []Frame{
+		{Offset: time.Second, Source: SourceNATS, Data: []byte("raw")},
+		{Offset: 2 * time.Second, Source: SourceViewer, Subject: "set_transform", Data: []byte{0x82}},
+		viewerFrame(3*time.Second, "set_object", "/a/b", "b"),
+		viewerFrame(3*time.Second, "set_object", "/c", "c"),
+		viewerFrame(4*time.Second, "set_object", clockStatusPath, "clock"),
+	}
+	if err := ExportHTML(&buf, bundle, scene, ExportOptions{Title: "Flight <12>", Frames: frames, Loop: true}); err != nil {
+		t.Fatalf("ExportHTML: %v", err)
+	}
+	page := buf.String()
+	for _, want := range []string{
+		`<title>Flight &lt;12&gt;</title>`,
+		`"<\/script>" in a string`,
+		`var scene = ["` + base64.StdEncoding.EncodeToString([]byte{0x81, 0xa1}) + `"]`,
+		`var frames = [{"t":2,"data":"` + base64.StdEncoding.EncodeToString([]byte{0x82}) + `"},`,
+		// The loop clears what the scene and the frames drew, not the whole viewer.
+		`var roots = ["/a","/c"]`,
+		`var loop =  true `,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("export is missing %q", want)
+		}
+	}
+	if strings.Contains(page, base64.StdEncoding.EncodeToString([]byte("raw"))) {
+		t.Error("export contains raw NATS input")
+	}
+	if strings.Contains(page, base64.StdEncoding.EncodeToString(frames[4].Data)) {
+		t.Error("export contains a status label")
+	}
+	if strings.Contains(page, `path: "/"`) {
+		t.Error("export deletes the whole scene")
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	static := t.TempDir()
+	os.WriteFile(filepath.Join(static, "main.min.js"), []byte("var MeshCat = {};"), 0o644)
+	s, srv := newTestServer(t, func(cfg *Config) {
+		cfg.HTTP.StaticDir = static
+	})
+	s.NATS.Publish("meshcat.transformations.drone1", []byte(`{"translation": [0, 0, 1]}`))
+	s.NATS.Flush()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Scene.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/export/html")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Disposition"), "attachment") {
+		t.Fatalf("GET /api/export/html = %d %v", resp.StatusCode, resp.Header)
+	}
+	snapshot := s.Scene.Snapshot()
+	if len(snapshot) != 1 || !strings.Contains(body.String(), base64.StdEncoding.EncodeToString(snapshot[0].Data)) {
+		t.Error("export does not contain the scene")
+	}
+}
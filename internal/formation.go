@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// maxFormationMembers bounds the vehicles a formation mission flies.
+const maxFormationMembers = 256
+
+// FormationMission flies the vehicles at Paths in formation with a leader,
+// the vehicle at the mission's own path, which flies the Leader mission.
+type FormationMission struct {
+	Type string `json:"type"`
+	// Leader is the mission the leader flies, whose heading, profile and
+	// publish rate the members share.
+	Leader missionSpec `json:"leader"`
+	// Paths are the scene paths of the vehicles following the leader.
+	Paths []string `json:"paths"`
+	// Shape places the members relative to the leader: "line" abreast of it,
+	// a "v" behind it, a "grid" behind it with the leader at the front left
+	// corner, or a "circle" around it. Offsets, if set, place them instead.
+	Shape   string  `json:"shape"`
+	Spacing float64 `json:"spacing"`
+	// Offsets are the [x, y] or [x, y, z] offsets of the members from the
+	// leader, x pointing forward and y to the left.
+	Offsets [][]float64 `json:"offsets"`
+	// Rotate turns the formation with the leader's heading, so a V stays
+	// behind the leader as it turns. It has no effect on a leader with the
+	// "none" heading.
+	Rotate bool `json:"rotate"`
+}
+
+// missionSpec is a mission nested in another's spec.
+type missionSpec struct {
+	Mission
+}
+
+func (m *missionSpec) UnmarshalJSON(data []byte) error {
+	mission, err := ParseMission(data)
+	if err != nil {
+		return err
+	}
+	m.Mission = mission
+	return nil
+}
+
+func (m *FormationMission) kind() string { return m.Type }
+
+// common is the leader's, which sets the heading, timing and interpolation
+// of the whole formation.
+func (m *FormationMission) common() *missionBase {
+	if m.Leader.Mission == nil {
+		return &missionBase{}
+	}
+	return m.Leader.common()
+}
+
+func (m *FormationMission) validate() error {
+	if m.Leader.Mission == nil {
+		return errors.New("leader is required")
+	}
+	if m.Leader.kind() == "formation" {
+		return errors.New("a formation cannot lead another")
+	}
+	errs := []error{checkPositive("spacing", m.Spacing)}
+	if len(m.Paths) == 0 {
+		errs = append(errs, errors.New("paths is required"))
+	}
+	if len(m.Paths) > maxFormationMembers {
+		errs = append(errs, fmt.Errorf("formation has %d members, more than the limit of %d", len(m.Paths), maxFormationMembers))
+	}
+	seen := map[string]bool{}
+	for _, path := range m.Paths {
+		if path == "" || seen[path] {
+			errs = append(errs, fmt.Errorf("paths must be distinct and not empty, got %q", path))
+		}
+		seen[path] = true
+	}
+	switch m.Shape {
+	case "line", "v", "grid", "circle":
+	default:
+		errs = append(errs, fmt.Errorf("shape must be line, v, grid or circle, got %q", m.Shape))
+	}
+	if m.Offsets != nil {
+		if len(m.Offsets) != len(m.Paths) {
+			errs = append(errs, fmt.Errorf("offsets must have one offset per path, got %d for %d paths", len(m.Offsets), len(m.Paths)))
+		}
+		for i, offset := range m.Offsets {
+			if len(offset) != 2 && len(offset) != 3 {
+				errs = append(errs, fmt.Errorf("offset %d must have 2 or 3 values, got %d", i, len(offset)))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Waypoints are the leader's.
+func (m *FormationMission) Waypoints() ([][]float64, time.Duration) {
+	return m.Leader.Waypoints()
+}
+
+// offsets are the offsets of the members from the leader.
+func (m *FormationMission) offsets() [][]float64 {
+	offsets := make([][]float64, len(m.Paths))
+	for i := range offsets {
+		if m.Offsets != nil {
+			offsets[i] = append([]float64{}, m.Offsets[i]...)
+			if len(offsets[i]) == 2 {
+				offsets[i] = append(offsets[i], 0)
+			}
+			continue
+		}
+		// Line and V members alternate left and right of the leader, moving
+		// out a rank every two members.
+		rank, side := float64(i/2+1)*m.Spacing, float64(1-2*(i%2))
+		switch m.Shape {
+		case "line":
+			offsets[i] = []float64{0, side * rank, 0}
+		case "v":
+			offsets[i] = []float64{-rank, side * rank, 0}
+		case "grid":
+			columns := int(math.Ceil(math.Sqrt(float64(len(m.Paths) + 1))))
+			slot := i + 1
+			offsets[i] = []float64{-float64(slot/columns) * m.Spacing, -float64(slot%columns) * m.Spacing, 0}
+		case "circle":
+			angle := 2 * math.Pi * float64(i) / float64(len(m.Paths))
+			offsets[i] = []float64{m.Spacing * math.Cos(angle), m.Spacing * math.Sin(angle), 0}
+		}
+	}
+	return offsets
+}
+
+// Formation publishes the poses of the vehicles following a MissionWork's
+// waypoints.
+type Formation struct {
+	// Paths are the NATS subjects the members' transforms are published on.
+	Paths   []string
+	Offsets [][]float64
+	Rotate  bool
+}
+
+// memberPose is the pose of member i when the leader is at leader, a
+// position optionally followed by an orientation. Members share the leader's
+// orientation.
+func (f *Formation) memberPose(leader []float64, i int) []float64 {
+	offset := f.Offsets[i]
+	dx, dy := offset[0], offset[1]
+	if f.Rotate && len(leader) >= 7 {
+		// Only the yaw turns the formation, so it stays level.
+		x, y, z, w := leader[3], leader[4], leader[5], leader[6]
+		yaw := math.Atan2(2*(w*z+x*y), 1-2*(y*y+z*z))
+		dx, dy = dx*math.Cos(yaw)-dy*math.Sin(yaw), dx*math.Sin(yaw)+dy*math.Cos(yaw)
+	}
+	pose := append([]float64{}, leader...)
+	pose[0] += dx
+	pose[1] += dy
+	pose[2] += offset[2]
+	return pose
+}
+
+// publisher wraps publish to publish every member of the formation on conn
+// with the leader, so they move in lock-step.
+func (f *Formation) publisher(conn *nats.Conn, publish func([]float64, io.Writer) error) func([]float64, io.Writer) error {
+	return func(wp []float64, w io.Writer) error {
+		errs := []error{publish(wp, w)}
+		for i, path := range f.Paths {
+			errs = append(errs, publish(f.memberPose(wp, i), NatsMissionWriter{Conn: conn, Path: path}))
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// formationPaths maps scene paths to the subjects their transforms are published on.
+func formationPaths(paths []string) []string {
+	subjects := make([]string, len(paths))
+	for i, path := range paths {
+		subjects[i] = pathSubject("meshcat.transformations.", path)
+	}
+	return subjects
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestFormationOffsets(t *testing.T) {
+	tests := []struct {
+		spec    string
+		offsets [][]float64
+	}{
+		{`{"type": "formation", "leader": {"type": "orbit"}, "shape": "line", "paths": ["a", "b", "c"]}`,
+			[][]float64{{0, 1, 0}, {0, -1, 0}, {0, 2, 0}}},
+		{`{"type": "formation", "leader": {"type": "orbit"}, "paths": ["a", "b", "c"]}`,
+			[][]float64{{-1, 1, 0}, {-1, -1, 0}, {-2, 2, 0}}},
+		{`{"type": "formation", "leader": {"type": "orbit"}, "shape": "grid", "paths": ["a", "b", "c"]}`,
+			[][]float64{{0, -1, 0}, {-1, 0, 0}, {-1, -1, 0}}},
+		{`{"type": "formation", "leader": {"type": "orbit"}, "shape": "circle", "spacing": 2, "paths": ["a", "b", "c", "d"]}`,
+			[][]float64{{2, 0, 0}, {0, 2, 0}, {-2, 0, 0}, {0, -2, 0}}},
+		{`{"type": "formation", "leader": {"type": "orbit"}, "offsets": [[1, 2], [3, 4, 5]], "paths": ["a", "b"]}`,
+			[][]float64{{1, 2, 0}, {3, 4, 5}}},
+	}
+	for _, test := range tests {
+		mission, err := ParseMission([]byte(test.spec))
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+		offsets := mission.(*FormationMission).offsets()
+		for i := range test.offsets {
+			if !floatsEqual(offsets[i], test.offsets[i]) {
+				t.Errorf("%s: got offsets %v; want %v", test.spec, offsets, test.offsets)
+				break
+			}
+		}
+	}
+
+	// Turned to face +y, a V trails along -y.
+	f := Formation{Offsets: [][]float64{{-1, 1, 0}}, Rotate: true}
+	yaw := math.Pi / 2
+	leader := []float64{1, 1, 1, 0, 0, math.Sin(yaw / 2), math.Cos(yaw / 2)}
+	if pose := f.memberPose(leader, 0); !floatsEqual(pose, []float64{0, 0, 1, 0, 0, math.Sin(yaw / 2), math.Cos(yaw / 2)}) {
+		t.Errorf("member at %v", pose)
+	}
+	f.Rotate = false
+	if pose := f.memberPose(leader, 0); !floatsEqual(pose[:3], []float64{0, 2, 1}) {
+		t.Errorf("unrotated member at %v", pose)
+	}
+}
+
+func TestFormationErrors(t *testing.T) {
+	tests := map[string]string{
+		`{"type": "formation", "paths": ["a"]}`:                                                                               "leader is required",
+		`{"type": "formation", "leader": {"type": "orbit"}}`:                                                                  "paths is required",
+		`{"type": "formation", "leader": {"type": "orbit"}, "paths": ["a", "a"]}`:                                             "distinct",
+		`{"type": "formation", "leader": {"type": "orbit"}, "paths": ["a"], "shape": "diamond"}`:                              "shape",
+		`{"type": "formation", "leader": {"type": "orbit"}, "paths": ["a"], "offsets": [[1], [2]]}`:                           "one offset per path",
+		`{"type": "formation", "leader": {"type": "orbit", "radius": -1}, "paths": ["a"]}`:                                    "radius must be positive",
+		`{"type": "formation", "leader": {"type": "formation", "leader": {"type": "orbit"}, "paths": ["a"]}, "paths": ["b"]}`: "cannot lead",
+		`{"type": "formation", "leader": {"type": "orbit"}, "paths": ["a"], "heading": {"mode": "none"}}`:                     "unknown field",
+	}
+	for spec, want := range tests {
+		_, err := ParseMission([]byte(spec))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v; want an error containing %q", spec, err, want)
+		}
+	}
+}
+
+func TestFormationMission(t *testing.T) {
+	s, _ := newTestServer(t)
+	events, err := s.NATS.SubscribeSync("meshcat.mission.status.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := `{"type": "formation", "shape": "line", "paths": ["wing/1", "wing/2"],
+		"leader": {"type": "hover", "position": [0, 0, 1], "duration": 0.1, "rate": 10, "heading": {"mode": "fixed", "yaw": 1.5707963267948966}}}`
+	reply := missionRequest(t, s, "meshcat.mission.lead", spec)
+	if reply.Mission == nil || reply.Mission.Type != "formation" || len(reply.Mission.Members) != 2 {
+		t.Fatalf("submit: %+v", reply)
+	}
+	nextMissionStatus(t, events, MissionCompleted)
+	waitFor(t, func() bool { return len(s.Scene.Snapshot()) == 3 })
+
+	// Facing +y, the line abreast runs along x.
+	want := map[string][]float64{"/lead": {0, 0, 1}, "/wing/1": {-1, 0, 1}, "/wing/2": {1, 0, 1}}
+	for path, position := range want {
+		translation, rotation := sceneTransform(t, s, path)
+		if !floatsEqual(translation, position) || !floatsEqual(rotation, []float64{0, 0, math.Sqrt2 / 2, math.Sqrt2 / 2}) {
+			t.Errorf("%s at %v rotated %v; want %v", path, translation, rotation, position)
+		}
+	}
+}
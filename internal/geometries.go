@@ -2,7 +2,6 @@ package internal
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"path"
 	"reflect"
@@ -48,11 +47,8 @@ func (g GenericGeom) get_element() SceneElement {
 
 func (g GenericGeom) get_matrix() []float32 {
 	// assume position comes in as [x, y, z]
-	fmt.Printf("in matrix func %v\n", g)
-	fmt.Println(g["position"])
 	position, ok := g["position"]
 	if !ok {
-		fmt.Println("Position not found")
 		x, ok := g["x"].(float32)
 		if !ok {
 			x = 0
@@ -71,7 +67,6 @@ func (g GenericGeom) get_matrix() []float32 {
 			// Assign the converted value back to the map
 			return []float32{1, 0, 0, float32(position[0]), 0, 1, 0, float32(position[1]), 0, 0, 1, float32(position[2]), 0, 0, 0, 1}
 		} else {
-			fmt.Println("Error converting:", err)
 			return []float32{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
 		}
 	}
@@ -99,11 +94,19 @@ func interfaceToFloatSlice(val interface{}) ([]float64, error) {
 	return floatSlice, nil
 }
 
+// init_element gives a geometry with a type a fresh uuid. One without a type
+// has it inferred by get_element. The type, shape and uuid must be strings.
 func (geom GenericGeom) init_element() error {
+	for _, key := range []string{"type", "shape", "uuid"} {
+		if v := geom[key]; v != nil {
+			if _, ok := v.(string); !ok {
+				return fmt.Errorf("geometry %s must be a string, got %v", key, v)
+			}
+		}
+	}
 	_type, ok := geom["type"].(string)
 	if !ok {
-		// todo: determine the type base on attributes
-		return fmt.Errorf("Geometry type not found")
+		return nil
 	}
 	scene_element := SceneElement{
 		Uuid: uuid.NewString(),
@@ -237,7 +240,6 @@ func NewStarling(x, y, z float64) (MeshGeometry, error) {
 	wd, _ := os.Getwd()
 	data, err := os.ReadFile(path.Join(wd, "/web/meshcat/data/starling1.stl"))
 	if err != nil {
-		log.Fatal(err)
 		return MeshGeometry{}, err
 	}
 	return MeshGeometry{
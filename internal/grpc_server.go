@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/friend0/go-meshcat/pkg/meshcatpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCConfig configures the gRPC API, served on its own listener.
+type GRPCConfig struct {
+	// Addr is the bind address of the gRPC listener, empty disables it.
+	Addr string `env:"MESHCAT_GRPC_ADDR" flag:"grpc-listen" desc:"address to serve the gRPC API on, empty disables it" yaml:"addr" toml:"addr"`
+	// EventBufferSize is the number of viewer events queued per
+	// WatchViewerEvents stream; a slower client misses events.
+	EventBufferSize int `env:"MESHCAT_GRPC_EVENT_BUFFER_SIZE" yaml:"event_buffer_size" toml:"event_buffer_size"`
+}
+
+func DefaultGRPCConfig() GRPCConfig {
+	return GRPCConfig{EventBufferSize: 256}
+}
+
+func (cfg GRPCConfig) Validate() error {
+	if cfg.EventBufferSize <= 0 {
+		return fmt.Errorf("gRPC event buffer size must be positive, got %d", cfg.EventBufferSize)
+	}
+	return nil
+}
+
+// grpcService implements meshcatpb.MeshcatServer on top of the command pipeline.
+type grpcService struct {
+	meshcatpb.UnimplementedMeshcatServer
+	s *Server
+}
+
+// newGRPCServer builds the gRPC server, using the HTTP listener's
+// certificates when TLS is enabled.
+func (s *Server) newGRPCServer() (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.grpcUnaryRecover, s.grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(s.grpcStreamRecover, s.grpcStreamAuth),
+	}
+	if s.HTTP.TLSEnabled() {
+		cr, err := newCertReloader(s.HTTP.TLSCertFile, s.HTTP.TLSKeyFile, s.HTTP.CertReloadInterval, s.Logger)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: cr.GetCertificate,
+		})))
+	}
+	srv := grpc.NewServer(opts...)
+	meshcatpb.RegisterMeshcatServer(srv, &grpcService{s: s})
+	return srv, nil
+}
+
+// startGRPC listens on the configured address and serves the gRPC API in
+// the background.
+func (s *Server) startGRPC() error {
+	srv, err := s.newGRPCServer()
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", s.GRPC.Addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen for gRPC: %v", err)
+	}
+	s.grpc = srv
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			s.Logger.Error("gRPC listener stopped", "subsystem", "grpc", "addr", s.GRPC.Addr, "error", err)
+		}
+	}()
+	s.Logger.Info("serving gRPC API", "subsystem", "grpc", "addr", l.Addr().String())
+	return nil
+}
+
+// stopGRPC ends the event streams and waits, until ctx expires, for
+// in-flight calls to finish.
+func (s *Server) stopGRPC(ctx context.Context) error {
+	if s.grpc == nil {
+		return nil
+	}
+	close(s.grpcQuit)
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
+
+// grpcMethodRole is the role needed to call a method: watching the viewers
+// is like viewing, everything else changes the scene.
+func grpcMethodRole(method string) Role {
+	if method == meshcatpb.Meshcat_WatchViewerEvents_FullMethodName {
+		return RoleViewer
+	}
+	return RoleControl
+}
+
+// grpcAuthorize checks the credentials in the call metadata against the
+// HTTP authentication settings: a bearer token in `authorization`, or a
+// `token` or `share` entry.
+func (s *Server) grpcAuthorize(ctx context.Context, method string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r := &http.Request{Header: http.Header{}, URL: &url.URL{}}
+	query := url.Values{}
+	for _, v := range md.Get("authorization") {
+		r.Header.Add("Authorization", v)
+	}
+	for _, param := range []string{tokenParam, shareParam} {
+		if v := md.Get(param); len(v) > 0 {
+			query.Set(param, v[0])
+		}
+	}
+	r.URL.RawQuery = query.Encode()
+	role := s.Auth.Authenticate(r)
+	switch {
+	case role == RoleNone:
+		return status.Error(codes.Unauthenticated, "missing or invalid credentials")
+	case role < grpcMethodRole(method):
+		return status.Errorf(codes.PermissionDenied, "%s needs the %s role", method, grpcMethodRole(method))
+	}
+	return nil
+}
+
+func (s *Server) grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.grpcAuthorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.grpcAuthorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// grpcRecover turns a panic in a handler into an Internal error, since gRPC
+// would otherwise let it take down the server.
+func (s *Server) grpcRecover(method string, err *error) {
+	if r := recover(); r != nil {
+		s.Logger.Error("gRPC handler panicked", "subsystem", "grpc", "method", method, "panic", r)
+		*err = status.Errorf(codes.Internal, "%s failed", method)
+	}
+}
+
+func (s *Server) grpcUnaryRecover(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
+	defer s.grpcRecover(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func (s *Server) grpcStreamRecover(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer s.grpcRecover(info.FullMethod, &err)
+	return handler(srv, ss)
+}
+
+// grpcError maps a pipeline error to a gRPC status.
+func grpcError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errInvalidCommand):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errHubClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (g *grpcService) SetObject(ctx context.Context, req *meshcatpb.SetObjectRequest) (*meshcatpb.CommandReply, error) {
+	var geom GenericGeom
+	if req.Geometry != nil {
+		geom = req.Geometry.AsMap()
+	}
+	return &meshcatpb.CommandReply{}, grpcError(g.s.setGeometry(req.Path, geom))
+}
+
+func (g *grpcService) SetTransform(ctx context.Context, req *meshcatpb.SetTransformRequest) (*meshcatpb.CommandReply, error) {
+	return &meshcatpb.CommandReply{}, grpcError(g.s.setTransformRequest(req))
+}
+
+func (g *grpcService) SetProperty(ctx context.Context, req *meshcatpb.SetPropertyRequest) (*meshcatpb.CommandReply, error) {
+	return &meshcatpb.CommandReply{}, grpcError(g.s.setProperty(req.Path, req.Property, req.Value.AsInterface()))
+}
+
+func (g *grpcService) Delete(ctx context.Context, req *meshcatpb.DeleteRequest) (*meshcatpb.CommandReply, error) {
+	return &meshcatpb.CommandReply{}, grpcError(g.s.applyDelete(req.Path))
+}
+
+func (g *grpcService) SetAnimation(ctx context.Context, req *meshcatpb.SetAnimationRequest) (*meshcatpb.CommandReply, error) {
+	var animations interface{}
+	if req.Animations != nil {
+		animations = req.Animations.AsSlice()
+	}
+	options := AnimationOptions{
+		Play:        req.GetOptions().GetPlay(),
+		Repetitions: int(req.GetOptions().GetRepetitions()),
+	}
+	return &meshcatpb.CommandReply{}, grpcError(g.s.setAnimation(req.Path, animations, options))
+}
+
+func (g *grpcService) StreamPoses(stream meshcatpb.Meshcat_StreamPosesServer) error {
+	var reply meshcatpb.StreamPosesReply
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&reply)
+		}
+		if err != nil {
+			return err
+		}
+		err = g.s.setTransformRequest(req)
+		switch {
+		case err == nil:
+			reply.Applied++
+		case errors.Is(err, errInvalidCommand):
+			reply.Rejected++
+		default:
+			return grpcError(err)
+		}
+	}
+}
+
+func (g *grpcService) WatchViewerEvents(req *meshcatpb.WatchViewerEventsRequest, stream meshcatpb.Meshcat_WatchViewerEventsServer) error {
+	types := map[string]bool{}
+	for _, t := range req.Types {
+		types[t] = true
+	}
+	prefix := normalizePath(req.PathPrefix)
+	events, stop := g.s.Hub.watch(g.s.GRPC.EventBufferSize)
+	defer stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-g.s.grpcQuit:
+			return status.Error(codes.Unavailable, "server shutting down")
+		case m := <-events:
+			if len(types) > 0 && !types[m.kind] {
+				continue
+			}
+			key, err := SceneKeyOf(m.kind, m.data)
+			if err != nil || !under(normalizePath(key.Path), prefix) {
+				continue
+			}
+			err = stream.Send(&meshcatpb.ViewerEvent{
+				Type:    m.kind,
+				Path:    key.Path,
+				Command: m.data,
+				Time:    timestamppb.New(m.queued),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// setTransformRequest applies a gRPC transform, which takes the same forms
+// as the JSON TransformationCommand.
+func (s *Server) setTransformRequest(req *meshcatpb.SetTransformRequest) error {
+	transformation_matrix, err := normalizeTransformation(TransformationCommand{
+		Matrix4:     req.Matrix,
+		Translation: req.Translation,
+		Rotation:    req.Rotation,
+		Scale:       req.Scale,
+	})
+	if err != nil {
+		return invalidCommand("%v", err)
+	}
+	return s.setTransform(req.Path, transformation_matrix)
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/friend0/go-meshcat/pkg/meshcatpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newGRPCTestClient starts a test server with the gRPC listener enabled and
+// returns a client connected to it.
+func newGRPCTestClient(t *testing.T, configure ...func(*Config)) (*Server, meshcatpb.MeshcatClient) {
+	t.Helper()
+	addr := "127.0.0.1:" + strconv.Itoa(freePort(t))
+	configure = append(configure, func(cfg *Config) { cfg.GRPC.Addr = addr })
+	s, _ := newTestServer(t, configure...)
+	if err := s.startGRPC(); err != nil {
+		t.Fatalf("startGRPC: %v", err)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial gRPC: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, meshcatpb.NewMeshcatClient(conn)
+}
+
+func TestGRPCUnaryCommandsReachScene(t *testing.T) {
+	s, client := newGRPCTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.SetTransform(ctx, &meshcatpb.SetTransformRequest{
+		Path:        "drone1",
+		Translation: []float64{1, 2, 3},
+		Rotation:    []float64{0, 0, 0, 1},
+	})
+	if err != nil {
+		t.Fatalf("SetTransform: %v", err)
+	}
+	_, err = client.SetProperty(ctx, &meshcatpb.SetPropertyRequest{
+		Path:     "drone1",
+		Property: "visible",
+		Value:    structpb.NewBoolValue(false),
+	})
+	if err != nil {
+		t.Fatalf("SetProperty: %v", err)
+	}
+	if n := s.Scene.Len(); n != 2 {
+		t.Fatalf("scene has %d entries; want the transform and the property", n)
+	}
+
+	_, err = client.SetTransform(ctx, &meshcatpb.SetTransformRequest{Path: "drone1", Rotation: []float64{1, 2}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("invalid rotation: got %v; want InvalidArgument", err)
+	}
+	_, err = client.Delete(ctx, &meshcatpb.DeleteRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("delete without path: got %v; want InvalidArgument", err)
+	}
+	geometry, _ := structpb.NewStruct(map[string]interface{}{"type": 5})
+	_, err = client.SetObject(ctx, &meshcatpb.SetObjectRequest{Path: "drone1", Geometry: geometry})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("geometry with a numeric type: got %v; want InvalidArgument", err)
+	}
+}
+
+func TestGRPCRecover(t *testing.T) {
+	s := &Server{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	_, err := s.grpcUnaryRecover(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/meshcat.Meshcat/SetObject"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { panic("bad geometry") })
+	if status.Code(err) != codes.Internal {
+		t.Errorf("panicking handler: got %v; want Internal", err)
+	}
+}
+
+func TestGRPCStreamPoses(t *testing.T) {
+	s, client := newGRPCTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamPoses(ctx)
+	if err != nil {
+		t.Fatalf("StreamPoses: %v", err)
+	}
+	poses := []*meshcatpb.SetTransformRequest{
+		{Path: "drone1", Translation: []float64{0, 0, 1}},
+		{Path: "drone2", Translation: []float64{0, 0, 2}},
+		{Path: "drone3", Rotation: []float64{0, 0, 0, 0}},
+		{Path: "drone4", Rotation: []float64{math.NaN(), 0, 0, 1}},
+		// A quaternion that is not quite unit length is normalized, not rejected.
+		{Path: "drone5", Rotation: []float64{0, 0, 0.7071, 0.7071}},
+	}
+	for _, pose := range poses {
+		if err := stream.Send(pose); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	reply, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv: %v", err)
+	}
+	if reply.Applied != 3 || reply.Rejected != 2 {
+		t.Errorf("applied %d, rejected %d; want 3 and 2", reply.Applied, reply.Rejected)
+	}
+	if n := s.Scene.Len(); n != 3 {
+		t.Errorf("scene has %d entries; want 3", n)
+	}
+	if _, rotation := sceneTransform(t, s, "/drone5"); !floatsEqual(rotation, []float64{0, 0, math.Sqrt2 / 2, math.Sqrt2 / 2}) {
+		t.Errorf("drone5 rotated %v", rotation)
+	}
+}
+
+func TestGRPCWatchViewerEvents(t *testing.T) {
+	_, client := newGRPCTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := client.WatchViewerEvents(ctx, &meshcatpb.WatchViewerEventsRequest{
+		Types:      []string{"set_transform"},
+		PathPrefix: "fleet",
+	})
+	if err != nil {
+		t.Fatalf("WatchViewerEvents: %v", err)
+	}
+	// The stream is registered once the server has received the request.
+	time.Sleep(50 * time.Millisecond)
+
+	for _, req := range []*meshcatpb.SetTransformRequest{
+		{Path: "other", Translation: []float64{1, 1, 1}},
+		{Path: "fleet/drone1", Translation: []float64{1, 2, 3}},
+	} {
+		if _, err := client.SetTransform(ctx, req); err != nil {
+			t.Fatalf("SetTransform: %v", err)
+		}
+	}
+	event, err := events.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if event.Type != "set_transform" || event.Path != "fleet/drone1" || len(event.Command) == 0 {
+		t.Errorf("got event %s %s; want set_transform fleet/drone1", event.Type, event.Path)
+	}
+}
+
+func TestGRPCAuthorization(t *testing.T) {
+	_, client := newGRPCTestClient(t, func(cfg *Config) {
+		cfg.Auth.Tokens = TokenAuth{"ctl": RoleControl, "view": RoleViewer}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := &meshcatpb.SetTransformRequest{Path: "drone1", Translation: []float64{1, 2, 3}}
+
+	if _, err := client.SetTransform(ctx, req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("anonymous: got %v; want Unauthenticated", err)
+	}
+	viewer := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer view")
+	if _, err := client.SetTransform(viewer, req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("viewer: got %v; want PermissionDenied", err)
+	}
+	control := metadata.AppendToOutgoingContext(ctx, "token", "ctl")
+	if _, err := client.SetTransform(control, req); err != nil {
+		t.Errorf("control: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// HTTPConfig configures the listeners the viewer is served on.
+type HTTPConfig struct {
+	// Addr is the bind address of the main listener.
+	Addr string `env:"MESHCAT_LISTEN_ADDR" flag:"listen" desc:"address to serve the viewer on" yaml:"addr" toml:"addr"`
+	// TLSCertFile and TLSKeyFile enable HTTPS (and HTTP/2) when both are set.
+	TLSCertFile string `env:"MESHCAT_TLS_CERT_FILE" flag:"tls-cert" desc:"TLS certificate file" yaml:"tls_cert_file" toml:"tls_cert_file"`
+	TLSKeyFile  string `env:"MESHCAT_TLS_KEY_FILE" flag:"tls-key" desc:"TLS key file" yaml:"tls_key_file" toml:"tls_key_file"`
+	// CertReloadInterval is how often the certificate files are checked for changes.
+	CertReloadInterval time.Duration `env:"MESHCAT_TLS_RELOAD_INTERVAL" yaml:"tls_reload_interval" toml:"tls_reload_interval"`
+	// RedirectAddr, if set, starts a plain HTTP listener that redirects to HTTPS.
+	RedirectAddr string `env:"MESHCAT_HTTP_REDIRECT_ADDR" flag:"redirect-addr" desc:"plain HTTP listener redirecting to HTTPS" yaml:"redirect_addr" toml:"redirect_addr"`
+	// StaticDir and DataDir are served at `/` and `/data/`.
+	StaticDir string `env:"MESHCAT_STATIC_DIR" flag:"static-dir" desc:"directory of the built viewer bundle" yaml:"static_dir" toml:"static_dir"`
+	DataDir   string `env:"MESHCAT_DATA_DIR" flag:"data-dir" desc:"directory of viewer data files" yaml:"data_dir" toml:"data_dir"`
+}
+
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		Addr:               ":8080",
+		CertReloadInterval: 30 * time.Second,
+		StaticDir:          "web/meshcat/dist",
+		DataDir:            "web/meshcat/data",
+	}
+}
+
+func (cfg HTTPConfig) TLSEnabled() bool {
+	return cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+}
+
+func (cfg HTTPConfig) Validate() error {
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf("both a TLS certificate and key file are required")
+	}
+	if cfg.RedirectAddr != "" && !cfg.TLSEnabled() {
+		return fmt.Errorf("an HTTP redirect listener requires TLS to be configured")
+	}
+	return nil
+}
+
+// certReloader serves a certificate/key pair from disk, reloading it when
+// either file's modification time changes. Files are checked at most once
+// per interval, during a TLS handshake.
+type certReloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+	logger            *slog.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration, logger *slog.Logger) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval, logger: logger}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *certReloader) reload() error {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load TLS key pair: %v", err)
+	}
+	cr.cert = &cert
+	cr.certMod = certInfo.ModTime()
+	cr.keyMod = keyInfo.ModTime()
+	return nil
+}
+
+func (cr *certReloader) changed() bool {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(cr.certMod) || !keyInfo.ModTime().Equal(cr.keyMod)
+}
+
+// GetCertificate satisfies tls.Config.GetCertificate. If a changed pair fails
+// to load, e.g. because only one of the files has been replaced so far, the
+// previous certificate keeps being served and the failure is logged.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if time.Since(cr.lastCheck) >= cr.interval {
+		cr.lastCheck = time.Now()
+		if cr.changed() {
+			if err := cr.reload(); err != nil {
+				cr.logger.Warn("unable to reload TLS certificate, serving the previous one", "subsystem", "http", "cert_file", cr.certFile, "key_file", cr.keyFile, "error", err)
+			}
+		}
+	}
+	return cr.cert, nil
+}
+
+// httpServer configures the router's own http.Server, or its TLS server when
+// certificates are configured, so that Router.Shutdown stops whichever one runs.
+func (s *Server) httpServer() (*http.Server, error) {
+	srv := s.Router.Server
+	if s.HTTP.TLSEnabled() {
+		cr, err := newCertReloader(s.HTTP.TLSCertFile, s.HTTP.TLSKeyFile, s.HTTP.CertReloadInterval, s.Logger)
+		if err != nil {
+			return nil, err
+		}
+		srv = s.Router.TLSServer
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: cr.GetCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+		}
+	}
+	srv.Addr = s.HTTP.Addr
+	return srv, nil
+}
+
+// redirectHandler sends plain HTTP requests to the same host on the HTTPS listener.
+func redirectHandler(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// Start serves the router on the configured address, over TLS with HTTP/2 if
+// certificates are configured, and starts the HTTP redirect and gRPC listeners
+// if requested.
+// Like http.Server.ListenAndServe it returns http.ErrServerClosed after Shutdown.
+func (s *Server) Start() error {
+	srv, err := s.httpServer()
+	if err != nil {
+		return err
+	}
+	if s.GRPC.Addr != "" {
+		if err := s.startGRPC(); err != nil {
+			return err
+		}
+	}
+	if s.HTTP.RedirectAddr != "" {
+		s.redirect = &http.Server{Addr: s.HTTP.RedirectAddr, Handler: redirectHandler(s.HTTP.Addr)}
+		go func() {
+			if err := s.redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.Logger.Error("HTTP redirect listener stopped", "subsystem", "http", "addr", s.HTTP.RedirectAddr, "error", err)
+			}
+		}()
+	}
+	return s.Router.StartServer(srv)
+}
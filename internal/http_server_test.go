@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeSelfSignedCert(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+	writeSelfSignedCert(t, certFile, keyFile, "first", start)
+
+	var logs bytes.Buffer
+	cr, err := newCertReloader(certFile, keyFile, 0, slog.New(slog.NewTextHandler(&logs, nil)))
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	commonName := func() string {
+		cert, err := cr.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+	if got := commonName(); got != "first" {
+		t.Fatalf("CommonName = %s; want first", got)
+	}
+
+	writeSelfSignedCert(t, certFile, keyFile, "second", start.Add(time.Second))
+	if got := commonName(); got != "second" {
+		t.Errorf("CommonName after rotation = %s; want second", got)
+	}
+
+	// A half-written pair keeps serving the previous certificate.
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	os.Chtimes(keyFile, start.Add(2*time.Second), start.Add(2*time.Second))
+	if got := commonName(); got != "second" {
+		t.Errorf("CommonName with invalid key = %s; want second", got)
+	}
+	if !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), keyFile) {
+		t.Errorf("reload failure was not logged: %s", logs.String())
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		tlsAddr, host, target, location string
+	}{
+		{":443", "viewer.example.com", "/data/x?y=1", "https://viewer.example.com/data/x?y=1"},
+		{":8443", "viewer.example.com:8080", "/", "https://viewer.example.com:8443/"},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, test.target, nil)
+		r.Host = test.host
+		redirectHandler(test.tlsAddr).ServeHTTP(rec, r)
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != test.location {
+			t.Errorf("redirect(%s%s) = %d %s; want %s", test.host, test.target, rec.Code, rec.Header().Get("Location"), test.location)
+		}
+	}
+}
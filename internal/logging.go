@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogConfig configures the server's structured logs.
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `env:"MESHCAT_LOG_LEVEL" flag:"log-level" desc:"log level: debug, info, warn or error" yaml:"level" toml:"level"`
+	// Format is json or text.
+	Format string `env:"MESHCAT_LOG_FORMAT" flag:"log-format" desc:"log format: json or text" yaml:"format" toml:"format"`
+	// SampleInterval limits high-frequency logs, such as one per received
+	// transform, to one line per subject per interval. 0 logs every message.
+	SampleInterval time.Duration `env:"MESHCAT_LOG_SAMPLE_INTERVAL" yaml:"sample_interval" toml:"sample_interval"`
+}
+
+func DefaultLogConfig() LogConfig {
+	return LogConfig{
+		Level:          "info",
+		Format:         "json",
+		SampleInterval: time.Second,
+	}
+}
+
+func (cfg LogConfig) Validate() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q", cfg.Level)
+	}
+	if cfg.Format != "json" && cfg.Format != "text" {
+		return fmt.Errorf("log format must be json or text, got %q", cfg.Format)
+	}
+	if cfg.SampleInterval < 0 {
+		return fmt.Errorf("log sample interval must not be negative, got %v", cfg.SampleInterval)
+	}
+	return nil
+}
+
+// NewLogger builds the logger described by cfg, writing to w.
+func NewLogger(cfg LogConfig, w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(strings.ToLower(cfg.Level)))
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// logSampler rate-limits logs per key, e.g. per NATS subject, so a 200 Hz
+// telemetry stream yields one line per interval instead of one per message.
+type logSampler struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*sampleState
+	// swept is when keys idle for sampleIdleIntervals were last dropped.
+	swept time.Time
+}
+
+// sampleIdleIntervals is how many intervals a key may go without logs before
+// it is forgotten, so short-lived subjects do not accumulate.
+const sampleIdleIntervals = 4
+
+type sampleState struct {
+	last       time.Time
+	suppressed int
+}
+
+func newLogSampler(interval time.Duration) *logSampler {
+	return &logSampler{interval: interval, keys: map[string]*sampleState{}}
+}
+
+// allow reports whether a log for key may be written now, and how many were
+// suppressed since the last one that was.
+func (ls *logSampler) allow(key string) (ok bool, suppressed int) {
+	if ls == nil || ls.interval <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if idle := sampleIdleIntervals * ls.interval; now.Sub(ls.swept) >= idle {
+		for k, st := range ls.keys {
+			if now.Sub(st.last) >= idle {
+				delete(ls.keys, k)
+			}
+		}
+		ls.swept = now
+	}
+	st, found := ls.keys[key]
+	if !found {
+		st = &sampleState{}
+		ls.keys[key] = st
+	}
+	if found && now.Sub(st.last) < ls.interval {
+		st.suppressed++
+		return false, 0
+	}
+	suppressed, st.suppressed, st.last = st.suppressed, 0, now
+	return true, suppressed
+}
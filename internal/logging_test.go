@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogConfigValidate(t *testing.T) {
+	if err := DefaultLogConfig().Validate(); err != nil {
+		t.Fatalf("default config: %v", err)
+	}
+	for _, cfg := range []LogConfig{
+		{Level: "loud", Format: "json"},
+		{Level: "info", Format: "xml"},
+		{Level: "info", Format: "text", SampleInterval: -time.Second},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(LogConfig{Level: "warn", Format: "json"}, &buf)
+	logger.Info("dropped")
+	logger.Warn("kept", "subject", "meshcat.objects")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one line above the level, got %q", buf.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "kept" || entry["subject"] != "meshcat.objects" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+
+	buf.Reset()
+	NewLogger(LogConfig{Level: "debug", Format: "text"}, &buf).Debug("hello", "path", "drone")
+	if got := buf.String(); !strings.Contains(got, "msg=hello") || !strings.Contains(got, "path=drone") {
+		t.Errorf("unexpected text entry %q", got)
+	}
+}
+
+func TestLogSampler(t *testing.T) {
+	ls := newLogSampler(50 * time.Millisecond)
+	if ok, _ := ls.allow("a"); !ok {
+		t.Fatal("first log should be allowed")
+	}
+	for range 3 {
+		if ok, _ := ls.allow("a"); ok {
+			t.Fatal("logs within the interval should be suppressed")
+		}
+	}
+	if ok, _ := ls.allow("b"); !ok {
+		t.Error("keys should be sampled independently")
+	}
+	time.Sleep(60 * time.Millisecond)
+	ok, suppressed := ls.allow("a")
+	if !ok || suppressed != 3 {
+		t.Errorf("got ok=%v suppressed=%d, want true and 3", ok, suppressed)
+	}
+	// Keys that stop logging are forgotten after a few intervals.
+	time.Sleep(sampleIdleIntervals * 50 * time.Millisecond)
+	ls.allow("c")
+	if n := len(ls.keys); n != 1 {
+		t.Errorf("sampler holds %d keys; want 1", n)
+	}
+
+	var disabled *logSampler
+	if ok, _ := disabled.allow("a"); !ok {
+		t.Error("a nil sampler should allow every log")
+	}
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are the server's Prometheus metrics. They live in their own
+// registry so several servers can run in one process, e.g. in tests. The
+// methods are no-ops on a nil *Metrics.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	natsMessages   *prometheus.CounterVec
+	decodeFailures *prometheus.CounterVec
+	clientDrops    prometheus.Counter
+	activeWorkers  prometheus.Gauge
+	encodeLatency  *prometheus.HistogramVec
+	broadcastDelay prometheus.Histogram
+}
+
+// latencyBuckets span 10µs to ~160ms, the range of encoding a transform up to
+// fanning a mesh out to a busy hub.
+var latencyBuckets = prometheus.ExponentialBuckets(10e-6, 2, 15)
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		natsMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "meshcat_nats_messages_total",
+			Help: "NATS messages received, by subscription subject.",
+		}, []string{"subject"}),
+		decodeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "meshcat_decode_failures_total",
+			Help: "NATS messages that could not be decoded, by subscription subject.",
+		}, []string{"subject"}),
+		clientDrops: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "meshcat_ws_client_drops_total",
+			Help: "Viewers disconnected because their send queue was full.",
+		}),
+		activeWorkers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "meshcat_workqueue_active_workers",
+			Help: "Workers currently running a mission or playback.",
+		}),
+		encodeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "meshcat_encode_seconds",
+			Help:    "Time to build and msgpack encode a viewer command, by command type.",
+			Buckets: latencyBuckets,
+		}, []string{"command"}),
+		broadcastDelay: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "meshcat_broadcast_seconds",
+			Help:    "Time from writing a command to the hub until it is queued for every viewer.",
+			Buckets: latencyBuckets,
+		}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.natsMessages, m.decodeFailures, m.clientDrops, m.activeWorkers, m.encodeLatency, m.broadcastDelay,
+	)
+	return m
+}
+
+// register adds the metrics read from the server's state when scraped.
+func (m *Metrics) register(s *Server) {
+	m.Registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "meshcat_ws_clients",
+			Help: "Connected viewers.",
+		}, func() float64 { return float64(s.Hub.Clients()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "meshcat_workqueue_depth",
+			Help: "Missions and playbacks waiting for a worker.",
+		}, func() float64 { return float64(len(s.Q.Q)) }),
+		clientQueueCollector{hub: s.Hub},
+	)
+}
+
+func (m *Metrics) natsMessage(msg *nats.Msg) {
+	if m == nil {
+		return
+	}
+	m.natsMessages.WithLabelValues(subscriptionSubject(msg)).Inc()
+}
+
+func (m *Metrics) decodeFailed(msg *nats.Msg) {
+	if m == nil {
+		return
+	}
+	m.decodeFailures.WithLabelValues(subscriptionSubject(msg)).Inc()
+}
+
+func (m *Metrics) clientDropped() {
+	if m == nil {
+		return
+	}
+	m.clientDrops.Inc()
+}
+
+func (m *Metrics) workerStarted() {
+	if m == nil {
+		return
+	}
+	m.activeWorkers.Inc()
+}
+
+func (m *Metrics) workerDone() {
+	if m == nil {
+		return
+	}
+	m.activeWorkers.Dec()
+}
+
+func (m *Metrics) encoded(command string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.encodeLatency.WithLabelValues(command).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) broadcast(queued time.Time) {
+	if m == nil {
+		return
+	}
+	m.broadcastDelay.Observe(time.Since(queued).Seconds())
+}
+
+// subscriptionSubject labels a message by the subject it was subscribed
+// with, e.g. `meshcat.transformations.>`, which keeps the label set bounded.
+func subscriptionSubject(msg *nats.Msg) string {
+	if msg.Sub != nil {
+		return msg.Sub.Subject
+	}
+	return msg.Subject
+}
+
+var (
+	clientQueueDepthDesc = prometheus.NewDesc("meshcat_ws_client_queue_depth",
+		"Commands queued for a viewer.", []string{"client"}, nil)
+	clientQueueCapacityDesc = prometheus.NewDesc("meshcat_ws_client_queue_capacity",
+		"Size of a viewer's send queue; it is dropped when the queue is full.", []string{"client"}, nil)
+)
+
+// clientQueueCollector reports the send queue of every connected viewer.
+type clientQueueCollector struct {
+	hub *Hub
+}
+
+func (c clientQueueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clientQueueDepthDesc
+	ch <- clientQueueCapacityDesc
+}
+
+func (c clientQueueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stats, err := c.hub.ClientStats(ctx)
+	if err != nil {
+		return
+	}
+	for _, st := range stats {
+		ch <- prometheus.MustNewConstMetric(clientQueueDepthDesc, prometheus.GaugeValue, float64(st.Queued), st.ID)
+		ch <- prometheus.MustNewConstMetric(clientQueueCapacityDesc, prometheus.GaugeValue, float64(st.Capacity), st.ID)
+	}
+}
+
+// MetricsHandler serves the Prometheus metrics.
+func (s *Server) MetricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(s.Metrics.Registry, promhttp.HandlerOpts{Registry: s.Metrics.Registry}))
+}
+
+// HealthHandler reports that the process is up, for liveness probes.
+func (s *Server) HealthHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// ReadyHandler reports whether the server can serve viewers: it needs a NATS
+// connection and a responsive hub.
+func (s *Server) ReadyHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		checks := map[string]string{"nats": "ok", "hub": "ok"}
+		ready := true
+		if s.NATS == nil || !s.NATS.IsConnected() {
+			checks["nats"] = string(s.LinkStatus().State)
+			ready = false
+		}
+		ctx, cancel := context.WithTimeout(c.Request().Context(), time.Second)
+		defer cancel()
+		if err := s.Hub.Ping(ctx); err != nil {
+			checks["hub"] = err.Error()
+			ready = false
+		}
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		return c.JSON(status, map[string]interface{}{"ready": ready, "checks": checks})
+	}
+}
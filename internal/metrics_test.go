@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, s *Server, target string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s, srv := newTestServer(t)
+	conn := dialViewer(t, srv)
+	s.NATS.Publish("meshcat.transformations.drone1", []byte(`{"translation": [0, 0, 1]}`))
+	s.NATS.Publish("meshcat.transformations.drone1", []byte(`not json`))
+	var cmd SetTransformationCommand
+	readCommand(t, conn, "set_transform", &cmd)
+	s.NATS.Flush()
+	time.Sleep(20 * time.Millisecond)
+
+	code, body := get(t, s, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", code)
+	}
+	for _, want := range []string{
+		`meshcat_nats_messages_total{subject="meshcat.transformations.>"} 2`,
+		`meshcat_decode_failures_total{subject="meshcat.transformations.>"} 1`,
+		`meshcat_ws_clients 1`,
+		`meshcat_ws_client_queue_capacity{client=`,
+		`meshcat_workqueue_depth 0`,
+		`meshcat_workqueue_active_workers 0`,
+		`meshcat_encode_seconds_count{command="set_transform"} 1`,
+		`meshcat_broadcast_seconds_count`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics are missing %q", want)
+		}
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	s, _ := newTestServer(t, func(cfg *Config) {
+		cfg.NATS.ReconnectWait = 20 * time.Millisecond
+	})
+	if code, _ := get(t, s, "/healthz"); code != http.StatusOK {
+		t.Errorf("GET /healthz = %d", code)
+	}
+	if code, body := get(t, s, "/readyz"); code != http.StatusOK {
+		t.Errorf("GET /readyz = %d %s", code, body)
+	}
+
+	embedded := DefaultEmbeddedNATSConfig()
+	embedded.Port = s.NATSServer.Addr().(*net.TCPAddr).Port
+	embedded.StoreDir = s.NATSServer.StoreDir()
+	s.NATSServer.Shutdown()
+	s.NATSServer.WaitForShutdown()
+	waitFor(t, func() bool { return !s.NATS.IsConnected() })
+	code, body := get(t, s, "/readyz")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, `"nats":"disconnected"`) {
+		t.Errorf("GET /readyz without NATS = %d %s", code, body)
+	}
+	ns, err := StartEmbeddedNATS(embedded)
+	if err != nil {
+		t.Fatalf("restart embedded NATS: %v", err)
+	}
+	s.NATSServer = ns
+	waitFor(t, s.NATS.IsConnected)
+
+	s.Hub.Close(context.Background())
+	if _, body := get(t, s, "/readyz"); !strings.Contains(body, `"hub":"hub closed"`) {
+		t.Errorf("GET /readyz with the hub closed = %s", body)
+	}
+	if code, _ := get(t, s, "/healthz"); code != http.StatusOK {
+		t.Errorf("GET /healthz = %d; liveness should not depend on dependencies", code)
+	}
+}
@@ -1,6 +1,13 @@
 package internal
 
-import "github.com/labstack/echo/v4"
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// roleKey is the echo context key holding the authenticated Role.
+const roleKey = "role"
 
 // ServerHeader middleware adds a `Server` header to the response.
 func ServerHeader(next echo.HandlerFunc) echo.HandlerFunc {
@@ -9,3 +16,46 @@ func ServerHeader(next echo.HandlerFunc) echo.HandlerFunc {
 		return next(c)
 	}
 }
+
+// RequireRole middleware authenticates the request and rejects it unless the
+// resolved role is at least min. Credentials passed in the query string are
+// stored in a cookie so the viewer's follow-up requests carry them.
+func (s *Server) RequireRole(min Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role := s.Auth.Authenticate(c.Request())
+			if role < min {
+				if len(s.Auth.Basic) > 0 {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="meshcat"`)
+				}
+				if role == RoleNone {
+					return echo.NewHTTPError(http.StatusUnauthorized)
+				}
+				return echo.NewHTTPError(http.StatusForbidden)
+			}
+			if s.Auth.Enabled() {
+				for _, param := range []string{tokenParam, shareParam} {
+					if v := c.QueryParam(param); v != "" {
+						c.SetCookie(&http.Cookie{
+							Name:     authCookiePrefix + param,
+							Value:    v,
+							Path:     "/",
+							HttpOnly: true,
+							// Scheme honours X-Forwarded-Proto, for TLS ending at a proxy.
+							Secure:   c.Scheme() == "https",
+							SameSite: http.SameSiteStrictMode,
+						})
+					}
+				}
+			}
+			c.Set(roleKey, role)
+			return next(c)
+		}
+	}
+}
+
+// RoleFromContext returns the role set by RequireRole.
+func RoleFromContext(c echo.Context) Role {
+	role, _ := c.Get(roleKey).(Role)
+	return role
+}
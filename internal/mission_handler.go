@@ -0,0 +1,372 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+type MissionState string
+
+const (
+	MissionQueued    MissionState = "queued"
+	MissionRunning   MissionState = "running"
+	MissionPaused    MissionState = "paused"
+	MissionCompleted MissionState = "completed"
+	MissionCancelled MissionState = "cancelled"
+	MissionFailed    MissionState = "failed"
+)
+
+// MissionStatus describes a submitted mission.
+type MissionStatus struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+	// Members are the paths of the vehicles following a formation's leader.
+	Members []string     `json:"members,omitempty"`
+	State   MissionState `json:"state"`
+	// Waypoint is the number of waypoints published so far, out of Waypoints.
+	Waypoint  int `json:"waypoint"`
+	Waypoints int `json:"waypoints"`
+	// Duration is the time in seconds the mission takes, pauses aside.
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// MissionReply is the response to mission submissions and controls.
+type MissionReply struct {
+	Mission *MissionStatus `json:"mission,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+type missionControl struct {
+	Action string `json:"action"`
+}
+
+var errMissionDone = errors.New("mission has ended")
+
+// missionRun tracks a submitted mission: cancelling its context stops it,
+// and its waypoints are held while it is paused.
+type missionRun struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	// onUpdate is told about state changes and progress, e.g. to publish them.
+	onUpdate func(MissionStatus)
+
+	mu      sync.Mutex
+	status  MissionStatus
+	started bool
+	// resumed is closed when a paused mission resumes, nil unless paused.
+	resumed chan struct{}
+	// pausing is closed when the mission pauses, and replaced when it resumes.
+	pausing chan struct{}
+}
+
+func newMissionRun(status MissionStatus, onUpdate func(MissionStatus)) *missionRun {
+	ctx, cancel := context.WithCancel(context.Background())
+	status.State = MissionQueued
+	return &missionRun{ctx: ctx, cancel: cancel, done: make(chan struct{}), onUpdate: onUpdate, status: status, pausing: make(chan struct{})}
+}
+
+// Status returns the last reported state of the mission.
+func (r *missionRun) Status() MissionStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// update changes the status under the lock and reports it if publish is set.
+func (r *missionRun) update(publish bool, f func(*missionRun)) MissionStatus {
+	r.mu.Lock()
+	f(r)
+	status := r.status
+	r.mu.Unlock()
+	if publish && r.onUpdate != nil {
+		r.onUpdate(status)
+	}
+	return status
+}
+
+func (r *missionRun) terminal() bool {
+	switch r.status.State {
+	case MissionCompleted, MissionCancelled, MissionFailed:
+		return true
+	}
+	return false
+}
+
+// start marks the mission running, or paused if it was paused while queued.
+func (r *missionRun) start() {
+	if r == nil {
+		return
+	}
+	r.update(true, func(r *missionRun) {
+		r.started = true
+		if r.status.State == MissionQueued {
+			r.status.State = MissionRunning
+		}
+	})
+}
+
+// advance records that n waypoints were published, reporting every tenth
+// of the mission rather than every waypoint.
+func (r *missionRun) advance(n int) {
+	if r == nil {
+		return
+	}
+	var publish bool
+	r.update(false, func(r *missionRun) {
+		total := max(r.status.Waypoints, 1)
+		publish = n*10/total != r.status.Waypoint*10/total
+		r.status.Waypoint = n
+	})
+	if publish && r.onUpdate != nil {
+		r.onUpdate(r.Status())
+	}
+}
+
+// finish records how the mission ended, unless it was cancelled already.
+func (r *missionRun) finish(state MissionState, err string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.terminal() {
+		r.mu.Unlock()
+		return
+	}
+	r.status.State, r.status.Error = state, err
+	status := r.status
+	r.mu.Unlock()
+	if r.onUpdate != nil {
+		r.onUpdate(status)
+	}
+}
+
+// paused returns a channel closed once the mission is paused, nil for work
+// without a run.
+func (r *missionRun) paused() <-chan struct{} {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pausing
+}
+
+func (r *missionRun) isPaused() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resumed != nil
+}
+
+// waitWhilePaused blocks while the mission is paused, returning false if ctx
+// is cancelled meanwhile.
+func (r *missionRun) waitWhilePaused(ctx context.Context) bool {
+	if r == nil {
+		return true
+	}
+	r.mu.Lock()
+	resumed := r.resumed
+	r.mu.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Control cancels, pauses or resumes the mission, or just reports its status.
+func (r *missionRun) Control(c missionControl) (MissionStatus, error) {
+	var err error
+	status := r.update(false, func(r *missionRun) {
+		if r.terminal() && c.Action != "status" {
+			err = errMissionDone
+			return
+		}
+		switch c.Action {
+		case "cancel":
+			r.cancel()
+			r.status.State = MissionCancelled
+			if r.resumed != nil {
+				close(r.resumed)
+				r.resumed = nil
+			}
+		case "pause":
+			if r.resumed == nil {
+				r.resumed = make(chan struct{})
+				close(r.pausing)
+			}
+			r.status.State = MissionPaused
+		case "resume":
+			if r.resumed != nil {
+				close(r.resumed)
+				r.resumed = nil
+				r.pausing = make(chan struct{})
+			}
+			r.status.State = MissionQueued
+			if r.started {
+				r.status.State = MissionRunning
+			}
+		case "status":
+		default:
+			err = fmt.Errorf("unknown mission action %q", c.Action)
+		}
+	})
+	if err == nil && c.Action != "status" && r.onUpdate != nil {
+		r.onUpdate(status)
+	}
+	return status, err
+}
+
+// SubmitMission queues mission to fly the object at path, returning the run
+// that controls it. The mission is timed by the profile of the vehicle at
+// path unless it sets its own. Its state changes are published on
+// `meshcat.mission.status.<id>`.
+func (s *Server) SubmitMission(path string, mission Mission) (*missionRun, error) {
+	if vehicle, ok := s.Vehicles[path]; ok {
+		mission.common().Profile = vehicleProfile(mission.common().Profile, vehicle)
+	}
+	work := NewMissionWork(s.NATS, pathSubject("meshcat.transformations.", path), mission)
+	work.Clock = s.Clock
+	id := nuid.Next()
+	status := MissionStatus{
+		ID:        id,
+		Type:      work.Type,
+		Path:      path,
+		Waypoints: len(work.Waypoints),
+		Duration:  work.Duration().Seconds(),
+	}
+	if formation, ok := mission.(*FormationMission); ok {
+		status.Members = formation.Paths
+	}
+	run := newMissionRun(status, func(status MissionStatus) {
+		b, _ := json.Marshal(status)
+		s.NATS.Publish("meshcat.mission.status."+status.ID, b)
+	})
+	work.run = run
+
+	s.missionsMu.Lock()
+	if s.missions == nil {
+		s.missions = map[string]*missionRun{}
+	}
+	s.missions[id] = run
+	s.missionsMu.Unlock()
+	go func() {
+		<-run.done
+		s.missionsMu.Lock()
+		delete(s.missions, id)
+		s.missionsMu.Unlock()
+	}()
+
+	run.update(true, func(*missionRun) {})
+	if err := s.Q.Add(work); err != nil {
+		run.finish(MissionFailed, err.Error())
+		run.cancel()
+		close(run.done)
+		return nil, err
+	}
+	return run, nil
+}
+
+// missionSubscription queues the mission spec published on
+// `meshcat.mission.<path>` to fly the object at <path>. The `control` and
+// `status` tokens are reserved for mission controls and events.
+func (s *Server) missionSubscription() (*nats.Subscription, error) {
+	submit := s.observed(s.handleMission)
+	sub, err := s.NATS.Subscribe("meshcat.mission.>", func(msg *nats.Msg) {
+		if strings.HasPrefix(msg.Subject, "meshcat.mission.control.") || strings.HasPrefix(msg.Subject, "meshcat.mission.status.") {
+			// Served by missionControlSubscription, or our own status events.
+			return
+		}
+		submit(msg)
+	})
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.mission.>", "error", err)
+	}
+	return sub, err
+}
+
+// missionControlSubscription serves the controls on
+// `meshcat.mission.control.<id>`.
+func (s *Server) missionControlSubscription() (*nats.Subscription, error) {
+	sub, err := s.NATS.Subscribe("meshcat.mission.control.*", s.handleMissionControl)
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.mission.control.*", "error", err)
+	}
+	return sub, err
+}
+
+// handleMission replies with the state of the mission a request submitted.
+func (s *Server) handleMission(msg *nats.Msg) {
+	logger := s.natsLogger(msg)
+	var reply MissionReply
+	path := subjectPath(msg.Subject, "meshcat.mission.")
+	mission, err := ParseMission(msg.Data)
+	if err == nil {
+		var run *missionRun
+		if run, err = s.SubmitMission(path, mission); err == nil {
+			status := run.Status()
+			reply.Mission = &status
+			logger.Info("queued mission", "mission", status.ID, "type", status.Type, "path", path, "waypoints", status.Waypoints, "duration", status.Duration)
+		}
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	s.replyMission(msg, logger, reply)
+}
+
+// handleMissionControl replies with the state of the mission a request controlled.
+func (s *Server) handleMissionControl(msg *nats.Msg) {
+	logger := s.natsLogger(msg)
+	var reply MissionReply
+	id := strings.TrimPrefix(msg.Subject, "meshcat.mission.control.")
+	s.missionsMu.Lock()
+	run := s.missions[id]
+	s.missionsMu.Unlock()
+	var c missionControl
+	switch {
+	case run == nil:
+		reply.Error = fmt.Sprintf("no mission %s", id)
+	case json.Unmarshal(msg.Data, &c) != nil:
+		reply.Error = fmt.Sprintf("invalid mission control %q", msg.Data)
+	default:
+		status, err := run.Control(c)
+		reply.Mission = &status
+		if err != nil {
+			reply.Error = err.Error()
+			break
+		}
+		logger.Info("mission control", "mission", id, "action", c.Action, "state", status.State)
+	}
+	s.replyMission(msg, logger, reply)
+}
+
+func (s *Server) replyMission(msg *nats.Msg, logger *slog.Logger, reply MissionReply) {
+	if reply.Error != "" {
+		logger.Warn("mission request failed", "error", reply.Error)
+	}
+	if msg.Reply == "" {
+		return
+	}
+	b, _ := json.Marshal(reply)
+	if err := msg.Respond(b); err != nil {
+		logger.Error("unable to reply", "error", err)
+	}
+}
@@ -1,10 +1,12 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
 	"sync"
 	"time"
@@ -29,6 +31,14 @@ func Linspace(low, high float64, n int) []float64 {
 	return res
 }
 
+// Resample returns the times from start to end, both included, spaced evenly
+// at no less than rate samples per second. At least the two ends are returned.
+func Resample(start, end, rate float64) []float64 {
+	// Round off the error in (end-start)*rate, so 0.3 s at 10 Hz is 3 steps.
+	steps := math.Ceil((end-start)*rate - 1e-9)
+	return Linspace(start, end, max(int(steps), 1)+1)
+}
+
 func Circspace(low, high, radius float64, n int) [][]float64 {
 	res := make([][]float64, n)
 	if n == 0 {
@@ -42,23 +52,78 @@ func Circspace(low, high, radius float64, n int) [][]float64 {
 	return res
 }
 
+// WorkerConfig sizes the mission work queue.
+type WorkerConfig struct {
+	Workers   int `env:"MESHCAT_WORKERS" flag:"workers" desc:"number of mission workers" yaml:"workers" toml:"workers"`
+	QueueSize int `env:"MESHCAT_QUEUE_SIZE" flag:"queue-size" desc:"missions queued before submissions are rejected" yaml:"queue_size" toml:"queue_size"`
+}
+
+func DefaultWorkerConfig() WorkerConfig {
+	return WorkerConfig{Workers: 10, QueueSize: 100}
+}
+
+func (cfg WorkerConfig) Validate() error {
+	if cfg.Workers <= 0 || cfg.QueueSize < 0 {
+		return fmt.Errorf("invalid work queue size: %d workers, %d queued", cfg.Workers, cfg.QueueSize)
+	}
+	return nil
+}
+
 type Work interface {
-	Do(results chan string)
+	// Do runs the work item, returning early once ctx is cancelled.
+	Do(ctx context.Context, results chan string)
+}
+
+// dropper is Work that is told when the queue shuts down before running it,
+// e.g. to report that it was cancelled.
+type dropper interface {
+	drop()
+}
+
+func dropWork(work Work) {
+	if d, ok := work.(dropper); ok {
+		d.drop()
+	}
 }
 
 type WorkQueue struct {
-	Q       chan Work
+	Q chan Work
+	// Results receives the outcome of each work item. It is optional
+	// reading: outcomes are dropped while it is full.
 	Results chan string
 	NATS    *nats.Conn
+
+	// ctx is cancelled to abort in-flight work when shutdown runs out of time.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// quit is closed when the queue stops accepting and starting work.
+	quit     chan struct{}
+	quitOnce *sync.Once
+	workers  *sync.WaitGroup
+	// metrics counts the active workers, nil when not instrumented.
+	metrics *Metrics
+	logger  *slog.Logger
 }
 
 func (s *Server) InitializeWorkQueue(workers int, queue_size int, conn *nats.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
 	wq := WorkQueue{
-		Q:       make(chan Work, queue_size),
-		Results: make(chan string, queue_size),
-		NATS:    conn,
+		Q:        make(chan Work, queue_size),
+		Results:  make(chan string, queue_size),
+		NATS:     conn,
+		ctx:      ctx,
+		cancel:   cancel,
+		quit:     make(chan struct{}),
+		quitOnce: &sync.Once{},
+		workers:  &sync.WaitGroup{},
+		metrics:  s.Metrics,
+		logger:   s.Logger,
+	}
+	if wq.logger == nil {
+		wq.logger = slog.Default()
 	}
 	for i := range workers {
+		wq.workers.Add(1)
 		go MissionWorker(i, wq)
 	}
 	// go wq.Gather()
@@ -66,6 +131,11 @@ func (s *Server) InitializeWorkQueue(workers int, queue_size int, conn *nats.Con
 }
 
 func (wq *WorkQueue) Add(work Work) error {
+	select {
+	case <-wq.quit:
+		return errors.New("work queue is shut down")
+	default:
+	}
 	select {
 	case wq.Q <- work:
 		return nil
@@ -83,21 +153,127 @@ func (wq *WorkQueue) Close() {
 	close(wq.Results)
 }
 
+// Shutdown stops the workers from starting queued work and waits for in-flight
+// work to finish. If ctx expires first, in-flight work is cancelled and
+// Shutdown returns once the workers have exited.
+func (wq *WorkQueue) Shutdown(ctx context.Context) error {
+	if wq.quit == nil {
+		return nil
+	}
+	wq.quitOnce.Do(func() { close(wq.quit) })
+	done := make(chan struct{})
+	go func() {
+		wq.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		wq.cancel()
+		wq.dropQueued()
+		return nil
+	case <-ctx.Done():
+		wq.cancel()
+		<-done
+		wq.dropQueued()
+		return fmt.Errorf("in-flight work cancelled: %w", ctx.Err())
+	}
+}
+
+// dropQueued drops the work still queued once the workers have stopped.
+func (wq *WorkQueue) dropQueued() {
+	for {
+		select {
+		case work := <-wq.Q:
+			dropWork(work)
+		default:
+			return
+		}
+	}
+}
+
 func MissionWorker(id int, wq WorkQueue) {
-	fmt.Println(wq.Results)
-	for work := range wq.Q {
-		fmt.Println("Worker", id, "started job")
-		work.Do(wq.Results)
+	defer wq.workers.Done()
+	for {
+		select {
+		case <-wq.quit:
+			return
+		case work, ok := <-wq.Q:
+			if !ok {
+				return
+			}
+			select {
+			case <-wq.quit:
+				// Shutdown began while this item was queued; drop it.
+				dropWork(work)
+				return
+			default:
+			}
+			wq.logger.Debug("worker started job", "subsystem", "workqueue", "worker", id)
+			wq.metrics.workerStarted()
+			work.Do(wq.ctx, wq.Results)
+			wq.metrics.workerDone()
+		}
+	}
+}
+
+// report hands the outcome of a work item to Results without blocking, since
+// nothing may be reading it.
+func report(results chan string, result string) {
+	select {
+	case results <- result:
+	default:
 	}
 }
 
+// MissionWork publishes the waypoints of a mission as transforms on Path.
 type MissionWork struct {
 	Conn      *nats.Conn
 	Path      string
 	Type      string
 	Waypoints [][]float64
-	Radius    float64
-	Omega     float64
+	// Interval is the time between waypoints.
+	Interval time.Duration
+
+	// Formation flies vehicles in formation with the one at Path, nil for
+	// a single vehicle.
+	Formation *Formation
+	// Clock times the waypoints, nil for the wall clock.
+	Clock *Clock
+
+	// run controls the mission and reports its progress, nil for work that
+	// was not submitted through SubmitMission.
+	run *missionRun
+}
+
+// NewMissionWork samples mission into the work that flies it on path, as
+// poses oriented by its heading.
+func NewMissionWork(conn *nats.Conn, path string, mission Mission) MissionWork {
+	waypoints, interval := mission.Waypoints()
+	waypoints, interval = missionPoses(waypoints, interval, *mission.common())
+	work := MissionWork{Conn: conn, Path: path, Type: mission.kind(), Waypoints: waypoints, Interval: interval}
+	if formation, ok := mission.(*FormationMission); ok {
+		work.Formation = &Formation{Paths: formationPaths(formation.Paths), Offsets: formation.offsets(), Rotate: formation.Rotate}
+	}
+	return work
+}
+
+// Duration is the time the work takes to publish its waypoints, the first
+// one an interval after it starts.
+func (mw MissionWork) Duration() time.Duration {
+	if len(mw.Waypoints) == 0 {
+		return 0
+	}
+	return mw.Interval + missionDuration(mw.Waypoints, mw.Interval)
+}
+
+// drop reports a mission the queue shut down before running as cancelled.
+func (mw MissionWork) drop() {
+	if mw.run == nil {
+		return
+	}
+	mw.run.finish(MissionCancelled, "work queue shut down")
+	mw.run.cancel()
+	close(mw.run.done)
 }
 
 type NatsMissionWriter struct {
@@ -118,7 +294,10 @@ func (nmw NatsMissionWriter) Write(p []byte) (n int, err error) {
 
 func transform_publisher(wp []float64, w io.Writer) error {
 	tc := TransformationCommand{
-		Translation: wp,
+		Translation: wp[:3],
+	}
+	if len(wp) >= 7 {
+		tc.Rotation = wp[3:7]
 	}
 	tranformation_json, err := json.Marshal(tc)
 	if err != nil {
@@ -128,36 +307,85 @@ func transform_publisher(wp []float64, w io.Writer) error {
 	return nil
 }
 
-func WaypointIterator(sink io.Writer, waypoints [][]float64, transform_publisher func([]float64, io.Writer) error, ts time.Duration) {
-	var wg sync.WaitGroup
+// WaypointIterator publishes waypoints ts apart on clock, nil for the wall
+// clock, until they run out or ctx is cancelled. A waypoint is a position,
+// optionally followed by an [x, y, z, w] orientation, and optionally followed
+// by the delay in milliseconds until the next waypoint.
+func WaypointIterator(ctx context.Context, clock *Clock, sink io.Writer, waypoints [][]float64, transform_publisher func([]float64, io.Writer) error, ts time.Duration) {
+	iterateWaypoints(ctx, clock, sink, waypoints, transform_publisher, ts, nil)
+}
+
+// iterateWaypoints is WaypointIterator for a mission run, which it holds
+// while paused and tells about every published waypoint.
+func iterateWaypoints(ctx context.Context, clock *Clock, sink io.Writer, waypoints [][]float64, transform_publisher func([]float64, io.Writer) error, ts time.Duration, run *missionRun) {
 	if ts == 0 {
 		ts = 1
 	}
-	ticker := time.NewTicker(ts)
-	wg.Add(1)
-	go func(waypoints [][]float64) {
-		defer wg.Done()
-		for _, wp := range waypoints {
-			<-ticker.C
-			if len(wp) == 4 {
-				ticker.Reset(time.Duration(wp[3]) * time.Millisecond)
+	next := clock.Now()
+	for i, wp := range waypoints {
+		next = next.Add(ts)
+		for {
+			// A pause wakes the wait, so the mission stops as soon as it
+			// reports that it is paused.
+			reached := clock.sleepUntil(ctx, next, run.paused())
+			if ctx.Err() != nil {
+				return
+			}
+			if reached && !run.isPaused() {
+				break
+			}
+			// Hold while paused, then wait out the rest of the interval.
+			pausedAt := clock.Now()
+			if !run.waitWhilePaused(ctx) {
+				return
 			}
-			transform_publisher(wp[:3], sink)
+			next = next.Add(clock.Now().Sub(pausedAt))
 		}
-	}(waypoints)
-	wg.Wait()
-	ticker.Stop()
+		pose := wp
+		if len(wp) == 4 || len(wp) == 8 {
+			pose = wp[:len(wp)-1]
+			if d := waypointDelay(wp, ts); d > 0 {
+				ts = d
+			}
+		}
+		transform_publisher(pose, sink)
+		run.advance(i + 1)
+	}
 }
 
-func (mw MissionWork) Do(results chan string) {
-	// full_path := strings.Join([]string{"meshcat.transform"}, ".")
+func (mw MissionWork) Do(ctx context.Context, results chan string) {
+	if mw.run != nil {
+		defer close(mw.run.done)
+		var stop context.CancelFunc
+		ctx, stop = context.WithCancel(ctx)
+		defer stop()
+		defer context.AfterFunc(mw.run.ctx, stop)()
+	}
 	nmw := NatsMissionWriter{
 		Path: mw.Path,
 		Conn: mw.Conn,
 	}
-	if mw.Type == "orbit" {
-		waypoints := Circspace(0, 2*math.Pi, mw.Radius, 100)
-		WaypointIterator(nmw, waypoints, transform_publisher, time.Duration(mw.Omega/100*1e9))
+	for i, wp := range mw.Waypoints {
+		switch len(wp) {
+		case 3, 4, 7, 8:
+		default:
+			err := fmt.Sprintf("waypoint %d has %d values", i, len(wp))
+			mw.run.finish(MissionFailed, err)
+			report(results, "Invalid: "+err)
+			return
+		}
+	}
+	publish := transform_publisher
+	if mw.Formation != nil {
+		publish = mw.Formation.publisher(mw.Conn, publish)
+	}
+	mw.run.start()
+	iterateWaypoints(ctx, mw.Clock, nmw, mw.Waypoints, publish, mw.Interval, mw.run)
+	if ctx.Err() != nil {
+		mw.run.finish(MissionCancelled, "")
+		report(results, "Cancelled")
+		return
 	}
-	results <- "Complete"
+	mw.run.finish(MissionCompleted, "")
+	report(results, "Complete")
 }
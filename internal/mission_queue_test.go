@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math"
@@ -59,5 +60,46 @@ func mock_publisher(wp []float64, w io.Writer) error {
 
 func TestWaypointIterator(t *testing.T) {
 	wp := Circspace(0, 2*math.Pi, 1, 10)
-	WaypointIterator(os.Stderr, wp, mock_publisher, 1*time.Millisecond)
+	WaypointIterator(context.Background(), nil, os.Stderr, wp, mock_publisher, 1*time.Millisecond)
+}
+
+type blockingWork struct {
+	started chan struct{}
+}
+
+func (bw blockingWork) Do(ctx context.Context, results chan string) {
+	close(bw.started)
+	<-ctx.Done()
+	results <- "Cancelled"
+}
+
+func TestWorkQueueShutdown(t *testing.T) {
+	s := Server{}
+	s.InitializeWorkQueue(1, 10, nil)
+	work := blockingWork{started: make(chan struct{})}
+	s.Q.Add(work)
+	<-work.started
+	queued := MissionWork{run: newMissionRun(MissionStatus{}, nil)}
+	s.Q.Add(queued)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Q.Shutdown(ctx); err == nil {
+		t.Errorf("expected Shutdown to report cancelled work")
+	}
+	if result := <-s.Q.Results; result != "Cancelled" {
+		t.Errorf("result = %s; want Cancelled", result)
+	}
+	// The mission still queued is reported cancelled.
+	select {
+	case <-queued.run.done:
+	default:
+		t.Error("queued mission was not dropped")
+	}
+	if status := queued.run.Status(); status.State != MissionCancelled || status.Error != "work queue shut down" {
+		t.Errorf("queued mission = %+v", status)
+	}
+	if err := s.Q.Add(work); err == nil {
+		t.Errorf("expected Add to fail after Shutdown")
+	}
 }
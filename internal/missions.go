@@ -0,0 +1,472 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Missions are submitted on `meshcat.mission.<path>` as a JSON spec selected
+// by its "type", e.g. `{"type": "orbit", "radius": 2, "period": 10}`. Every
+// type has its own geometry and sampling parameters; the ones left out keep
+// the defaults from missionTypes.
+
+// maxMissionSamples bounds the waypoints a single mission may produce.
+const maxMissionSamples = 100000
+
+// defaultPublishRate is the rate in Hz smooth interpolations are published at.
+const defaultPublishRate = 60
+
+// Mission is a parsed mission spec.
+type Mission interface {
+	// Waypoints samples the mission into [x, y, z] waypoints, published
+	// interval apart.
+	Waypoints() (waypoints [][]float64, interval time.Duration)
+	kind() string
+	common() *missionBase
+	validate() error
+}
+
+// missionBase holds the fields every mission type accepts.
+type missionBase struct {
+	Type string `json:"type"`
+	// Heading sets the yaw of the poses, facing the direction of travel by default.
+	Heading *Heading `json:"heading"`
+	// PublishRate, if set, publishes interpolated poses between the
+	// waypoints at this rate in Hz.
+	PublishRate float64 `json:"publish_rate"`
+	// Interpolation is the curve followed between waypoints, linear by default.
+	Interpolation string `json:"interpolation"`
+	// Profile, if set, times the mission by its path and the vehicle's limits
+	// instead of by its waypoints.
+	Profile *Profile `json:"profile"`
+}
+
+func (m missionBase) kind() string          { return m.Type }
+func (m *missionBase) common() *missionBase { return m }
+
+func (m missionBase) validate() error {
+	var errs []error
+	if m.Heading != nil {
+		errs = append(errs, m.Heading.validate())
+	}
+	if m.Profile != nil {
+		errs = append(errs, m.Profile.validate())
+	}
+	if m.PublishRate < 0 || math.IsInf(m.PublishRate, 0) {
+		errs = append(errs, fmt.Errorf("publish_rate must not be negative, got %v", m.PublishRate))
+	}
+	switch m.Interpolation {
+	case "", "linear", "catmull_rom", "hermite", "min_snap":
+	default:
+		errs = append(errs, fmt.Errorf("interpolation must be linear, catmull_rom, hermite or min_snap, got %q", m.Interpolation))
+	}
+	return errors.Join(errs...)
+}
+
+// publishRate is the rate poses are published at between waypoints, 0 to
+// publish the waypoints only. Smooth curves and profiled missions are
+// published at 60 Hz unless another rate is set.
+func (m missionBase) publishRate() float64 {
+	if m.PublishRate == 0 && (m.smooth() || m.Profile != nil) {
+		return defaultPublishRate
+	}
+	return m.PublishRate
+}
+
+// smooth reports whether the mission follows a curve between waypoints.
+func (m missionBase) smooth() bool {
+	return m.Interpolation != "" && m.Interpolation != "linear"
+}
+
+// missionTypes returns a spec with its defaults for every mission type.
+var missionTypes = map[string]func() Mission{
+	"orbit": func() Mission {
+		return &OrbitMission{Radius: 1, Period: 1, Altitude: 1, Direction: "ccw", Revolutions: 1, Samples: 100}
+	},
+	"line": func() Mission {
+		return &LineMission{Duration: 10, Samples: 100}
+	},
+	"waypoints": func() Mission {
+		return &WaypointsMission{Interval: 1}
+	},
+	"lissajous": func() Mission {
+		return &LissajousMission{Amplitude: []float64{1, 1}, Frequency: []float64{3, 2}, Phase: math.Pi / 2, Period: 20, Altitude: 1, Samples: 400}
+	},
+	"figure_eight": func() Mission {
+		return &FigureEightMission{Size: 1, Period: 10, Altitude: 1, Samples: 200}
+	},
+	"hover": func() Mission {
+		return &HoverMission{Position: []float64{0, 0, 1}, Duration: 10, Rate: 10}
+	},
+	"spiral": func() Mission {
+		return &SpiralMission{EndRadius: 1, Turns: 3, Direction: "ccw", Period: 5, StartAltitude: 1, EndAltitude: 1, SamplesPerTurn: 100}
+	},
+	"formation": func() Mission {
+		return &FormationMission{Shape: "v", Spacing: 1, Rotate: true}
+	},
+}
+
+// ParseMission decodes a mission spec. An empty payload is the default orbit,
+// as published by clients that predate mission specs.
+func ParseMission(data []byte) (Mission, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		data = []byte(`{"type": "orbit"}`)
+	}
+	var head missionBase
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("unable to decode mission: %v", err)
+	}
+	newMission, ok := missionTypes[head.Type]
+	if !ok {
+		names := make([]string, 0, len(missionTypes))
+		for name := range missionTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown mission type %q, expected one of %s", head.Type, strings.Join(names, ", "))
+	}
+	mission := newMission()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(mission); err != nil {
+		return nil, fmt.Errorf("unable to decode %s mission: %v", head.Type, err)
+	}
+	if err := errors.Join(mission.common().validate(), mission.validate()); err != nil {
+		return nil, fmt.Errorf("invalid %s mission: %v", head.Type, err)
+	}
+	if rate := mission.common().publishRate(); rate > 0 && mission.common().Profile == nil {
+		waypoints, interval := mission.Waypoints()
+		poses := missionDuration(waypoints, interval).Seconds()*rate + float64(len(waypoints))
+		if err := checkSamples(poses, 1); err != nil {
+			return nil, fmt.Errorf("invalid %s mission: publish_rate: %v", head.Type, err)
+		}
+	}
+	return mission, nil
+}
+
+// OrbitMission circles center at a fixed radius and altitude.
+type OrbitMission struct {
+	missionBase
+	// Center is the [x, y] center of the orbit.
+	Center   []float64 `json:"center"`
+	Radius   float64   `json:"radius"`
+	Altitude float64   `json:"altitude"`
+	// Period is the time in seconds for one revolution.
+	Period float64 `json:"period"`
+	// Direction is "ccw", counter-clockwise seen from above, or "cw".
+	Direction   string  `json:"direction"`
+	Revolutions float64 `json:"revolutions"`
+	// Samples is the number of waypoints per revolution.
+	Samples int `json:"samples"`
+}
+
+func (m *OrbitMission) validate() error {
+	return errors.Join(
+		checkPoint("center", m.Center, 2),
+		checkPositive("radius", m.Radius),
+		checkPositive("period", m.Period),
+		checkPositive("revolutions", m.Revolutions),
+		checkDirection(m.Direction),
+		checkSamples(float64(m.Samples)*m.Revolutions, m.Samples),
+	)
+}
+
+func (m *OrbitMission) Waypoints() ([][]float64, time.Duration) {
+	cx, cy := pointOr(m.Center, 0), pointOr(m.Center, 1)
+	sign := 1.0
+	if m.Direction == "cw" {
+		sign = -1
+	}
+	n := int(math.Ceil(float64(m.Samples) * m.Revolutions))
+	waypoints := make([][]float64, n)
+	for i, t := range Linspace(0, 2*math.Pi*m.Revolutions, n+1)[:n] {
+		waypoints[i] = []float64{cx + m.Radius*math.Cos(sign*t), cy + m.Radius*math.Sin(sign*t), m.Altitude}
+	}
+	return waypoints, seconds(m.Period / float64(m.Samples))
+}
+
+// LineMission flies in a straight line from From to To.
+type LineMission struct {
+	missionBase
+	From []float64 `json:"from"`
+	To   []float64 `json:"to"`
+	// Duration is the time in seconds from From to To.
+	Duration float64 `json:"duration"`
+	Samples  int     `json:"samples"`
+}
+
+func (m *LineMission) validate() error {
+	return errors.Join(
+		checkPoint("from", m.From, 3),
+		checkPoint("to", m.To, 3),
+		required("from", m.From),
+		required("to", m.To),
+		checkPositive("duration", m.Duration),
+		checkSamples(float64(m.Samples), m.Samples),
+	)
+}
+
+func (m *LineMission) Waypoints() ([][]float64, time.Duration) {
+	waypoints := make([][]float64, m.Samples)
+	for i := range waypoints {
+		waypoints[i] = make([]float64, 3)
+	}
+	for axis := 0; axis < 3; axis++ {
+		for i, v := range Linspace(m.From[axis], m.To[axis], m.Samples) {
+			waypoints[i][axis] = v
+		}
+	}
+	return waypoints, seconds(m.Duration / float64(m.Samples))
+}
+
+// WaypointsMission visits an explicit list of waypoints: [x, y, z], or
+// [x, y, z, qx, qy, qz, qw] with an orientation, optionally followed by the
+// milliseconds until the next one.
+type WaypointsMission struct {
+	missionBase
+	Points [][]float64 `json:"points"`
+	// Interval is the default time in seconds between waypoints.
+	Interval float64 `json:"interval"`
+}
+
+func (m *WaypointsMission) validate() error {
+	errs := []error{checkPositive("interval", m.Interval), checkSamples(float64(len(m.Points)), 1)}
+	if len(m.Points) == 0 {
+		errs = append(errs, fmt.Errorf("points is required"))
+	}
+	oriented := 0
+	for i, p := range m.Points {
+		switch len(p) {
+		case 3, 4:
+		case 7, 8:
+			oriented++
+			if p[3] == 0 && p[4] == 0 && p[5] == 0 && p[6] == 0 {
+				errs = append(errs, fmt.Errorf("point %d: orientation is zero", i))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("point %d must have 3 values, or 7 with an orientation, plus an optional delay, got %d", i, len(p)))
+			continue
+		}
+		if len(p) == 4 || len(p) == 8 {
+			if delay := p[len(p)-1]; delay <= 0 {
+				errs = append(errs, fmt.Errorf("point %d: delay must be positive, got %v", i, delay))
+			}
+		}
+	}
+	if oriented > 0 && oriented < len(m.Points) {
+		errs = append(errs, fmt.Errorf("either all points or none must have an orientation"))
+	}
+	if oriented > 0 && m.Heading != nil {
+		errs = append(errs, fmt.Errorf("points with an orientation cannot have a heading"))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *WaypointsMission) Waypoints() ([][]float64, time.Duration) {
+	return m.Points, seconds(m.Interval)
+}
+
+// LissajousMission traces x = A sin(a t + phase), y = B sin(b t) around
+// center, where a and b are the number of cycles per period on each axis.
+type LissajousMission struct {
+	missionBase
+	Center []float64 `json:"center"`
+	// Amplitude is [A, B].
+	Amplitude []float64 `json:"amplitude"`
+	// Frequency is [a, b].
+	Frequency []float64 `json:"frequency"`
+	// Phase is the phase of the x axis in radians.
+	Phase    float64 `json:"phase"`
+	Altitude float64 `json:"altitude"`
+	// Period is the time in seconds for the curve to close.
+	Period  float64 `json:"period"`
+	Samples int     `json:"samples"`
+}
+
+func (m *LissajousMission) validate() error {
+	return errors.Join(
+		checkPoint("center", m.Center, 2),
+		checkPoint("amplitude", m.Amplitude, 2),
+		checkPoint("frequency", m.Frequency, 2),
+		required("amplitude", m.Amplitude),
+		required("frequency", m.Frequency),
+		checkPositive("period", m.Period),
+		checkSamples(float64(m.Samples), m.Samples),
+	)
+}
+
+func (m *LissajousMission) Waypoints() ([][]float64, time.Duration) {
+	cx, cy := pointOr(m.Center, 0), pointOr(m.Center, 1)
+	waypoints := make([][]float64, m.Samples)
+	for i, t := range Linspace(0, 2*math.Pi, m.Samples+1)[:m.Samples] {
+		waypoints[i] = []float64{
+			cx + m.Amplitude[0]*math.Sin(m.Frequency[0]*t+m.Phase),
+			cy + m.Amplitude[1]*math.Sin(m.Frequency[1]*t),
+			m.Altitude,
+		}
+	}
+	return waypoints, seconds(m.Period / float64(m.Samples))
+}
+
+// FigureEightMission traces a lemniscate of Gerono, Size wide on each side of
+// center along x and half as wide along y.
+type FigureEightMission struct {
+	missionBase
+	Center   []float64 `json:"center"`
+	Size     float64   `json:"size"`
+	Altitude float64   `json:"altitude"`
+	// Period is the time in seconds for one figure eight.
+	Period  float64 `json:"period"`
+	Samples int     `json:"samples"`
+}
+
+func (m *FigureEightMission) validate() error {
+	return errors.Join(
+		checkPoint("center", m.Center, 2),
+		checkPositive("size", m.Size),
+		checkPositive("period", m.Period),
+		checkSamples(float64(m.Samples), m.Samples),
+	)
+}
+
+func (m *FigureEightMission) Waypoints() ([][]float64, time.Duration) {
+	cx, cy := pointOr(m.Center, 0), pointOr(m.Center, 1)
+	waypoints := make([][]float64, m.Samples)
+	for i, t := range Linspace(0, 2*math.Pi, m.Samples+1)[:m.Samples] {
+		waypoints[i] = []float64{cx + m.Size*math.Sin(t), cy + m.Size*math.Sin(t)*math.Cos(t), m.Altitude}
+	}
+	return waypoints, seconds(m.Period / float64(m.Samples))
+}
+
+// HoverMission holds a position, republishing it at Rate.
+type HoverMission struct {
+	missionBase
+	Position []float64 `json:"position"`
+	// Duration is the hover time in seconds.
+	Duration float64 `json:"duration"`
+	// Rate is the number of waypoints published per second.
+	Rate float64 `json:"rate"`
+}
+
+func (m *HoverMission) validate() error {
+	return errors.Join(
+		checkPoint("position", m.Position, 3),
+		checkPositive("duration", m.Duration),
+		checkPositive("rate", m.Rate),
+		checkSamples(m.Duration*m.Rate, 1),
+	)
+}
+
+func (m *HoverMission) Waypoints() ([][]float64, time.Duration) {
+	waypoints := make([][]float64, int(math.Ceil(m.Duration*m.Rate)))
+	for i := range waypoints {
+		waypoints[i] = m.Position
+	}
+	return waypoints, seconds(1 / m.Rate)
+}
+
+// SpiralMission circles center with a radius and altitude that change
+// linearly from start to end, a flat spiral or a helix.
+type SpiralMission struct {
+	missionBase
+	Center        []float64 `json:"center"`
+	StartRadius   float64   `json:"start_radius"`
+	EndRadius     float64   `json:"end_radius"`
+	StartAltitude float64   `json:"start_altitude"`
+	EndAltitude   float64   `json:"end_altitude"`
+	Turns         float64   `json:"turns"`
+	// Direction is "ccw", counter-clockwise seen from above, or "cw".
+	Direction string `json:"direction"`
+	// Period is the time in seconds for one turn.
+	Period         float64 `json:"period"`
+	SamplesPerTurn int     `json:"samples_per_turn"`
+}
+
+func (m *SpiralMission) validate() error {
+	var errs []error
+	if m.StartRadius < 0 || m.EndRadius < 0 || m.StartRadius == m.EndRadius && m.StartRadius == 0 {
+		errs = append(errs, fmt.Errorf("radii must not be negative or both zero, got %v and %v", m.StartRadius, m.EndRadius))
+	}
+	return errors.Join(append(errs,
+		checkPoint("center", m.Center, 2),
+		checkPositive("turns", m.Turns),
+		checkPositive("period", m.Period),
+		checkDirection(m.Direction),
+		checkSamples(float64(m.SamplesPerTurn)*m.Turns+1, m.SamplesPerTurn),
+	)...)
+}
+
+func (m *SpiralMission) Waypoints() ([][]float64, time.Duration) {
+	cx, cy := pointOr(m.Center, 0), pointOr(m.Center, 1)
+	sign := 1.0
+	if m.Direction == "cw" {
+		sign = -1
+	}
+	n := int(math.Ceil(float64(m.SamplesPerTurn)*m.Turns)) + 1
+	angles := Linspace(0, 2*math.Pi*m.Turns, n)
+	radii := Linspace(m.StartRadius, m.EndRadius, n)
+	altitudes := Linspace(m.StartAltitude, m.EndAltitude, n)
+	waypoints := make([][]float64, n)
+	for i, t := range angles {
+		waypoints[i] = []float64{cx + radii[i]*math.Cos(sign*t), cy + radii[i]*math.Sin(sign*t), altitudes[i]}
+	}
+	return waypoints, seconds(m.Period / float64(m.SamplesPerTurn))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// pointOr is p[i], or 0 when p is unset.
+func pointOr(p []float64, i int) float64 {
+	if p == nil {
+		return 0
+	}
+	return p[i]
+}
+
+func checkPoint(name string, p []float64, n int) error {
+	if p != nil && len(p) != n {
+		return fmt.Errorf("%s must have %d values, got %d", name, n, len(p))
+	}
+	return nil
+}
+
+func required(name string, p []float64) error {
+	if p == nil {
+		return fmt.Errorf("%s is required", name)
+	}
+	return nil
+}
+
+func checkPositive(name string, v float64) error {
+	if !(v > 0) || math.IsInf(v, 0) {
+		return fmt.Errorf("%s must be positive, got %v", name, v)
+	}
+	return nil
+}
+
+func checkDirection(direction string) error {
+	if direction != "ccw" && direction != "cw" {
+		return fmt.Errorf("direction must be ccw or cw, got %q", direction)
+	}
+	return nil
+}
+
+// checkSamples checks the sampling parameter and the total waypoints it gives.
+func checkSamples(total float64, samples int) error {
+	if samples <= 0 {
+		return fmt.Errorf("samples must be positive, got %d", samples)
+	}
+	if total > maxMissionSamples {
+		return fmt.Errorf("mission has %.0f waypoints, more than the limit of %d", math.Ceil(total), maxMissionSamples)
+	}
+	return nil
+}
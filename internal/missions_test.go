@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestParseMission(t *testing.T) {
+	tests := []struct {
+		spec     string
+		kind     string
+		n        int
+		interval time.Duration
+		first    []float64
+	}{
+		{``, "orbit", 100, 10 * time.Millisecond, []float64{1, 0, 1}},
+		{`{"type": "orbit", "center": [1, 1], "radius": 2, "period": 10, "altitude": 3, "revolutions": 2, "samples": 50}`,
+			"orbit", 100, 200 * time.Millisecond, []float64{3, 1, 3}},
+		{`{"type": "line", "from": [0, 0, 0], "to": [4, 0, 2], "duration": 2, "samples": 5}`,
+			"line", 5, 400 * time.Millisecond, []float64{0, 0, 0}},
+		{`{"type": "waypoints", "points": [[0, 0, 1], [1, 0, 1, 500]], "interval": 0.5}`,
+			"waypoints", 2, 500 * time.Millisecond, []float64{0, 0, 1}},
+		{`{"type": "lissajous", "amplitude": [2, 1], "frequency": [1, 2], "period": 4, "samples": 40}`,
+			"lissajous", 40, 100 * time.Millisecond, []float64{2, 0, 1}},
+		{`{"type": "figure_eight", "center": [0, 5], "size": 3, "period": 2, "samples": 20}`,
+			"figure_eight", 20, 100 * time.Millisecond, []float64{0, 5, 1}},
+		{`{"type": "hover", "position": [1, 2, 3], "duration": 2, "rate": 5}`,
+			"hover", 10, 200 * time.Millisecond, []float64{1, 2, 3}},
+		{`{"type": "spiral", "start_radius": 0, "end_radius": 2, "turns": 2, "start_altitude": 0, "end_altitude": 4, "samples_per_turn": 10}`,
+			"spiral", 21, 500 * time.Millisecond, []float64{0, 0, 0}},
+	}
+	for _, test := range tests {
+		mission, err := ParseMission([]byte(test.spec))
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+		waypoints, interval := mission.Waypoints()
+		if mission.kind() != test.kind || len(waypoints) != test.n || interval != test.interval {
+			t.Errorf("%s: got %s with %d waypoints every %v", test.spec, mission.kind(), len(waypoints), interval)
+			continue
+		}
+		if !floatsEqual(waypoints[0][:3], test.first) {
+			t.Errorf("%s: first waypoint %v; want %v", test.spec, waypoints[0], test.first)
+		}
+	}
+
+	line, _ := ParseMission([]byte(`{"type": "line", "from": [0, 0, 0], "to": [4, 0, 2], "samples": 5}`))
+	waypoints, _ := line.Waypoints()
+	if !floatsEqual(waypoints[4], []float64{4, 0, 2}) {
+		t.Errorf("line ends at %v", waypoints[4])
+	}
+	spiral, _ := ParseMission([]byte(`{"type": "spiral", "start_radius": 1, "end_radius": 3, "turns": 1, "end_altitude": 2, "samples_per_turn": 4}`))
+	waypoints, _ = spiral.Waypoints()
+	if last := waypoints[len(waypoints)-1]; !floatsEqual(last, []float64{3, 0, 2}) {
+		t.Errorf("spiral ends at %v", last)
+	}
+	cw, _ := ParseMission([]byte(`{"type": "orbit", "direction": "cw", "samples": 4}`))
+	waypoints, _ = cw.Waypoints()
+	if math.Abs(waypoints[1][1]+1) > 1e-9 {
+		t.Errorf("clockwise orbit goes through %v after a quarter turn", waypoints[1])
+	}
+}
+
+func TestParseMissionErrors(t *testing.T) {
+	tests := map[string]string{
+		`{"type": "teleport"}`:                                   "unknown mission type",
+		`{}`:                                                     "unknown mission type",
+		`{"type": "orbit", "radius": -1}`:                        "radius must be positive",
+		`{"type": "orbit", "speed": 3}`:                          "unknown field",
+		`{"type": "orbit", "direction": "up"}`:                   "direction",
+		`{"type": "orbit", "revolutions": 1e9}`:                  "more than the limit",
+		`{"type": "line", "from": [0, 0, 0]}`:                    "to is required",
+		`{"type": "waypoints"}`:                                  "points is required",
+		`{"type": "waypoints", "points": [[0, 0]]}`:              "point 0",
+		`{"type": "lissajous", "amplitude": [1]}`:                "amplitude must have 2 values",
+		`{"type": "hover", "rate": 0}`:                           "rate must be positive",
+		`{"type": "spiral", "start_radius": 0, "end_radius": 0}`: "radii",
+		`{"type": "orbit",`:                                      "unable to decode",
+	}
+	for spec, want := range tests {
+		_, err := ParseMission([]byte(spec))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v; want an error containing %q", spec, err, want)
+		}
+	}
+}
+
+// missionRequest sends a mission request and decodes the reply.
+func missionRequest(t *testing.T, s *Server, subject, data string) MissionReply {
+	t.Helper()
+	msg, err := s.NATS.Request(subject, []byte(data), 2*time.Second)
+	if err != nil {
+		t.Fatalf("Request %s: %v", subject, err)
+	}
+	var reply MissionReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+// nextMissionStatus waits for the next status event in state.
+func nextMissionStatus(t *testing.T, sub *nats.Subscription, state MissionState) MissionStatus {
+	t.Helper()
+	for {
+		msg, err := sub.NextMsg(2 * time.Second)
+		if err != nil {
+			t.Fatalf("waiting for a %s mission: %v", state, err)
+		}
+		var status MissionStatus
+		if err := json.Unmarshal(msg.Data, &status); err != nil {
+			t.Fatal(err)
+		}
+		if status.State == state {
+			return status
+		}
+	}
+}
+
+func TestMissionRequestReply(t *testing.T) {
+	s, _ := newTestServer(t)
+	reply := missionRequest(t, s, "meshcat.mission.drone1", `{"type": "hover", "position": [0, 0, 1], "duration": 0.1, "rate": 10}`)
+	if reply.Error != "" || reply.Mission == nil || reply.Mission.ID == "" || reply.Mission.Path != "drone1" || reply.Mission.Waypoints != 1 {
+		t.Errorf("got %+v", reply)
+	}
+	reply = missionRequest(t, s, "meshcat.mission.drone1", `{"type": "orbit", "radius": 0}`)
+	if reply.Mission != nil || reply.Error != "invalid orbit mission: radius must be positive, got 0" {
+		t.Errorf("got %+v", reply)
+	}
+	reply = missionRequest(t, s, "meshcat.mission.control.nope", `{"action": "cancel"}`)
+	if reply.Error != "no mission nope" {
+		t.Errorf("got %+v", reply)
+	}
+}
+
+func TestMissionLifecycle(t *testing.T) {
+	s, _ := newTestServer(t)
+	events, err := s.NATS.SubscribeSync("meshcat.mission.status.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A short mission runs to completion, reporting its progress.
+	reply := missionRequest(t, s, "meshcat.mission.drone1", `{"type": "line", "from": [0, 0, 0], "to": [1, 0, 0], "duration": 0.1, "samples": 10}`)
+	if reply.Mission == nil {
+		t.Fatalf("submit: %+v", reply)
+	}
+	nextMissionStatus(t, events, MissionRunning)
+	if done := nextMissionStatus(t, events, MissionCompleted); done.ID != reply.Mission.ID || done.Waypoint != 10 {
+		t.Errorf("completed %+v", done)
+	}
+
+	// A long one is paused, resumed and cancelled.
+	reply = missionRequest(t, s, "meshcat.mission.drone2", `{"type": "hover", "duration": 60, "rate": 50}`)
+	if reply.Mission == nil {
+		t.Fatalf("submit: %+v", reply)
+	}
+	control := "meshcat.mission.control." + reply.Mission.ID
+	nextMissionStatus(t, events, MissionRunning)
+	paused := missionRequest(t, s, control, `{"action": "pause"}`)
+	if paused.Error != "" || paused.Mission.State != MissionPaused {
+		t.Fatalf("pause: %+v", paused)
+	}
+	time.Sleep(100 * time.Millisecond)
+	status := missionRequest(t, s, control, `{"action": "status"}`)
+	if status.Mission.Waypoint > paused.Mission.Waypoint+1 {
+		t.Errorf("paused mission advanced from %d to %d waypoints", paused.Mission.Waypoint, status.Mission.Waypoint)
+	}
+	if resumed := missionRequest(t, s, control, `{"action": "resume"}`); resumed.Mission.State != MissionRunning {
+		t.Errorf("resume: %+v", resumed)
+	}
+	if bad := missionRequest(t, s, control, `{"action": "land"}`); bad.Error == "" {
+		t.Errorf("unknown action: %+v", bad)
+	}
+	if cancelled := missionRequest(t, s, control, `{"action": "cancel"}`); cancelled.Mission.State != MissionCancelled {
+		t.Errorf("cancel: %+v", cancelled)
+	}
+	nextMissionStatus(t, events, MissionCancelled)
+	waitFor(t, func() bool {
+		return missionRequest(t, s, control, `{"action": "status"}`).Error == "no mission "+reply.Mission.ID
+	})
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/friend0/transformations"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// MQTTConfig configures compatibility with MQTT publishers connected through
+// NATS's MQTT support. NATS maps the topic `meshcat/transformations/drone1`
+// to the subject `meshcat.transformations.drone1`, so MQTT messages reach the
+// same subscriptions as NATS ones.
+type MQTTConfig struct {
+	// Compat restores the scene from MQTT retained messages at startup.
+	Compat bool `env:"MESHCAT_MQTT_COMPAT" flag:"mqtt-compat" desc:"restore the scene from MQTT retained messages at startup" yaml:"compat" toml:"compat"`
+	// RetainedStream is the JetStream stream NATS keeps retained messages in.
+	RetainedStream string `env:"MESHCAT_MQTT_RETAINED_STREAM" yaml:"retained_stream" toml:"retained_stream"`
+}
+
+func DefaultMQTTConfig() MQTTConfig {
+	return MQTTConfig{RetainedStream: "$MQTT_rmsgs"}
+}
+
+func (cfg MQTTConfig) Validate() error {
+	if cfg.Compat && cfg.RetainedStream == "" {
+		return fmt.Errorf("MQTT compatibility needs the retained message stream")
+	}
+	return nil
+}
+
+// mqttRetainedSubjectPrefix prefixes the subjects of retained messages in
+// the retained stream, followed by the NATS subject they were published on.
+const mqttRetainedSubjectPrefix = "$MQTT.rmsgs."
+
+// mqttRetainedMsg is how NATS stores a retained message.
+type mqttRetainedMsg struct {
+	Subject string `json:"subject"`
+	Topic   string `json:"topic"`
+	Msg     []byte `json:"msg"`
+}
+
+// restoreRetained applies the retained messages published on meshcat topics,
+// so the scene shows the last pose of vehicles that retain their state even
+// when nothing was persisted.
+func (s *Server) restoreRetained(ctx context.Context, cfg MQTTConfig) error {
+	js, err := jetstream.New(s.NATS)
+	if err != nil {
+		return err
+	}
+	stream, err := js.Stream(ctx, cfg.RetainedStream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		// No MQTT client has connected yet.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open retained messages: %v", err)
+	}
+	info, err := stream.Info(ctx, jetstream.WithSubjectFilter(mqttRetainedSubjectPrefix+"meshcat.>"))
+	if err != nil {
+		return fmt.Errorf("unable to list retained messages: %v", err)
+	}
+	restored := 0
+	for subject := range info.State.Subjects {
+		raw, err := stream.GetLastMsgForSubject(ctx, subject)
+		if err != nil {
+			return fmt.Errorf("unable to read retained message %s: %v", subject, err)
+		}
+		var rm mqttRetainedMsg
+		if err := json.Unmarshal(raw.Data, &rm); err != nil {
+			s.Logger.Warn("invalid retained message", "subsystem", "mqtt", "subject", subject, "error", err)
+			continue
+		}
+		if err := s.applySubject(rm.Subject, rm.Msg); err != nil {
+			s.Logger.Warn("unable to restore retained message", "subsystem", "mqtt", "topic", rm.Topic, "error", err)
+			continue
+		}
+		restored++
+	}
+	s.Logger.Info("restored retained messages", "subsystem", "mqtt", "stream", cfg.RetainedStream, "messages", restored)
+	return nil
+}
+
+// decodeTransform accepts a TransformationCommand as JSON, or the compact
+// forms MQTT devices send: a JSON array or comma or space separated floats.
+// The number of values decides their meaning:
+//
+//	3   x y z
+//	6   x y z roll pitch yaw
+//	7   x y z qx qy qz qw
+//	16  a 4x4 matrix
+func decodeTransform(data []byte) (TransformationCommand, error) {
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, "{") {
+		return NewTransformation(data)
+	}
+	var values []float64
+	if strings.HasPrefix(text, "[") {
+		if err := json.Unmarshal([]byte(text), &values); err != nil {
+			return TransformationCommand{}, fmt.Errorf("unable to decode transform array: %v", err)
+		}
+	} else {
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+		for _, field := range fields {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return TransformationCommand{}, fmt.Errorf("unable to decode transform value %q", field)
+			}
+			values = append(values, v)
+		}
+	}
+
+	switch len(values) {
+	case 16:
+		return TransformationCommand{Matrix4: values}, nil
+	case 3:
+		return TransformationCommand{Translation: values, Rotation: []float64{0, 0, 0, 1}}, nil
+	case 6:
+		rotation, err := transformations.EulerToQuaternion(([3]float64)(values[3:]))
+		if err != nil {
+			return TransformationCommand{}, fmt.Errorf("unable to convert euler angles to quaternion: %v", err)
+		}
+		return TransformationCommand{Translation: values[:3], Rotation: rotation}, nil
+	case 7:
+		rotation, err := normalizeQuaternion(values[3:])
+		if err != nil {
+			return TransformationCommand{}, err
+		}
+		return TransformationCommand{Translation: values[:3], Rotation: rotation}, nil
+	default:
+		return TransformationCommand{}, fmt.Errorf("expected 3, 6, 7 or 16 transform values, got %d", len(values))
+	}
+}
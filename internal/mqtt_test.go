@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestDecodeTransform(t *testing.T) {
+	tests := []struct {
+		payload     string
+		translation []float64
+		rotation    []float64
+	}{
+		{`{"translation": [1, 2, 3]}`, []float64{1, 2, 3}, []float64{0, 0, 0, 1}},
+		{`[1, 2, 3]`, []float64{1, 2, 3}, []float64{0, 0, 0, 1}},
+		{"1,2,3,0,0,0,2", []float64{1, 2, 3}, []float64{0, 0, 0, 1}},
+		{" 1 2 3 0 0 1 0\n", []float64{1, 2, 3}, []float64{0, 0, 1, 0}},
+	}
+	for _, test := range tests {
+		got, err := decodeTransform([]byte(test.payload))
+		if err != nil {
+			t.Errorf("%q: %v", test.payload, err)
+			continue
+		}
+		if !floatsEqual(got.Translation, test.translation) || !floatsEqual(got.Rotation, test.rotation) {
+			t.Errorf("%q: got translation %v rotation %v", test.payload, got.Translation, got.Rotation)
+		}
+	}
+
+	matrix, err := decodeTransform([]byte("1,0,0,0,0,1,0,0,0,0,1,0,4,5,6,1"))
+	if err != nil || len(matrix.Matrix4) != 16 || matrix.Matrix4[12] != 4 {
+		t.Errorf("matrix: got %v, %v", matrix.Matrix4, err)
+	}
+	euler, err := decodeTransform([]byte("0,0,0,0,0,1.5"))
+	if err != nil || len(euler.Rotation) != 4 {
+		t.Errorf("euler: got %v, %v", euler.Rotation, err)
+	}
+
+	for _, payload := range []string{"", "1,2", "1,2,x", "0,0,0,0,0,0,0", "[1, 2"} {
+		if _, err := decodeTransform([]byte(payload)); err == nil {
+			t.Errorf("%q: expected an error", payload)
+		}
+	}
+}
+
+func floatsEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSubjectPath(t *testing.T) {
+	tests := map[string]string{
+		"meshcat.transformations.drone1.body":   "drone1/body",
+		"meshcat.transformations.drone1//body":  "drone1.body",
+		"meshcat.transformations.fleet.v1//2.x": "fleet/v1.2/x",
+	}
+	for subject, want := range tests {
+		if got := subjectPath(subject, "meshcat.transformations."); got != want {
+			t.Errorf("subjectPath(%q) = %q; want %q", subject, got, want)
+		}
+	}
+}
+
+// mqttPublish publishes a retained QoS 1 message with a minimal MQTT 3.1.1
+// client and waits for the broker to acknowledge it.
+func mqttPublish(t *testing.T, addr, topic string, payload []byte) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial MQTT: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	str := func(s string) []byte {
+		return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+	}
+	packet := func(header byte, body []byte) []byte {
+		out := []byte{header}
+		for n := len(body); ; {
+			b := byte(n % 128)
+			if n /= 128; n > 0 {
+				b |= 0x80
+			}
+			out = append(out, b)
+			if n == 0 {
+				break
+			}
+		}
+		return append(out, body...)
+	}
+
+	connect := append(str("MQTT"), 4, 0x02, 0, 30)
+	connect = append(connect, str("meshcat-test")...)
+	if _, err := conn.Write(packet(0x10, connect)); err != nil {
+		t.Fatal(err)
+	}
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil || connack[0] != 0x20 || connack[3] != 0 {
+		t.Fatalf("CONNACK %v, %v", connack, err)
+	}
+
+	// PUBLISH with QoS 1 and the retain flag, packet id 1.
+	publish := append(str(topic), 0, 1)
+	publish = append(publish, payload...)
+	if _, err := conn.Write(packet(0x33, publish)); err != nil {
+		t.Fatal(err)
+	}
+	puback := make([]byte, 4)
+	if _, err := io.ReadFull(conn, puback); err != nil || puback[0] != 0x40 {
+		t.Fatalf("PUBACK %v, %v", puback, err)
+	}
+	conn.Write([]byte{0xe0, 0})
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestMQTTRetainedPoseRestoresScene(t *testing.T) {
+	storeDir := t.TempDir()
+	mqttPort := freePort(t)
+	configure := func(cfg *Config) {
+		cfg.NATS.Embedded.StoreDir = storeDir
+		cfg.NATS.Embedded.MQTTPort = mqttPort
+		cfg.MQTT.Compat = true
+	}
+	s, _ := newTestServer(t, configure)
+	addr := "127.0.0.1:" + strconv.Itoa(mqttPort)
+	mqttPublish(t, addr, "meshcat/transformations/drone1/body", []byte("1,2,3,0,0,0,1"))
+
+	// The live message reaches the scene through the ordinary subscription.
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Scene.Len() < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s.Scene.Len() != 1 {
+		t.Fatalf("MQTT pose did not reach the scene")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	// Without scene persistence, the restarted server restores the retained pose.
+	restarted, _ := newTestServer(t, configure)
+	snapshot := restarted.Scene.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Path != "/drone1/body" {
+		t.Fatalf("restored %+v; want the retained pose of drone1/body", snapshot)
+	}
+	var cmd SetTransformationCommand
+	if err := msgpack.Unmarshal(snapshot[0].Data, &cmd); err != nil {
+		t.Fatal(err)
+	}
+	if !floatsEqual(cmd.Object.Translation, []float64{1, 2, 3}) {
+		t.Errorf("restored translation %v", cmd.Object.Translation)
+	}
+}
@@ -1,10 +1,8 @@
 package internal
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math"
 	"strconv"
 	"strings"
@@ -16,46 +14,43 @@ import (
 )
 
 func (s *Server) NATSSubscriptions() error {
-	// todo: track subscriptions so we can cleanup
-	_, err := s.urlSubscription()
-	if err != nil {
-		return err
-	}
-
-	// todo: not able to write objects to the browser directly via websocket,
-	// right now we tell the browser to fetch the file from the server,
-	// and for some reason that works. Suspect issue with serialization/deserialization pipeline from nats -> msgpack -> ws
-	// somewhat lower priority for now, given that we're still able to load objects. Will be much more flexible if we can load the objects directly.
-
-	// Manage requests to add mesh objects
-	_, err = s.setObjectSubscription()
-	if err != nil {
-		return err
-	}
-
-	// Add stock geometry objects, like boxes, spheres, etc.
-	_, err = s.setGeometrySubscription()
-	if err != nil {
-		return err
-	}
-
-	_, err = s.setTransformationSubscription()
-	if err != nil {
-		return err
+	subscriptions := []func() (*nats.Subscription, error){
+		s.urlSubscription,
+		// todo: not able to write objects to the browser directly via websocket,
+		// right now we tell the browser to fetch the file from the server,
+		// and for some reason that works. Suspect issue with serialization/deserialization pipeline from nats -> msgpack -> ws
+		// somewhat lower priority for now, given that we're still able to load objects. Will be much more flexible if we can load the objects directly.
+
+		// Manage requests to add mesh objects
+		s.setObjectSubscription,
+		// Add stock geometry objects, like boxes, spheres, etc.
+		s.setGeometrySubscription,
+		s.setTransformationSubscription,
+		s.missionSubscription,
+		s.missionControlSubscription,
+		s.propertySubscription,
+		s.delete,
+		s.rosSubscription,
+		s.controlSubscription,
+		s.clockSubscription,
+		s.recordingSubscription,
+		s.playbackSubscription,
+		s.playbackControlSubscription,
 	}
-
-	_, err = s.missionSubscription()
-	if err != nil {
-		return err
-	}
-
-	_, err = s.delete()
-	if err != nil {
-		return err
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	for _, subscribe := range subscriptions {
+		sub, err := subscribe()
+		if err != nil {
+			return err
+		}
+		if sub != nil {
+			s.subs = append(s.subs, &subscription{sub: sub, subscribe: subscribe})
+		}
 	}
 
 	s.NATS.Flush()
-	log.Printf("Listening on [%s]", "meshcat")
+	s.Logger.Info("listening for meshcat commands", "subsystem", "nats", "subscriptions", len(s.subs))
 	return nil
 }
 
@@ -68,18 +63,18 @@ var MeshcatCommands = map[string]bool{
 }
 
 func (s *Server) urlSubscription() (*nats.Subscription, error) {
-	sub, err := s.NATS.QueueSubscribe("meshcat.url", "MESHCAT_URL_Q", func(msg *nats.Msg) {
+	sub, err := s.NATS.QueueSubscribe("meshcat.url", "MESHCAT_URL_Q", s.observed(func(msg *nats.Msg) {
 		b, err := msgpack.Marshal(&msg)
 		if err != nil {
-			s.Logger.Error(fmt.Sprintf("error encoding message: %v", err))
+			s.natsLogger(msg).Error("unable to encode message", "error", err)
 		}
 		err = s.Hub.Write(b)
 		if err != nil {
-			s.Logger.Error(fmt.Sprintf("error writing to web socket %v", err))
+			s.natsLogger(msg).Error("unable to write to viewers", "error", err)
 		}
-	})
+	}))
 	if err != nil {
-		s.Logger.Error(fmt.Sprintf("error creating NATS subscription: %v", err))
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.url", "error", err)
 	}
 	return sub, err
 }
@@ -99,23 +94,25 @@ type SetFromServer struct {
 
 // SetObjectSubscription handler
 func (s *Server) setObjectSubscription() (*nats.Subscription, error) {
-	sub, err := s.NATS.Subscribe("meshcat.objects", func(msg *nats.Msg) {
-		s.Logger.Info(fmt.Sprintf("Received meshcat message from NATS `%s` on subject `%s`", string(msg.Data), strings.Split(msg.Subject, ".")[2:]))
-		path := strings.Join(strings.Split(string(msg.Subject), ".")[2:], "/")
-		log.Printf("Received meshcat message from NATS: %s", string(msg.Data))
+	sub, err := s.NATS.Subscribe("meshcat.objects", s.observed(func(msg *nats.Msg) {
+		logger := s.natsLogger(msg)
 
 		// let's say for now the message has the form "object_name path positionx positiony positionz"
 		cmd := strings.Split(string(msg.Data), " ")
+		if len(cmd) < 5 {
+			s.Metrics.decodeFailed(msg)
+			logger.Warn("expected `object_name path x y z`", "data", string(msg.Data))
+			return
+		}
 		object_name, path, x, y, z := cmd[0], cmd[1], cmd[2], cmd[3], cmd[4]
 		fx, fy, fz, err := ParseFloats(x, y, z)
 		if err != nil {
-			s.Logger.Info(fmt.Sprintf("error processing position input in the command message %s", msg.Data))
+			s.Metrics.decodeFailed(msg)
+			logger.Warn("invalid position", "data", string(msg.Data), "error", err)
 			return
 		}
 
-		var buf bytes.Buffer
-		enc := msgpack.NewEncoder(&buf)
-		err = enc.Encode(SetFromServer{
+		err = s.apply(SetFromServer{
 			Object: SetFromServerMetadata{
 				ResourceName: object_name,
 				Path:         path,
@@ -129,19 +126,11 @@ func (s *Server) setObjectSubscription() (*nats.Subscription, error) {
 			},
 		})
 		if err != nil {
-			s.Logger.Error(fmt.Sprintf("unable to build `SetFromServer` object: %v", err))
-			return
-		}
-
-		// Forward the message to the WebSocket server
-		err = s.Hub.Write(buf.Bytes())
-		if err != nil {
-			s.Logger.Error(fmt.Sprintf("error writing to web socket %v", err))
+			s.commandFailed(msg, path, err)
 		}
-		buf.Reset()
-	})
+	}))
 	if err != nil {
-		log.Fatalf("Error subscribing to NATS subject: %v", err)
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.objects", "error", err)
 	}
 	return sub, err
 }
@@ -154,87 +143,15 @@ type AddObject struct {
 
 // SetObject handler
 func (s *Server) setGeometrySubscription() (*nats.Subscription, error) {
-	sub, err := s.NATS.Subscribe("meshcat.geometries", func(msg *nats.Msg) {
-		// shape := strings.Split(string(msg.Subject), ".")[2]
-		shape := ""
-		// todo: check here to see if the shape is available
-		var buf bytes.Buffer
-		enc := msgpack.NewEncoder(&buf)
-		log.Printf("Received meshcat message from NATS: %s: shape %s", string(msg.Data), shape)
-
-		// let's say for now the message has the form "object_name.path.positionx.positiony.positionz"
-		// todo: command parsing for Geometry message data
-		// based on the message type at the given path, parse the atrtibutes for the particular geometry
-
-		// let's say for now the message has the form "object_name path positionx positiony positionz"
-		if shape == "box" {
-			box := Box{}
-			err := json.Unmarshal(msg.Data, &box)
-			if err != nil {
-				s.Logger.Info(fmt.Sprintf("error processing add object request %v", err))
-				return
-			}
-			box.init_element()
-			obj := Objectify(&box)
-			err = enc.Encode(SetObject{
-				Object: obj,
-				Command: Command{
-					Type: "set_object",
-					Path: "environment/box_geometries",
-				},
-			})
-			if err != nil {
-				s.Logger.Info(fmt.Sprintf("error processing add object request %v", err))
-			}
-		} else if shape == "sphere" {
-			sphere := Sphere{}
-			err := json.Unmarshal(msg.Data, &sphere)
-			if err != nil {
-				s.Logger.Info(fmt.Sprintf("error processing add object request %v", err))
-				return
-			}
-			sphere.init_element()
-			s.Logger.Info(fmt.Sprintf("sphere: %#v", sphere))
-			obj := Objectify(&sphere)
-			err = enc.Encode(SetObject{
-				Object: obj,
-				Command: Command{
-					Type: "set_object",
-					Path: "environment/sphere_geometries",
-				},
-			})
-			if err != nil {
-				s.Logger.Info(fmt.Sprintf("error processing add object request %v", err))
-			}
-		} else {
-			var geom GenericGeom
-			err := json.Unmarshal(msg.Data, &geom)
-			if err != nil {
-				s.Logger.Info(fmt.Sprintf("error processing add object request %v", err))
-			}
-			geom.init_element()
-			obj := Objectify(geom)
-			err = enc.Encode(SetObject{
-				Object: obj,
-				Command: Command{
-					Type: "set_object",
-					Path: fmt.Sprintf("environment/%v", "geometries"),
-				},
-			})
-			if err != nil {
-				s.Logger.Info(fmt.Sprintf("error encoding generaic add object request %v", err))
-			}
-
+	sub, err := s.NATS.Subscribe("meshcat.geometries", s.observed(func(msg *nats.Msg) {
+		// todo: let the subject choose the path, like meshcat.transformations
+		path := "environment/geometries"
+		if err := s.applyObject(path, msg.Data); err != nil {
+			s.commandFailed(msg, path, err)
 		}
-		// Forward the message to the WebSocket server
-		err := s.Hub.Write(buf.Bytes())
-		if err != nil {
-			s.Logger.Error(fmt.Sprintf("error writing to web socket %v", err))
-		}
-		buf.Reset()
-	})
+	}))
 	if err != nil {
-		log.Fatalf("Error subscribing to NATS subject: %v", err)
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.geometries", "error", err)
 	}
 	return sub, err
 }
@@ -289,7 +206,12 @@ func NewTransformation(data []byte) (transformation_matrix TransformationCommand
 	if err != nil {
 		return transformation_matrix, fmt.Errorf("unable to unmarshal transformation matrix: %v", err)
 	}
+	return normalizeTransformation(transformation_matrix)
+}
 
+// normalizeTransformation fills in the default rotation and converts euler
+// angles to a quaternion.
+func normalizeTransformation(transformation_matrix TransformationCommand) (_ TransformationCommand, err error) {
 	// check if Matrix4 is already specified, in which case, just return the result
 	if transformation_matrix.Matrix4 != nil && len(transformation_matrix.Matrix4) == 16 {
 		for _, v := range transformation_matrix.Matrix4 {
@@ -311,8 +233,14 @@ func NewTransformation(data []byte) (transformation_matrix TransformationCommand
 			return transformation_matrix, fmt.Errorf("unable to convert euler angles to quaternion: %v", err)
 		}
 	} else if len(rotation) == 4 {
-		// determine if the quaternion is valid, and normalized
-		rotation = transformations.NewQuaternionFromSlice(rotation)
+		// Publishers rarely send exactly unit quaternions, e.g. after a float32
+		// round trip, so any quaternion that has a direction is normalized.
+		rotation, err = normalizeQuaternion(rotation)
+		if err != nil {
+			return transformation_matrix, err
+		}
+	} else {
+		return transformation_matrix, fmt.Errorf("rotation must be 3 euler angles or a quaternion, got %d values", len(rotation))
 	}
 	transformation_matrix.Rotation = rotation
 
@@ -320,57 +248,30 @@ func NewTransformation(data []byte) (transformation_matrix TransformationCommand
 	return transformation_matrix, nil
 }
 
-// SetObject handler
-func (s *Server) setTransformationSubscription() (*nats.Subscription, error) {
-	sub, err := s.NATS.Subscribe("meshcat.transformations.>", func(msg *nats.Msg) {
-		s.Logger.Info(fmt.Sprintf("Received meshcat message from NATS `%s` on subject `%s`", string(msg.Data), strings.Split(msg.Subject, ".")[2:]))
-		path := strings.Join(strings.Split(string(msg.Subject), ".")[2:], "/")
-
-		var buf bytes.Buffer
-		enc := msgpack.NewEncoder(&buf)
-
-		transformation_matrix, err := NewTransformation(msg.Data)
-		if err != nil {
-			s.Logger.Error(fmt.Sprintf("unable to build `TransformationCommand` object: %v", err))
-			return
-		}
-
-		s.Logger.Info(fmt.Sprintf("transformation matrix: %v", transformation_matrix))
-		err = enc.Encode(SetTransformationCommand{
-			Object: transformation_matrix,
-			Command: Command{
-				Type: "set_transform",
-				Path: path,
-			},
-		})
-		if err != nil {
-			log.Printf("error sending msg: %v", err)
-		}
-
-		// Forward the message to the WebSocket server
-		err = s.Hub.Write(buf.Bytes())
-		if err != nil {
-			s.Logger.Error(fmt.Sprintf("error writing to web socket %v", err))
-		}
-		buf.Reset()
-	})
-	if err != nil {
-		log.Fatalf("Error subscribing to NATS subject: %v", err)
+// normalizeQuaternion scales an [x, y, z, w] quaternion to unit length, for
+// publishers that do not send exactly normalized rotations. Only zero and
+// non-finite quaternions are rejected.
+func normalizeQuaternion(q []float64) ([]float64, error) {
+	norm := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3])
+	if norm == 0 {
+		return nil, fmt.Errorf("quaternion %v is zero", q)
 	}
-	return sub, err
+	if math.IsNaN(norm) || math.IsInf(norm, 0) {
+		return nil, fmt.Errorf("quaternion %v is not finite", q)
+	}
+	return []float64{q[0] / norm, q[1] / norm, q[2] / norm, q[3] / norm}, nil
 }
 
-func (s *Server) missionSubscription() (*nats.Subscription, error) {
-	sub, err := s.NATS.Subscribe("meshcat.mission.>", func(msg *nats.Msg) {
-		path := []string{"meshcat.transformations"}
-		path = append(path, strings.Join(strings.Split(string(msg.Subject), ".")[2:], "."))
-		full_path := strings.Join(path, ".")
-
-		s.Logger.Info(fmt.Sprintf("Received meshcat message from NATS: %s on path %s", string(msg.Data), path))
-		s.Q.Add(MissionWork{Conn: s.NATS, Path: full_path, Type: "orbit", Radius: 1, Omega: 1})
-	})
+// SetObject handler
+func (s *Server) setTransformationSubscription() (*nats.Subscription, error) {
+	sub, err := s.NATS.Subscribe("meshcat.transformations.>", s.observed(func(msg *nats.Msg) {
+		path := subjectPath(msg.Subject, "meshcat.transformations.")
+		if err := s.applyTransform(path, msg.Data); err != nil {
+			s.commandFailed(msg, path, err)
+		}
+	}))
 	if err != nil {
-		log.Fatalf("Error subscribing to NATS subject: %v", err)
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.transformations.>", "error", err)
 	}
 	return sub, err
 }
@@ -391,6 +292,70 @@ func ParseFloats(x, y, z string) (fx, fy, fz float64, err error) {
 	return fx, fy, fz, err
 }
 
+// propertySubscription sets a property of the object at the path named by
+// the subject, e.g. `meshcat.properties.drone.1` with
+// `{"property": "visible", "value": false}`.
+func (s *Server) propertySubscription() (*nats.Subscription, error) {
+	sub, err := s.NATS.Subscribe("meshcat.properties.>", s.observed(func(msg *nats.Msg) {
+		path := subjectPath(msg.Subject, "meshcat.properties.")
+		if err := s.applyProperty(path, msg.Data); err != nil {
+			s.commandFailed(msg, path, err)
+		}
+	}))
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.properties.>", "error", err)
+	}
+	return sub, err
+}
+
+// delete removes the object at the path named by the subject, e.g.
+// `meshcat.delete.drone.1`, and everything below it.
 func (s *Server) delete() (*nats.Subscription, error) {
-	return nil, nil
+	sub, err := s.NATS.Subscribe("meshcat.delete.>", s.observed(func(msg *nats.Msg) {
+		path := subjectPath(msg.Subject, "meshcat.delete.")
+		if err := s.applyDelete(path); err != nil {
+			s.commandFailed(msg, path, err)
+		}
+	}))
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.delete.>", "error", err)
+	}
+	return sub, err
+}
+
+// subjectPath maps the subject tokens after prefix to a scene path, e.g.
+// `meshcat.transformations.drone.1` to `drone/1`. NATS turns a `.` in an MQTT
+// topic into `//`, which maps back to a `.` in the path.
+func subjectPath(subject, prefix string) string {
+	tokens := strings.Split(strings.TrimPrefix(subject, prefix), ".")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(token, "//", ".")
+	}
+	return strings.Join(tokens, "/")
+}
+
+// pathSubject is the subject for path below prefix, the inverse of subjectPath.
+func pathSubject(prefix, path string) string {
+	tokens := strings.Split(strings.Trim(path, "/"), "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(token, ".", "//")
+	}
+	return prefix + strings.Join(tokens, ".")
+}
+
+// applySubject applies a command addressed by its subject, for messages that
+// do not arrive on a subscription, such as MQTT retained messages.
+func (s *Server) applySubject(subject string, data []byte) error {
+	switch {
+	case subject == "meshcat.geometries":
+		return s.applyObject("environment/geometries", data)
+	case strings.HasPrefix(subject, "meshcat.transformations."):
+		return s.applyTransform(subjectPath(subject, "meshcat.transformations."), data)
+	case strings.HasPrefix(subject, "meshcat.properties."):
+		return s.applyProperty(subjectPath(subject, "meshcat.properties."), data)
+	case strings.HasPrefix(subject, rosSubjectPrefix):
+		return s.applyROS(subject, data)
+	default:
+		return invalidCommand("no scene command is published on %s", subject)
+	}
 }
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nats-io/nats.go"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type LinkState string
+
+const (
+	LinkConnected    LinkState = "connected"
+	LinkDisconnected LinkState = "disconnected"
+	LinkClosed       LinkState = "closed"
+)
+
+// statusPath is the scene path of the link status label.
+const statusPath = statusRoot + "/nats"
+
+// LinkStatus describes the server's connection to NATS, i.e. whether
+// telemetry can currently reach the viewers.
+type LinkStatus struct {
+	State      LinkState `json:"state" msgpack:"state"`
+	Since      time.Time `json:"since" msgpack:"since"`
+	URL        string    `json:"url,omitempty" msgpack:"url,omitempty"`
+	Reconnects uint64    `json:"reconnects" msgpack:"reconnects"`
+	LastError  string    `json:"last_error,omitempty" msgpack:"last_error,omitempty"`
+	// Message is a short human readable summary for an on-screen indicator.
+	Message string `json:"message" msgpack:"message"`
+}
+
+type linkMonitor struct {
+	mu     sync.RWMutex
+	status LinkStatus
+}
+
+func (lm *linkMonitor) get() LinkStatus {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.status
+}
+
+func (lm *linkMonitor) update(f func(*LinkStatus)) LinkStatus {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	f(&lm.status)
+	return lm.status
+}
+
+// subscription is a tracked NATS subscription together with the function
+// that creates it, so it can be re-established after a reconnect.
+type subscription struct {
+	sub       *nats.Subscription
+	subscribe func() (*nats.Subscription, error)
+}
+
+// LinkStatus returns the current state of the NATS connection.
+func (s *Server) LinkStatus() LinkStatus {
+	return s.link.get()
+}
+
+// natsOptions configures reconnect buffering and the connection lifecycle handlers.
+func (s *Server) natsOptions(cfg NATSConfig) []nats.Option {
+	return []nats.Option{
+		nats.MaxReconnects(cfg.MaxReconnects),
+		nats.ReconnectWait(cfg.ReconnectWait),
+		nats.ReconnectBufSize(cfg.ReconnectBufSize),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			s.setLinkState(LinkDisconnected, err, "telemetry link lost")
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			s.link.update(func(ls *LinkStatus) { ls.Reconnects++ })
+			s.setLinkState(LinkConnected, nil, "telemetry link restored")
+			go s.verifySubscriptions()
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			s.setLinkState(LinkClosed, nc.LastError(), "telemetry link closed")
+		}),
+		nats.ErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
+			subject := ""
+			if sub != nil {
+				subject = sub.Subject
+			}
+			s.Logger.Error("NATS error", "subsystem", "nats", "subject", subject, "error", err)
+			s.link.update(func(ls *LinkStatus) { ls.LastError = err.Error() })
+		}),
+	}
+}
+
+// setLinkState records a connection state change and tells the viewers about it.
+func (s *Server) setLinkState(state LinkState, err error, message string) {
+	status := s.link.update(func(ls *LinkStatus) {
+		ls.State = state
+		ls.Since = time.Now()
+		ls.Message = message
+		if err != nil {
+			ls.LastError = err.Error()
+		}
+		if s.NATS != nil {
+			ls.URL = s.NATS.ConnectedUrlRedacted()
+		}
+	})
+	s.Logger.Info(message, "subsystem", "nats", "state", state, "error", err)
+	if s.Hub == nil {
+		return
+	}
+	b, encErr := encodeStatus(status)
+	if encErr != nil {
+		s.Logger.Error("unable to encode link status", "subsystem", "nats", "error", encErr)
+		return
+	}
+	s.Hub.WriteCommand("set_object", b)
+}
+
+func encodeStatus(status LinkStatus) ([]byte, error) {
+	var buf bytes.Buffer
+	text := "NATS " + string(status.State)
+	if status.State != LinkConnected {
+		text += ": " + status.Message
+	}
+	err := msgpack.NewEncoder(&buf).Encode(SetStatus{
+		Command: Command{Type: "set_object", Path: statusPath},
+		Object:  newStatusLabel(text, 1.5, status),
+	})
+	return buf.Bytes(), err
+}
+
+// verifySubscriptions re-creates subscriptions the reconnect invalidated and
+// round-trips to the server to confirm it has registered interest again.
+func (s *Server) verifySubscriptions() {
+	s.subsMu.Lock()
+	for _, tracked := range s.subs {
+		if tracked.sub.IsValid() {
+			continue
+		}
+		sub, err := tracked.subscribe()
+		if err != nil {
+			s.Logger.Error("unable to re-establish subscription", "subsystem", "nats", "subject", tracked.sub.Subject, "error", err)
+			continue
+		}
+		s.Logger.Info("re-established subscription", "subsystem", "nats", "subject", sub.Subject)
+		tracked.sub = sub
+	}
+	s.subsMu.Unlock()
+	if err := s.NATS.FlushTimeout(5 * time.Second); err != nil {
+		s.Logger.Error("unable to verify subscriptions after reconnect", "subsystem", "nats", "error", err)
+	}
+}
+
+// StatusHandler reports the NATS link state and number of connected viewers.
+func (s *Server) StatusHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"nats":    s.LinkStatus(),
+			"viewers": s.Hub.Clients(),
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	MinPlaybackSpeed = 0.1
+	MaxPlaybackSpeed = 10.0
+)
+
+type PlaybackState string
+
+const (
+	PlaybackQueued   PlaybackState = "queued"
+	PlaybackPlaying  PlaybackState = "playing"
+	PlaybackPaused   PlaybackState = "paused"
+	PlaybackFinished PlaybackState = "finished"
+	PlaybackStopped  PlaybackState = "stopped"
+)
+
+// PlaybackStatus describes a playback. Times are seconds into the recording.
+type PlaybackStatus struct {
+	ID       string        `json:"id"`
+	Session  string        `json:"session"`
+	File     string        `json:"file"`
+	State    PlaybackState `json:"state"`
+	Position float64       `json:"position"`
+	Duration float64       `json:"duration"`
+	Speed    float64       `json:"speed"`
+	// Frame is the number of frames played so far, out of Frames.
+	Frame  int `json:"frame"`
+	Frames int `json:"frames"`
+}
+
+func validPlaybackSpeed(speed float64) error {
+	if speed < MinPlaybackSpeed || speed > MaxPlaybackSpeed {
+		return fmt.Errorf("playback speed must be between %vx and %vx, got %v", MinPlaybackSpeed, MaxPlaybackSpeed, speed)
+	}
+	return nil
+}
+
+type playbackControl struct {
+	Action string  `json:"action"`
+	T      float64 `json:"t,omitempty"`
+	Speed  float64 `json:"speed,omitempty"`
+
+	reply chan playbackReply
+}
+
+type playbackReply struct {
+	status PlaybackStatus
+	err    error
+}
+
+var (
+	errPlaybackDone   = errors.New("playback has ended")
+	errPlaybackQueued = errors.New("playback has not started yet")
+)
+
+// Playback replays the viewer commands of a recording into the scene, like
+// live commands. It is a Work item, so it runs on the WorkQueue beside live
+// missions, and is controlled through Control while it runs.
+type Playback struct {
+	// scene is the live scene state, which dispatch applies frames to before
+	// forwarding them to the viewers.
+	scene    *SceneState
+	dispatch func(key SceneKey, data []byte) error
+	clock    *Clock
+	// initial is the scene the recording started from.
+	initial  []SceneEntry
+	frames   []Frame
+	controls chan playbackControl
+	// started is closed once a worker picks the playback up.
+	started chan struct{}
+	done    chan struct{}
+	// onUpdate is told about state changes, e.g. to publish them.
+	onUpdate func(PlaybackStatus)
+
+	mu     sync.Mutex
+	status PlaybackStatus
+}
+
+// LoadPlayback reads the viewer commands of a recording file, to be played on
+// clock into scene through dispatch. A final frame cut short by a crash is
+// ignored, and so are the server's status labels, which describe the server
+// at the time rather than the scene.
+func LoadPlayback(id, name string, speed float64, scene *SceneState, dispatch func(SceneKey, []byte) error, clock *Clock, onUpdate func(PlaybackStatus)) (*Playback, error) {
+	if err := validPlaybackSpeed(speed); err != nil {
+		return nil, err
+	}
+	header, recorded, err := ReadRecording(name)
+	if err != nil {
+		return nil, err
+	}
+	var frames []Frame
+	for _, frame := range recorded {
+		if frame.Source != SourceViewer || statusFrame(frame) {
+			continue
+		}
+		if _, err := SceneKeyOf(frame.Subject, frame.Data); err != nil {
+			continue
+		}
+		frames = append(frames, frame)
+	}
+	p := &Playback{
+		scene:    scene,
+		dispatch: dispatch,
+		clock:    clock,
+		initial:  header.Scene,
+		frames:   frames,
+		controls: make(chan playbackControl),
+		started:  make(chan struct{}),
+		done:     make(chan struct{}),
+		onUpdate: onUpdate,
+		status: PlaybackStatus{
+			ID:      id,
+			Session: header.Session,
+			File:    name,
+			State:   PlaybackQueued,
+			Speed:   speed,
+			Frames:  len(frames),
+		},
+	}
+	if len(frames) > 0 {
+		p.status.Duration = frames[len(frames)-1].Offset.Seconds()
+	}
+	return p, nil
+}
+
+// Status returns the last reported state of the playback.
+func (p *Playback) Status() PlaybackStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+func (p *Playback) update(f func(*PlaybackStatus)) PlaybackStatus {
+	p.mu.Lock()
+	f(&p.status)
+	status := p.status
+	p.mu.Unlock()
+	if p.onUpdate != nil {
+		p.onUpdate(status)
+	}
+	return status
+}
+
+// Control sends a pause, resume, step, seek, speed, stop or status request to
+// the running playback and returns its state afterwards. A playback still
+// queued only answers status requests.
+func (p *Playback) Control(ctx context.Context, c playbackControl) (PlaybackStatus, error) {
+	select {
+	case <-p.started:
+	default:
+		if c.Action == "status" {
+			return p.Status(), nil
+		}
+		return p.Status(), errPlaybackQueued
+	}
+	c.reply = make(chan playbackReply, 1)
+	select {
+	case p.controls <- c:
+	case <-p.done:
+		return p.Status(), errPlaybackDone
+	case <-ctx.Done():
+		return p.Status(), ctx.Err()
+	}
+	r := <-c.reply
+	return r.status, r.err
+}
+
+// playhead tracks the position in the recording: while playing it advances
+// at speed, relative to the clock, from where it was anchored.
+type playhead struct {
+	clock    *Clock
+	position time.Duration
+	anchor   time.Time
+	speed    float64
+	paused   bool
+}
+
+func (ph playhead) now() time.Duration {
+	if ph.paused {
+		return ph.position
+	}
+	return ph.position + time.Duration(float64(ph.clock.Now().Sub(ph.anchor))*ph.speed)
+}
+
+// at is the clock time the playhead reaches position.
+func (ph playhead) at(position time.Duration) time.Time {
+	return ph.anchor.Add(time.Duration(float64(position-ph.position) / ph.speed))
+}
+
+func (ph *playhead) set(position time.Duration) {
+	ph.position, ph.anchor = position, ph.clock.Now()
+}
+
+func (p *Playback) Do(ctx context.Context, results chan string) {
+	defer close(p.done)
+	close(p.started)
+	ph := playhead{clock: p.clock, speed: p.Status().Speed}
+	ph.set(0)
+	next := 0
+	p.update(func(ps *PlaybackStatus) { ps.State = PlaybackPlaying })
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	result := "Complete"
+loop:
+	for {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		var due <-chan time.Time
+		// changed wakes the playback to reschedule when the clock changes.
+		var changed <-chan struct{}
+		// A playback at its end finishes even when paused, so it does not
+		// hold a worker.
+		if next == len(p.frames) {
+			p.update(func(ps *PlaybackStatus) {
+				ps.State, ps.Frame, ps.Position = PlaybackFinished, next, ph.now().Seconds()
+			})
+			break
+		}
+		if !ph.paused {
+			var d time.Duration
+			var running bool
+			d, running, changed = p.clock.until(ph.at(p.frames[next].Offset))
+			if running {
+				timer.Reset(d)
+				due = timer.C
+			}
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			result = "Cancelled"
+			p.update(func(ps *PlaybackStatus) { ps.State = PlaybackStopped })
+			break loop
+		case <-due:
+			p.send(p.frames[next])
+			next++
+		case c := <-p.controls:
+			var err error
+			switch c.Action {
+			case "pause":
+				ph.set(ph.now())
+				ph.paused = true
+			case "resume":
+				ph.set(ph.now())
+				ph.paused = false
+			case "step":
+				// Stepping pauses and plays exactly one frame.
+				ph.paused = true
+				if next < len(p.frames) {
+					p.send(p.frames[next])
+					ph.set(p.frames[next].Offset)
+					next++
+				}
+			case "seek":
+				if c.T < 0 || c.T > p.Status().Duration {
+					err = fmt.Errorf("seek time must be between 0 and %vs, got %v", p.Status().Duration, c.T)
+					break
+				}
+				next = p.seek(time.Duration(c.T * float64(time.Second)))
+				ph.set(time.Duration(c.T * float64(time.Second)))
+			case "speed":
+				if err = validPlaybackSpeed(c.Speed); err == nil {
+					ph.set(ph.now())
+					ph.speed = c.Speed
+				}
+			case "stop":
+				result = "Cancelled"
+			case "status":
+			default:
+				err = fmt.Errorf("unknown playback action %q", c.Action)
+			}
+			state := PlaybackPlaying
+			if ph.paused {
+				state = PlaybackPaused
+			}
+			if c.Action == "stop" {
+				state = PlaybackStopped
+			}
+			status := p.update(func(ps *PlaybackStatus) {
+				ps.State, ps.Speed, ps.Frame, ps.Position = state, ph.speed, next, ph.now().Seconds()
+			})
+			c.reply <- playbackReply{status: status, err: err}
+			if state == PlaybackStopped {
+				break loop
+			}
+		}
+	}
+	report(results, result)
+}
+
+// drop reports a playback the queue shut down before running as stopped.
+func (p *Playback) drop() {
+	p.update(func(ps *PlaybackStatus) { ps.State = PlaybackStopped })
+	close(p.done)
+}
+
+func (p *Playback) send(frame Frame) {
+	// Frames were checked to decode when the playback was loaded.
+	key, _ := SceneKeyOf(frame.Subject, frame.Data)
+	p.dispatch(key, frame.Data)
+}
+
+// seek rebuilds the scene as it was at t, replaces the live scene with it and
+// returns the index of the first frame after t.
+func (p *Playback) seek(t time.Duration) int {
+	scene := NewSceneState()
+	scene.Reset(p.initial)
+	next := 0
+	for ; next < len(p.frames) && p.frames[next].Offset <= t; next++ {
+		key, _ := SceneKeyOf(p.frames[next].Subject, p.frames[next].Data)
+		scene.Apply(key, p.frames[next].Data)
+	}
+	for _, root := range sceneRoots(p.scene.Snapshot()) {
+		if clear, err := msgpack.Marshal(Delete{Command{Type: "delete", Path: root}}); err == nil {
+			p.dispatch(SceneKey{Type: "delete", Path: root}, clear)
+		}
+	}
+	for _, entry := range scene.Snapshot() {
+		p.dispatch(entry.SceneKey, entry.Data)
+	}
+	return next
+}
+
+// sceneRoots returns the outermost paths of entries, the ones to delete to
+// clear them all without touching the rest of the viewer's scene.
+func sceneRoots(entries []SceneEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	// Parents sort before their children.
+	sort.Strings(paths)
+	var roots []string
+next:
+	for _, path := range paths {
+		for _, root := range roots {
+			if under(path, root) {
+				continue next
+			}
+		}
+		roots = append(roots, path)
+	}
+	return roots
+}
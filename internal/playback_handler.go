@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+// PlaybackReply is the response to the playback requests.
+type PlaybackReply struct {
+	Playback *PlaybackStatus `json:"playback,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+type playbackRequest struct {
+	Session string `json:"session"`
+	// File defaults to the newest recording of Session.
+	File  string  `json:"file"`
+	Speed float64 `json:"speed"`
+}
+
+func playbackReplyOf(status PlaybackStatus, err error) PlaybackReply {
+	if err != nil {
+		return PlaybackReply{Playback: &status, Error: err.Error()}
+	}
+	return PlaybackReply{Playback: &status}
+}
+
+// StartPlayback queues a playback of a recording on the WorkQueue.
+func (s *Server) StartPlayback(req playbackRequest) (*Playback, error) {
+	if req.Speed == 0 {
+		req.Speed = 1
+	}
+	if req.File == "" {
+		infos, err := s.Recordings.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if info.Session == req.Session && !info.Active {
+				req.File = info.File
+				break
+			}
+		}
+	}
+	name, err := s.Recordings.Path(req.Session, req.File)
+	if err != nil {
+		return nil, err
+	}
+	id := nuid.Next()
+	p, err := LoadPlayback(id, name, req.Speed, s.Scene, s.dispatch, s.Clock, func(status PlaybackStatus) {
+		b, _ := json.Marshal(status)
+		s.NATS.Publish("meshcat.playback.status."+status.ID, b)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.status.File = filepath.Base(name)
+
+	s.playbacksMu.Lock()
+	if s.playbacks == nil {
+		s.playbacks = map[string]*Playback{}
+	}
+	s.playbacks[id] = p
+	s.playbacksMu.Unlock()
+	go func() {
+		<-p.done
+		s.playbacksMu.Lock()
+		delete(s.playbacks, id)
+		s.playbacksMu.Unlock()
+	}()
+
+	if err := s.Q.Add(p); err != nil {
+		close(p.done)
+		return nil, err
+	}
+	return p, nil
+}
+
+// playbackSubscription serves `meshcat.playback.start` requests.
+func (s *Server) playbackSubscription() (*nats.Subscription, error) {
+	sub, err := s.NATS.Subscribe("meshcat.playback.start", s.handlePlayback)
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.playback.start", "error", err)
+	}
+	return sub, err
+}
+
+// playbackControlSubscription serves the controls on
+// `meshcat.playback.control.<id>`; state changes are published on
+// `meshcat.playback.status.<id>`.
+func (s *Server) playbackControlSubscription() (*nats.Subscription, error) {
+	sub, err := s.NATS.Subscribe("meshcat.playback.control.*", s.handlePlayback)
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.playback.control.*", "error", err)
+	}
+	return sub, err
+}
+
+// handlePlayback replies with the state of the playback a request started or controlled.
+func (s *Server) handlePlayback(msg *nats.Msg) {
+	logger := s.natsLogger(msg)
+	var reply PlaybackReply
+	switch {
+	case msg.Subject == "meshcat.playback.start":
+		var req playbackRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			reply.Error = fmt.Sprintf("invalid playback request: %v", err)
+			break
+		}
+		p, err := s.StartPlayback(req)
+		if err != nil {
+			reply.Error = err.Error()
+			break
+		}
+		status := p.Status()
+		reply.Playback = &status
+		logger.Info("queued playback", "playback", status.ID, "session", status.Session, "file", status.File, "speed", status.Speed)
+	case strings.HasPrefix(msg.Subject, "meshcat.playback.control."):
+		id := strings.TrimPrefix(msg.Subject, "meshcat.playback.control.")
+		s.playbacksMu.Lock()
+		p := s.playbacks[id]
+		s.playbacksMu.Unlock()
+		if p == nil {
+			reply.Error = fmt.Sprintf("no playback %s", id)
+			break
+		}
+		var c playbackControl
+		if err := json.Unmarshal(msg.Data, &c); err != nil {
+			reply.Error = fmt.Sprintf("invalid playback control: %v", err)
+			break
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		reply = playbackReplyOf(p.Control(ctx, c))
+		cancel()
+	}
+	if reply.Error != "" {
+		logger.Warn("playback request failed", "error", reply.Error)
+	}
+	if msg.Reply == "" {
+		return
+	}
+	b, _ := json.Marshal(reply)
+	if err := msg.Respond(b); err != nil {
+		logger.Error("unable to reply", "error", err)
+	}
+}
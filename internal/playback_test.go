@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func writeRecording(t *testing.T, name string, frames []Frame) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	enc := msgpack.NewEncoder(f)
+	enc.Encode(RecordingHeader{Version: recordingVersion, Session: "test", Started: time.Now()})
+	for _, frame := range frames {
+		if err := enc.Encode(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func viewerFrame(t time.Duration, kind, path, value string) Frame {
+	data, _ := msgpack.Marshal(map[string]string{"type": kind, "path": path, "value": value})
+	return Frame{Offset: t, Source: SourceViewer, Subject: kind, Data: data}
+}
+
+func nextCommand(t *testing.T, send chan outbound) (kind, path, value string) {
+	t.Helper()
+	select {
+	case m := <-send:
+		var cmd map[string]string
+		msgpack.Unmarshal(m.data, &cmd)
+		return m.kind, cmd["path"], cmd["value"]
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a command")
+	}
+	return
+}
+
+func TestPlaybackControls(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.mcrec")
+	writeRecording(t, name, []Frame{
+		viewerFrame(0, "set_object", "/a", "a"),
+		{Offset: 5 * time.Millisecond, Source: SourceNATS, Subject: "meshcat.transformations.a"},
+		viewerFrame(10*time.Millisecond, "set_transform", "/a", "t1"),
+		// The server's status labels are not played back.
+		viewerFrame(20*time.Millisecond, "set_object", clockStatusPath, "clock"),
+		viewerFrame(20*time.Millisecond, "set_status", statusPath, "link"),
+		viewerFrame(5*time.Second, "set_transform", "/a", "t2"),
+		viewerFrame(6*time.Second, "set_object", "/b", "b"),
+	})
+	s := &Server{Hub: NewHub(), Scene: NewSceneState(), Logger: slog.Default()}
+	client := &Client{send: make(chan outbound, 16)}
+	s.Hub.Register(client)
+	// A live object the seek has to clear, along with what was played.
+	s.Scene.Apply(SceneKey{Type: "set_object", Path: "/live/robot"}, []byte("r"))
+
+	var updates []PlaybackState
+	p, err := LoadPlayback("p1", name, 1, s.Scene, s.dispatch, nil, func(ps PlaybackStatus) { updates = append(updates, ps.State) })
+	if err != nil {
+		t.Fatalf("LoadPlayback: %v", err)
+	}
+	if p.Status().Frames != 4 || p.Status().Duration != 6 {
+		t.Fatalf("status = %+v", p.Status())
+	}
+	if _, err := LoadPlayback("p2", name, 20, s.Scene, s.dispatch, nil, nil); err == nil {
+		t.Error("accepted a playback speed of 20x")
+	}
+
+	// A queued playback answers status requests without waiting for a worker.
+	ctx := context.Background()
+	if status, err := p.Control(ctx, playbackControl{Action: "status"}); err != nil || status.State != PlaybackQueued {
+		t.Errorf("queued status = %+v, %v", status, err)
+	}
+	if _, err := p.Control(ctx, playbackControl{Action: "pause"}); err != errPlaybackQueued {
+		t.Errorf("queued pause = %v", err)
+	}
+
+	results := make(chan string, 1)
+	go p.Do(context.Background(), results)
+	if kind, _, _ := nextCommand(t, client.send); kind != "set_object" {
+		t.Errorf("first command = %s", kind)
+	}
+	if _, _, value := nextCommand(t, client.send); value != "t1" {
+		t.Errorf("second command value = %s", value)
+	}
+
+	if status, err := p.Control(ctx, playbackControl{Action: "pause"}); err != nil || status.State != PlaybackPaused {
+		t.Fatalf("pause = %+v, %v", status, err)
+	}
+	if _, err := p.Control(ctx, playbackControl{Action: "speed", Speed: 0.01}); err == nil {
+		t.Error("accepted a playback speed of 0.01x")
+	}
+	// Seeking past t2 replaces the scene with its state at 5.5s.
+	if _, err := p.Control(ctx, playbackControl{Action: "seek", T: 5.5}); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	want := []string{"delete /a", "delete /live/robot", "set_object /a", "set_transform /a"}
+	for _, w := range want {
+		kind, path, _ := nextCommand(t, client.send)
+		if kind+" "+path != w {
+			t.Errorf("after seek got %s %s; want %s", kind, path, w)
+		}
+	}
+	status, err := p.Control(ctx, playbackControl{Action: "step"})
+	if err != nil || status.Frame != 4 || status.State != PlaybackPaused {
+		t.Fatalf("step = %+v, %v", status, err)
+	}
+	if _, path, _ := nextCommand(t, client.send); path != "/b" {
+		t.Errorf("stepped to %s; want /b", path)
+	}
+	// Paused on its last frame, the playback finishes rather than holding its worker.
+	if result := <-results; result != "Complete" {
+		t.Errorf("result = %s", result)
+	}
+	if updates[len(updates)-1] != PlaybackFinished {
+		t.Errorf("last update = %s", updates[len(updates)-1])
+	}
+	if _, err := p.Control(ctx, playbackControl{Action: "status"}); err != errPlaybackDone {
+		t.Errorf("control after finish = %v", err)
+	}
+	// The played frames went through the live scene state.
+	var got []string
+	for _, entry := range s.Scene.Snapshot() {
+		got = append(got, entry.Type+" "+entry.Path)
+	}
+	if want := []string{"set_object /a", "set_object /b", "set_transform /a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scene after playback = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/friend0/transformations"
+)
+
+// Profile times a mission by its path rather than its waypoint intervals:
+// the vehicle accelerates from rest to at most MaxVelocity, and comes back to
+// rest at the last waypoint.
+type Profile struct {
+	// Type is "trapezoidal", limiting acceleration, or "s_curve", also
+	// limiting jerk.
+	Type string `json:"type"`
+	// The limits, in m/s, m/s² and m/s³, left out are the vehicle's.
+	MaxVelocity     float64 `json:"max_velocity"`
+	MaxAcceleration float64 `json:"max_acceleration"`
+	MaxJerk         float64 `json:"max_jerk"`
+}
+
+// defaultProfile holds the limits of vehicles that set none, those of a
+// gently flown quadrotor.
+var defaultProfile = Profile{MaxVelocity: 3, MaxAcceleration: 2, MaxJerk: 5}
+
+func (p Profile) validate() error {
+	var errs []error
+	switch p.Type {
+	case "trapezoidal", "s_curve":
+	default:
+		errs = append(errs, fmt.Errorf("profile type must be trapezoidal or s_curve, got %q", p.Type))
+	}
+	return errors.Join(append(errs, checkLimits(p.MaxVelocity, p.MaxAcceleration, p.MaxJerk))...)
+}
+
+func checkLimits(velocity, acceleration, jerk float64) error {
+	var errs []error
+	for _, limit := range []struct {
+		name  string
+		value float64
+	}{{"max_velocity", velocity}, {"max_acceleration", acceleration}, {"max_jerk", jerk}} {
+		if limit.value < 0 || math.IsNaN(limit.value) || math.IsInf(limit.value, 0) {
+			errs = append(errs, fmt.Errorf("%s must be finite and not negative, got %v", limit.name, limit.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// VehicleConfig sets how missions fly, and the simulation drives, the vehicle
+// at a scene path.
+type VehicleConfig struct {
+	// Profile times the missions that set no profile, "" to keep their
+	// waypoint intervals.
+	Profile         string  `yaml:"profile" toml:"profile"`
+	MaxVelocity     float64 `yaml:"max_velocity" toml:"max_velocity"`
+	MaxAcceleration float64 `yaml:"max_acceleration" toml:"max_acceleration"`
+	MaxJerk         float64 `yaml:"max_jerk" toml:"max_jerk"`
+
+	// Model simulates the vehicle: "point_mass", "unicycle", "bicycle" or
+	// "quadrotor". The vehicle starts at rest at Position.
+	Model    string    `yaml:"model" toml:"model"`
+	Position []float64 `yaml:"position" toml:"position"`
+	// Wheelbase is the length of a bicycle in m, 1 by default.
+	Wheelbase float64 `yaml:"wheelbase" toml:"wheelbase"`
+	// Mass is the mass of a quadrotor in kg, 1 by default.
+	Mass float64 `yaml:"mass" toml:"mass"`
+}
+
+func validateVehicles(vehicles map[string]VehicleConfig) error {
+	paths := make([]string, 0, len(vehicles))
+	for path := range vehicles {
+		paths = append(paths, path)
+	}
+	// Sorted, so the errors come out in the same order every time.
+	sort.Strings(paths)
+	var errs []error
+	for _, path := range paths {
+		v := vehicles[path]
+		switch v.Profile {
+		case "", "trapezoidal", "s_curve":
+		default:
+			errs = append(errs, fmt.Errorf("vehicle %q: unknown profile %q, expected trapezoidal or s_curve", path, v.Profile))
+		}
+		if err := checkLimits(v.MaxVelocity, v.MaxAcceleration, v.MaxJerk); err != nil {
+			errs = append(errs, fmt.Errorf("vehicle %q: %w", path, err))
+		}
+		if _, ok := vehicleModels[v.Model]; !ok && v.Model != "" {
+			errs = append(errs, fmt.Errorf("vehicle %q: unknown model %q, expected %s", path, v.Model, simModelNames))
+		}
+		if v.Position != nil && len(v.Position) != 3 {
+			errs = append(errs, fmt.Errorf("vehicle %q: position must have 3 values, got %d", path, len(v.Position)))
+		}
+		if v.Wheelbase < 0 || v.Mass < 0 {
+			errs = append(errs, fmt.Errorf("vehicle %q: wheelbase and mass must not be negative", path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// vehicleProfile is the profile a mission flies the vehicle by: its own, or
+// the vehicle's, with the limits it leaves out taken from the vehicle.
+func vehicleProfile(p *Profile, v VehicleConfig) *Profile {
+	if p == nil {
+		if v.Profile == "" {
+			return nil
+		}
+		p = &Profile{Type: v.Profile}
+	}
+	resolved := *p
+	for _, limit := range []struct {
+		mission *float64
+		vehicle float64
+	}{
+		{&resolved.MaxVelocity, v.MaxVelocity},
+		{&resolved.MaxAcceleration, v.MaxAcceleration},
+		{&resolved.MaxJerk, v.MaxJerk},
+	} {
+		if *limit.mission == 0 {
+			*limit.mission = limit.vehicle
+		}
+	}
+	return &resolved
+}
+
+// profilePhase is a stretch of constant jerk, starting at accel.
+type profilePhase struct {
+	duration, accel, jerk float64
+}
+
+// motion is a rest-to-rest motion along length metres.
+type motion struct {
+	length float64
+	phases []profilePhase
+}
+
+// newMotion plans the fastest motion over length within the limits of p,
+// falling back to defaultProfile for the limits p leaves at 0.
+func newMotion(p Profile, length float64) motion {
+	v := limitOr(p.MaxVelocity, defaultProfile.MaxVelocity)
+	a := limitOr(p.MaxAcceleration, defaultProfile.MaxAcceleration)
+	m := motion{length: length}
+	if p.Type != "s_curve" {
+		// Too short to reach v, the vehicle turns back at the peak velocity.
+		v = math.Min(v, math.Sqrt(length*a))
+		accel := v / a
+		m.phases = []profilePhase{{accel, a, 0}, {(length - v*accel) / v, 0, 0}, {accel, -a, 0}}
+		return m
+	}
+	j := limitOr(p.MaxJerk, defaultProfile.MaxJerk)
+	// ramp is the time spent raising the acceleration to its peak while
+	// reaching velocity v, and accelDistance the distance covered doing so.
+	ramp := func(v float64) float64 { return math.Min(a/j, math.Sqrt(v/j)) }
+	accelDistance := func(v float64) float64 {
+		tj := ramp(v)
+		return v * (tj + v/(j*tj)) / 2
+	}
+	if 2*accelDistance(v) > length {
+		low, high := 0.0, v
+		for range 60 {
+			if mid := (low + high) / 2; 2*accelDistance(mid) > length {
+				high = mid
+			} else {
+				low = mid
+			}
+		}
+		v = low
+	}
+	tj := ramp(v)
+	peak := j * tj
+	hold := v/peak - tj
+	m.phases = []profilePhase{
+		{tj, 0, j}, {hold, peak, 0}, {tj, peak, -j},
+		{(length - 2*accelDistance(v)) / v, 0, 0},
+		{tj, 0, -j}, {hold, -peak, 0}, {tj, -peak, j},
+	}
+	return m
+}
+
+// limitOr is limit, or fallback when limit is unset.
+func limitOr(limit, fallback float64) float64 {
+	if limit > 0 {
+		return limit
+	}
+	return fallback
+}
+
+// duration is the time in seconds the motion takes.
+func (m motion) duration() float64 {
+	var d float64
+	for _, phase := range m.phases {
+		d += math.Max(phase.duration, 0)
+	}
+	return d
+}
+
+// distance is the distance covered t seconds into the motion.
+func (m motion) distance(t float64) float64 {
+	var s, v float64
+	for _, phase := range m.phases {
+		dt := math.Min(math.Max(phase.duration, 0), t)
+		s += v*dt + phase.accel*dt*dt/2 + phase.jerk*dt*dt*dt/6
+		v += phase.accel*dt + phase.jerk*dt*dt/2
+		if t -= dt; t <= 0 {
+			break
+		}
+	}
+	return math.Min(math.Max(s, 0), m.length)
+}
+
+// timeAt is the time in seconds at which the motion has covered s.
+func (m motion) timeAt(s float64) float64 {
+	low, high := 0.0, m.duration()
+	for range 60 {
+		if mid := (low + high) / 2; m.distance(mid) < s {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return high
+}
+
+// retimePoses times poses by the profile along the path through them,
+// resampling the path at rate. A path without length, like a hover, keeps its
+// timing.
+func retimePoses(poses []pose, p Profile, rate float64) []pose {
+	lengths := make([]float64, len(poses))
+	for i := 1; i < len(poses); i++ {
+		lengths[i] = lengths[i-1] + vectorNorm([]float64{
+			poses[i].position[0] - poses[i-1].position[0],
+			poses[i].position[1] - poses[i-1].position[1],
+			poses[i].position[2] - poses[i-1].position[2],
+		})
+	}
+	length := lengths[len(lengths)-1]
+	if length == 0 {
+		return poses
+	}
+	m := newMotion(p, length)
+	total := m.duration()
+	times := Resample(0, total, math.Min(rate, maxMissionSamples/total))
+	delay := seconds(total / float64(len(times)-1))
+	out := make([]pose, len(times))
+	segment := 0
+	for i, t := range times {
+		s := m.distance(t)
+		for segment+2 < len(poses) && lengths[segment+1] < s {
+			segment++
+		}
+		a, b := poses[segment], poses[segment+1]
+		var u float64
+		if d := lengths[segment+1] - lengths[segment]; d > 0 {
+			u = math.Min(math.Max((s-lengths[segment])/d, 0), 1)
+		}
+		out[i] = pose{position: make([]float64, 3), delay: delay}
+		for axis := range out[i].position {
+			out[i].position[axis] = a.position[axis] + u*(b.position[axis]-a.position[axis])
+		}
+		if a.rotation != nil {
+			out[i].rotation = transformations.Slerp(a.rotation, b.rotation, u)
+		}
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMotion(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  Profile
+		length   float64
+		duration float64
+	}{
+		// 2 s to reach 2 m/s over 2 m, 3 s cruising and 2 s to stop.
+		{"trapezoidal", Profile{Type: "trapezoidal", MaxVelocity: 2, MaxAcceleration: 1}, 10, 7},
+		// Too short to reach 2 m/s: 1 s each way, peaking at 1 m/s.
+		{"short trapezoidal", Profile{Type: "trapezoidal", MaxVelocity: 2, MaxAcceleration: 1}, 1, 2},
+		// 3 s to reach 2 m/s over 3 m, 7 s cruising and 3 s to stop.
+		{"s_curve", Profile{Type: "s_curve", MaxVelocity: 2, MaxAcceleration: 1, MaxJerk: 1}, 20, 13},
+		// Never reaching the acceleration limit: 2 s of rising and 2 s of
+		// falling acceleration each way, peaking at 1 m/s after 2 m.
+		{"short s_curve", Profile{Type: "s_curve", MaxVelocity: 2, MaxAcceleration: 4, MaxJerk: 0.25}, 4, 8},
+	}
+	for _, test := range tests {
+		m := newMotion(test.profile, test.length)
+		if d := m.duration(); math.Abs(d-test.duration) > 1e-6 {
+			t.Errorf("%s: takes %v s; want %v", test.name, d, test.duration)
+		}
+		if s := m.distance(m.duration()); math.Abs(s-test.length) > 1e-6 {
+			t.Errorf("%s: covers %v m; want %v", test.name, s, test.length)
+		}
+		// The velocity and acceleration, by finite differences, stay within the limits.
+		const dt = 1e-3
+		for t0 := dt; t0 < m.duration()-dt; t0 += 0.05 {
+			s0, s1, s2 := m.distance(t0-dt), m.distance(t0), m.distance(t0+dt)
+			if v := (s2 - s0) / (2 * dt); v > test.profile.MaxVelocity+1e-6 {
+				t.Errorf("%s: %v m/s at %v s", test.name, v, t0)
+			}
+			if a := (s0 - 2*s1 + s2) / (dt * dt); math.Abs(a) > test.profile.MaxAcceleration+1e-3 {
+				t.Errorf("%s: %v m/s² at %v s", test.name, a, t0)
+			}
+		}
+		if got := m.timeAt(test.length / 2); math.Abs(got-test.duration/2) > 1e-6 {
+			t.Errorf("%s: halfway after %v s; want %v", test.name, got, test.duration/2)
+		}
+	}
+}
+
+func TestMissionProfile(t *testing.T) {
+	spec := `{"type": "line", "from": [0, 0, 1], "to": [10, 0, 1], "samples": 3, "publish_rate": 10,
+		"profile": {"type": "trapezoidal", "max_velocity": 2, "max_acceleration": 1}}`
+	work := missionWork(t, spec)
+	if len(work.Waypoints) != 71 {
+		t.Fatalf("got %d poses", len(work.Waypoints))
+	}
+	if d := missionDuration(work.Waypoints, work.Interval).Seconds(); math.Abs(d-7) > 1e-6 {
+		t.Errorf("takes %v s", d)
+	}
+	// 2 m in after 2 s of acceleration, and at rest at the end.
+	if wp := work.Waypoints[20]; math.Abs(wp[0]-2) > 1e-6 {
+		t.Errorf("after 2 s at %v", wp)
+	}
+	if wp := work.Waypoints[70]; !floatsEqual(wp[:3], []float64{10, 0, 1}) {
+		t.Errorf("ends at %v", wp)
+	}
+
+	if _, err := ParseMission([]byte(`{"type": "orbit", "profile": {"type": "bang_bang"}}`)); err == nil || !strings.Contains(err.Error(), "profile type") {
+		t.Errorf("unknown profile: %v", err)
+	}
+	if _, err := ParseMission([]byte(`{"type": "orbit", "profile": {"type": "s_curve", "max_jerk": -1}}`)); err == nil || !strings.Contains(err.Error(), "max_jerk") {
+		t.Errorf("negative jerk: %v", err)
+	}
+}
+
+func TestVehicleProfile(t *testing.T) {
+	s, _ := newTestServer(t, func(cfg *Config) {
+		cfg.Vehicles = map[string]VehicleConfig{"drone1": {Profile: "trapezoidal", MaxVelocity: 20, MaxAcceleration: 100}}
+	})
+	// Durations include the step before the first pose, 1/60 s when profiled.
+	line := `{"type": "line", "from": [0, 0, 1], "to": [1, 0, 1], "duration": 0.3, "samples": 3}`
+	// The vehicle's profile times missions that set none: 0.1 s each way,
+	// peaking at 10 m/s.
+	if reply := missionRequest(t, s, "meshcat.mission.drone1", line); reply.Mission == nil || math.Abs(reply.Mission.Duration-(0.2+1.0/60)) > 1e-6 {
+		t.Errorf("drone1: %+v", reply)
+	}
+	// A mission's own limits take precedence: 0.05 s each way, peaking at 20 m/s.
+	fast := `{"type": "line", "from": [0, 0, 1], "to": [1, 0, 1], "samples": 3, "profile": {"type": "trapezoidal", "max_acceleration": 400}}`
+	if reply := missionRequest(t, s, "meshcat.mission.drone1", fast); reply.Mission == nil || math.Abs(reply.Mission.Duration-(0.1+1.0/60)) > 1e-6 {
+		t.Errorf("fast drone1: %+v", reply)
+	}
+	// Other vehicles keep the mission's own timing.
+	if reply := missionRequest(t, s, "meshcat.mission.drone2", line); reply.Mission == nil || math.Abs(reply.Mission.Duration-0.3) > 1e-6 {
+		t.Errorf("drone2: %+v", reply)
+	}
+}
+
+func TestValidateVehiclesOrder(t *testing.T) {
+	vehicles := map[string]VehicleConfig{
+		"drone2": {MaxJerk: -1, MaxVelocity: math.NaN()},
+		"drone1": {Profile: "bang_bang", MaxAcceleration: -1},
+	}
+	want := `vehicle "drone1": unknown profile "bang_bang", expected trapezoidal or s_curve
+vehicle "drone1": max_acceleration must be finite and not negative, got -1
+vehicle "drone2": max_velocity must be finite and not negative, got NaN
+max_jerk must be finite and not negative, got -1`
+	// Map order changes between runs; the errors must not.
+	for range 10 {
+		if err := validateVehicles(vehicles); err == nil || err.Error() != want {
+			t.Fatalf("validateVehicles = %v", err)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// RecordingConfig configures where session recordings are written.
+type RecordingConfig struct {
+	Dir string `env:"MESHCAT_RECORDING_DIR" flag:"recording-dir" desc:"directory session recordings are written to" yaml:"dir" toml:"dir"`
+	// FlushInterval bounds how much of a recording is lost if the server dies.
+	FlushInterval time.Duration `env:"MESHCAT_RECORDING_FLUSH_INTERVAL" yaml:"flush_interval" toml:"flush_interval"`
+}
+
+func DefaultRecordingConfig() RecordingConfig {
+	return RecordingConfig{
+		Dir:           "recordings",
+		FlushInterval: 250 * time.Millisecond,
+	}
+}
+
+func (cfg RecordingConfig) Validate() error {
+	if cfg.Dir == "" {
+		return errors.New("recording directory must not be empty")
+	}
+	if cfg.FlushInterval <= 0 {
+		return fmt.Errorf("recording flush interval must be positive, got %v", cfg.FlushInterval)
+	}
+	return nil
+}
+
+const (
+	recordingVersion = 1
+	recordingExt     = ".mcrec"
+
+	// SourceNATS marks a raw message received on a NATS subscription.
+	SourceNATS = "nats"
+	// SourceViewer marks a command sent to the viewers, Subject is its type.
+	SourceViewer = "viewer"
+)
+
+var sessionNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// RecordingHeader is the first msgpack document of a recording file.
+type RecordingHeader struct {
+	Version int       `msgpack:"version" json:"version"`
+	Session string    `msgpack:"session" json:"session"`
+	Started time.Time `msgpack:"started" json:"started"`
+	// Scene is the scene the recording starts from, so it can be shown
+	// without the server that recorded it.
+	Scene []SceneEntry `msgpack:"scene,omitempty" json:"scene,omitempty"`
+}
+
+// Frame is one recorded message. Offset is measured on the monotonic clock
+// from the start of the recording, so it is unaffected by wall clock jumps.
+type Frame struct {
+	Offset  time.Duration `msgpack:"t"`
+	Source  string        `msgpack:"src"`
+	Subject string        `msgpack:"subj"`
+	Data    []byte        `msgpack:"data"`
+}
+
+// RecordingInfo describes a recording file.
+type RecordingInfo struct {
+	Session string    `json:"session"`
+	File    string    `json:"file"`
+	Started time.Time `json:"started"`
+	Active  bool      `json:"active"`
+	Frames  uint64    `json:"frames,omitempty"`
+	Bytes   int64     `json:"bytes"`
+	// Error is the write error that stopped the recording from growing.
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder appends frames to a recording file. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	buf     *bufio.Writer
+	enc     *msgpack.Encoder
+	header  RecordingHeader
+	frames  uint64
+	err     error
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewRecorder creates a new recording for session under dir, flushing it to
+// disk every flushInterval. Unless it is nil, begin is called with the new
+// recorder before the header is written, and Record blocks until it returns
+// the scene the recording starts from.
+func NewRecorder(dir, session string, flushInterval time.Duration, begin func(*Recorder) []SceneEntry) (*Recorder, error) {
+	if !sessionNameRe.MatchString(session) {
+		return nil, fmt.Errorf("invalid session name %q: use up to 64 letters, digits, '-' or '_'", session)
+	}
+	started := time.Now()
+	if err := os.MkdirAll(filepath.Join(dir, session), 0o755); err != nil {
+		return nil, err
+	}
+	name := filepath.Join(dir, session, started.UTC().Format("20060102T150405.000Z")+recordingExt)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{
+		file:   file,
+		buf:    bufio.NewWriter(file),
+		header: RecordingHeader{Version: recordingVersion, Session: session, Started: started},
+		done:   make(chan struct{}),
+	}
+	r.enc = msgpack.NewEncoder(r.buf)
+	r.mu.Lock()
+	if begin != nil {
+		r.header.Scene = begin(r)
+	}
+	err = r.enc.Encode(r.header)
+	if err != nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.stopped.Add(1)
+	go r.flushLoop(flushInterval)
+	return r, nil
+}
+
+func (r *Recorder) flushLoop(interval time.Duration) {
+	defer r.stopped.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			if r.err == nil {
+				r.err = r.buf.Flush()
+			}
+			r.mu.Unlock()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Record appends a frame. After the first write error the recording stops
+// growing and the error is returned by Record and Close.
+func (r *Recorder) Record(source, subject string, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	// Taken under the lock, so offsets grow in the order frames are written.
+	offset := time.Since(r.header.Started)
+	r.err = r.enc.Encode(Frame{Offset: offset, Source: source, Subject: subject, Data: data})
+	if r.err == nil {
+		r.frames++
+	}
+	return r.err
+}
+
+// Info describes the recording in progress.
+func (r *Recorder) Info() RecordingInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := RecordingInfo{
+		Session: r.header.Session,
+		File:    filepath.Base(r.file.Name()),
+		Started: r.header.Started,
+		Active:  true,
+		Frames:  r.frames,
+	}
+	if r.err != nil {
+		info.Error = r.err.Error()
+	}
+	if fi, err := r.file.Stat(); err == nil {
+		info.Bytes = fi.Size() + int64(r.buf.Buffered())
+	}
+	return info
+}
+
+// Close flushes and closes the recording file.
+func (r *Recorder) Close() (RecordingInfo, error) {
+	close(r.done)
+	r.stopped.Wait()
+	info := r.Info()
+	info.Active = false
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.err
+	if err == nil {
+		err = r.buf.Flush()
+	}
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.err = os.ErrClosed
+	return info, err
+}
+
+// statusFrame reports whether f is one of the server's status labels, which
+// describe the server at the time rather than the scene.
+func statusFrame(f Frame) bool {
+	if f.Subject == "set_status" {
+		return true
+	}
+	key, err := SceneKeyOf(f.Subject, f.Data)
+	return err == nil && under(normalizePath(key.Path), statusRoot)
+}
+
+// RecordingReader reads the frames of a recording file in order.
+type RecordingReader struct {
+	Header RecordingHeader
+	dec    *msgpack.Decoder
+}
+
+func NewRecordingReader(r io.Reader) (*RecordingReader, error) {
+	rr := &RecordingReader{dec: msgpack.NewDecoder(bufio.NewReader(r))}
+	if err := rr.dec.Decode(&rr.Header); err != nil {
+		return nil, fmt.Errorf("unable to read recording header: %v", err)
+	}
+	if rr.Header.Version != recordingVersion {
+		return nil, fmt.Errorf("unsupported recording version %d", rr.Header.Version)
+	}
+	return rr, nil
+}
+
+// Next returns the next frame, or io.EOF at the end of the recording. A frame
+// cut short by a crash is reported as io.ErrUnexpectedEOF.
+func (rr *RecordingReader) Next() (Frame, error) {
+	var f Frame
+	err := rr.dec.Decode(&f)
+	return f, err
+}
+
+// ReadRecording reads the header and every frame of a recording file. A
+// final frame cut short by a crash is ignored.
+func ReadRecording(name string) (RecordingHeader, []Frame, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return RecordingHeader{}, nil, err
+	}
+	defer f.Close()
+	rr, err := NewRecordingReader(f)
+	if err != nil {
+		return RecordingHeader{}, nil, err
+	}
+	var frames []Frame
+	for {
+		frame, err := rr.Next()
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return rr.Header, frames, nil
+		}
+		if err != nil {
+			return rr.Header, nil, fmt.Errorf("unable to read frame %d: %v", len(frames), err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// Recordings manages the named session recordings of a server; at most one
+// recording is active at a time.
+type Recordings struct {
+	cfg    RecordingConfig
+	mu     sync.Mutex
+	active *Recorder
+	// attach is told about the active recorder, nil when recording stops.
+	attach func(*Recorder)
+	// scene returns the scene a new recording starts from, nil for none.
+	scene func() []SceneEntry
+}
+
+func NewRecordings(cfg RecordingConfig, attach func(*Recorder), scene func() []SceneEntry) *Recordings {
+	return &Recordings{cfg: cfg, attach: attach, scene: scene}
+}
+
+var errRecordingActive = errors.New("a recording is already in progress")
+var errNoRecording = errors.New("no recording in progress")
+
+// Start begins recording session.
+func (rs *Recordings) Start(session string) (RecordingInfo, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.active != nil {
+		return rs.active.Info(), errRecordingActive
+	}
+	r, err := NewRecorder(rs.cfg.Dir, session, rs.cfg.FlushInterval, func(r *Recorder) []SceneEntry {
+		// Attached before the snapshot is taken, every command ends up in the
+		// snapshot, the recording or both.
+		rs.attach(r)
+		if rs.scene == nil {
+			return nil
+		}
+		return rs.scene()
+	})
+	if err != nil {
+		rs.attach(nil)
+		return RecordingInfo{}, err
+	}
+	rs.active = r
+	return r.Info(), nil
+}
+
+// Stop ends the active recording.
+func (rs *Recordings) Stop() (RecordingInfo, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.active == nil {
+		return RecordingInfo{}, errNoRecording
+	}
+	rs.attach(nil)
+	info, err := rs.active.Close()
+	rs.active = nil
+	return info, err
+}
+
+// Active describes the active recording, if any.
+func (rs *Recordings) Active() (RecordingInfo, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.active == nil {
+		return RecordingInfo{}, false
+	}
+	return rs.active.Info(), true
+}
+
+// List returns the recordings on disk, newest first.
+func (rs *Recordings) List() ([]RecordingInfo, error) {
+	active, _ := rs.Active()
+	files, err := filepath.Glob(filepath.Join(rs.cfg.Dir, "*", "*"+recordingExt))
+	if err != nil {
+		return nil, err
+	}
+	infos := []RecordingInfo{}
+	for _, name := range files {
+		info := RecordingInfo{Session: filepath.Base(filepath.Dir(name)), File: filepath.Base(name)}
+		if fi, err := os.Stat(name); err == nil {
+			info.Bytes = fi.Size()
+		}
+		if f, err := os.Open(name); err == nil {
+			if rr, err := NewRecordingReader(f); err == nil {
+				info.Started = rr.Header.Started
+			}
+			f.Close()
+		}
+		if info.Session == active.Session && info.File == active.File {
+			info = active
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Started.After(infos[j].Started) })
+	return infos, nil
+}
+
+// Path resolves a recording file of session, refusing anything outside the recording directory.
+func (rs *Recordings) Path(session, file string) (string, error) {
+	if !sessionNameRe.MatchString(session) || !strings.HasSuffix(file, recordingExt) || filepath.Base(file) != file {
+		return "", fmt.Errorf("no recording %s/%s", session, file)
+	}
+	return filepath.Join(rs.cfg.Dir, session, file), nil
+}
+
+// Close stops the active recording, if any.
+func (rs *Recordings) Close() error {
+	if _, err := rs.Stop(); err != nil && err != errNoRecording {
+		return err
+	}
+	return nil
+}
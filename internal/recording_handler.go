@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nats-io/nats.go"
+)
+
+// RecordingReply is the response to the recording control requests.
+type RecordingReply struct {
+	Recording *RecordingInfo `json:"recording,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+type recordingRequest struct {
+	Session string `json:"session"`
+}
+
+// setRecorder attaches r to the hub and the NATS subscriptions.
+func (s *Server) setRecorder(r *Recorder) {
+	s.recorder.Store(r)
+	s.Hub.SetRecorder(r)
+}
+
+// observed wraps a subscription handler so the raw message is counted,
+// recorded and logged, sampled per subject, before it is handled.
+func (s *Server) observed(handler nats.MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		s.Metrics.natsMessage(msg)
+		if r := s.recorder.Load(); r != nil {
+			r.Record(SourceNATS, msg.Subject, msg.Data)
+		}
+		if ok, suppressed := s.logSampler.allow(msg.Subject); ok {
+			s.natsLogger(msg).Debug("received message", "bytes", len(msg.Data), "suppressed", suppressed)
+		}
+		handler(msg)
+	}
+}
+
+func recordingReply(info RecordingInfo, err error) RecordingReply {
+	if err != nil {
+		return RecordingReply{Error: err.Error()}
+	}
+	return RecordingReply{Recording: &info}
+}
+
+// recordingSubscription serves `meshcat.recording.start`, `.stop` and
+// `.status` requests. Start takes `{"session": "name"}` or the bare name.
+func (s *Server) recordingSubscription() (*nats.Subscription, error) {
+	sub, err := s.NATS.Subscribe("meshcat.recording.*", func(msg *nats.Msg) {
+		logger := s.natsLogger(msg)
+		var reply RecordingReply
+		switch action := strings.TrimPrefix(msg.Subject, "meshcat.recording."); action {
+		case "start":
+			var req recordingRequest
+			if err := json.Unmarshal(msg.Data, &req); err != nil {
+				req.Session = strings.TrimSpace(string(msg.Data))
+			}
+			reply = recordingReply(s.Recordings.Start(req.Session))
+		case "stop":
+			reply = recordingReply(s.Recordings.Stop())
+		case "status":
+			if info, ok := s.Recordings.Active(); ok {
+				reply.Recording = &info
+			}
+		default:
+			reply.Error = fmt.Sprintf("unknown recording request %q", action)
+		}
+		if reply.Error != "" {
+			logger.Warn("recording request failed", "error", reply.Error)
+		} else if reply.Recording != nil {
+			logger.Info("recording", "session", reply.Recording.Session, "file", reply.Recording.File, "active", reply.Recording.Active)
+		}
+		if msg.Reply == "" {
+			return
+		}
+		b, _ := json.Marshal(reply)
+		if err := msg.Respond(b); err != nil {
+			logger.Error("unable to reply", "error", err)
+		}
+	})
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.recording.*", "error", err)
+	}
+	return sub, err
+}
+
+func recordingStatus(err error) int {
+	switch {
+	case errors.Is(err, errRecordingActive):
+		return http.StatusConflict
+	case errors.Is(err, errNoRecording):
+		return http.StatusNotFound
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// StartRecordingHandler starts recording a session, e.g.
+// `POST /api/recordings {"session": "flight-12"}`.
+func (s *Server) StartRecordingHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req recordingRequest
+		if err := c.Bind(&req); err != nil {
+			return err
+		}
+		info, err := s.Recordings.Start(req.Session)
+		if err != nil {
+			return echo.NewHTTPError(recordingStatus(err), err.Error())
+		}
+		return c.JSON(http.StatusCreated, info)
+	}
+}
+
+// StopRecordingHandler stops the active recording.
+func (s *Server) StopRecordingHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		info, err := s.Recordings.Stop()
+		if err != nil {
+			return echo.NewHTTPError(recordingStatus(err), err.Error())
+		}
+		return c.JSON(http.StatusOK, info)
+	}
+}
+
+// ListRecordingsHandler lists the recordings on disk, newest first.
+func (s *Server) ListRecordingsHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		infos, err := s.Recordings.List()
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, infos)
+	}
+}
+
+// DownloadRecordingHandler serves a recording file for a bug report.
+func (s *Server) DownloadRecordingHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name, err := s.Recordings.Path(c.Param("session"), c.Param("file"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if _, err := os.Stat(name); err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, "no such recording")
+		}
+		return c.Attachment(name, c.Param("session")+"-"+c.Param("file"))
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecorderRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRecorder(dir, "flight-1", time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	r.Record(SourceNATS, "meshcat.transformations.drone1", []byte(`{"translation": [1, 2, 3]}`))
+	r.Record(SourceViewer, "set_transform", []byte{0x81})
+	info, err := r.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if info.Frames != 2 || info.Active {
+		t.Errorf("info = %+v", info)
+	}
+	if err := r.Record(SourceViewer, "set_transform", nil); err == nil {
+		t.Error("Record after Close succeeded")
+	}
+
+	f, err := os.Open(filepath.Join(dir, "flight-1", info.File))
+	if err != nil {
+		t.Fatalf("open recording: %v", err)
+	}
+	defer f.Close()
+	rr, err := NewRecordingReader(f)
+	if err != nil {
+		t.Fatalf("NewRecordingReader: %v", err)
+	}
+	if rr.Header.Session != "flight-1" {
+		t.Errorf("session = %q", rr.Header.Session)
+	}
+	var frames []Frame
+	for {
+		frame, err := rr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		frames = append(frames, frame)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("read %d frames; want 2", len(frames))
+	}
+	if frames[0].Source != SourceNATS || frames[0].Subject != "meshcat.transformations.drone1" || frames[1].Subject != "set_transform" {
+		t.Errorf("frames = %+v", frames)
+	}
+	if frames[1].Offset < frames[0].Offset {
+		t.Errorf("offsets not monotonic: %v, %v", frames[0].Offset, frames[1].Offset)
+	}
+}
+
+func TestRecordingsSessions(t *testing.T) {
+	var attached *Recorder
+	scene := []SceneEntry{{SceneKey: SceneKey{Type: "set_object", Path: "/a"}, Data: []byte("a")}}
+	rs := NewRecordings(RecordingConfig{Dir: t.TempDir(), FlushInterval: time.Second}, func(r *Recorder) { attached = r }, func() []SceneEntry {
+		if attached == nil {
+			t.Error("scene taken before the recorder was attached")
+		}
+		return scene
+	})
+	if _, err := rs.Start("../escape"); err == nil {
+		t.Error("started a session with an invalid name")
+	}
+	if _, err := rs.Start("review"); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if attached == nil {
+		t.Error("recorder not attached")
+	}
+	if _, err := rs.Start("other"); err != errRecordingActive {
+		t.Errorf("second Start = %v; want %v", err, errRecordingActive)
+	}
+	info, err := rs.Stop()
+	if err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if attached != nil {
+		t.Error("recorder still attached after Stop")
+	}
+	if _, err := rs.Stop(); err != errNoRecording {
+		t.Errorf("second Stop = %v; want %v", err, errNoRecording)
+	}
+	list, err := rs.List()
+	if err != nil || len(list) != 1 || list[0].File != info.File || list[0].Session != "review" {
+		t.Errorf("List = %+v, %v", list, err)
+	}
+	if _, err := rs.Path("review", "../../etc/passwd"); err == nil {
+		t.Error("Path accepted a file outside the session")
+	}
+	// The recording starts from the scene at the time.
+	name, _ := rs.Path("review", info.File)
+	if header, _, err := ReadRecording(name); err != nil || !reflect.DeepEqual(header.Scene, scene) {
+		t.Errorf("header scene = %+v, %v", header.Scene, err)
+	}
+}
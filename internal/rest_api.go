@@ -0,0 +1,122 @@
+package internal
+
+import (
+	_ "embed"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// The REST API mirrors the NATS command set for tools that cannot speak NATS.
+// Bodies are the same JSON the NATS subjects accept, and commands go through
+// the same pipeline.
+
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+// SceneCommand is a command in the current scene, as served by GET /api/scene.
+type SceneCommand struct {
+	Type     string      `json:"type"`
+	Path     string      `json:"path"`
+	Property string      `json:"property,omitempty"`
+	Command  interface{} `json:"command"`
+}
+
+// commandPath returns the scene path named by the route's wildcard.
+func commandPath(c echo.Context) (string, error) {
+	path, err := url.PathUnescape(c.Param("*"))
+	if err != nil || path == "" {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "a scene path is required, e.g. /api/objects/drone/1")
+	}
+	return path, nil
+}
+
+// commandHandler applies the request body at the route's path with apply.
+func commandHandler(apply func(path string, data []byte) error) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path, err := commandPath(c)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "unable to read request body")
+		}
+		return commandResult(c, apply(path, data))
+	}
+}
+
+func commandResult(c echo.Context, err error) error {
+	switch {
+	case err == nil:
+		return c.NoContent(http.StatusNoContent)
+	case errors.Is(err, errInvalidCommand):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, errHubClosed):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	default:
+		return err
+	}
+}
+
+// SetObjectHandler adds a geometry, e.g.
+// `PUT /api/objects/drone/1 {"radius": 0.5}`.
+func (s *Server) SetObjectHandler() echo.HandlerFunc {
+	return commandHandler(s.applyObject)
+}
+
+// SetTransformHandler sets a transform, e.g.
+// `PUT /api/transforms/drone/1 {"translation": [1, 0, 0]}`.
+func (s *Server) SetTransformHandler() echo.HandlerFunc {
+	return commandHandler(s.applyTransform)
+}
+
+// SetPropertyHandler sets a property, e.g.
+// `PATCH /api/properties/drone/1 {"property": "visible", "value": false}`.
+func (s *Server) SetPropertyHandler() echo.HandlerFunc {
+	return commandHandler(s.applyProperty)
+}
+
+// DeleteObjectHandler removes an object and everything below it.
+func (s *Server) DeleteObjectHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path, err := commandPath(c)
+		if err != nil {
+			return err
+		}
+		return commandResult(c, s.applyDelete(path))
+	}
+}
+
+// SceneHandler serves the commands that make up the current scene, in the
+// order they are replayed to viewers.
+func (s *Server) SceneHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		snapshot := s.Scene.Snapshot()
+		commands := make([]SceneCommand, 0, len(snapshot))
+		for _, entry := range snapshot {
+			var cmd interface{}
+			if err := msgpack.Unmarshal(entry.Data, &cmd); err != nil {
+				return err
+			}
+			commands = append(commands, SceneCommand{
+				Type:     entry.Type,
+				Path:     entry.Path,
+				Property: entry.Property,
+				Command:  cmd,
+			})
+		}
+		return c.JSON(http.StatusOK, commands)
+	}
+}
+
+// OpenAPIHandler serves the OpenAPI document describing the HTTP API.
+func (s *Server) OpenAPIHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.Blob(http.StatusOK, "application/yaml", openAPIDocument)
+	}
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func request(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func sceneCommands(t *testing.T, url string) []SceneCommand {
+	t.Helper()
+	resp := request(t, http.MethodGet, url+"/api/scene", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/scene: %s", resp.Status)
+	}
+	var commands []SceneCommand
+	if err := json.NewDecoder(resp.Body).Decode(&commands); err != nil {
+		t.Fatal(err)
+	}
+	return commands
+}
+
+func TestRESTCommandsReachViewer(t *testing.T) {
+	_, srv := newTestServer(t)
+	conn := dialViewer(t, srv)
+
+	resp := request(t, http.MethodPut, srv.URL+"/api/transforms/drone/1", `{"translation": [1, 2, 3]}`)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT transform: %s", resp.Status)
+	}
+	var transform SetTransformationCommand
+	readCommand(t, conn, "set_transform", &transform)
+	if transform.Path != "drone/1" || transform.Object.Translation[2] != 3 {
+		t.Errorf("unexpected transform %+v", transform)
+	}
+
+	resp = request(t, http.MethodPatch, srv.URL+"/api/properties/drone/1", `{"property": "visible", "value": false}`)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PATCH property: %s", resp.Status)
+	}
+	var property SetProperty
+	readCommand(t, conn, "set_property", &property)
+	if property.Property != "visible" || property.Value != false {
+		t.Errorf("unexpected property %+v", property)
+	}
+
+	resp = request(t, http.MethodPut, srv.URL+"/api/objects/drone/1/body", `{"radius": 0.5}`)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT object: %s", resp.Status)
+	}
+	var object Command
+	readCommand(t, conn, "set_object", &object)
+	if object.Path != "drone/1/body" {
+		t.Errorf("unexpected object path %q", object.Path)
+	}
+
+	if got := len(sceneCommands(t, srv.URL)); got != 3 {
+		t.Errorf("scene has %d commands, want 3", got)
+	}
+	resp = request(t, http.MethodDelete, srv.URL+"/api/objects/drone", "")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE object: %s", resp.Status)
+	}
+	var del Delete
+	readCommand(t, conn, "delete", &del)
+	if got := sceneCommands(t, srv.URL); len(got) != 0 {
+		t.Errorf("scene not empty after delete: %+v", got)
+	}
+}
+
+func TestRESTAndNATSShareThePipeline(t *testing.T) {
+	s, srv := newTestServer(t)
+	if err := s.NATS.Publish("meshcat.properties.drone.1", []byte(`{"property": "color", "value": [1, 0, 0]}`)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		commands := sceneCommands(t, srv.URL)
+		if len(commands) == 1 && commands[0].Type == "set_property" && commands[0].Path == "/drone/1" && commands[0].Property == "color" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("NATS property missing from the REST scene: %+v", commands)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRESTInvalidCommands(t *testing.T) {
+	_, srv := newTestServer(t)
+	for _, test := range []struct {
+		method, path, body string
+	}{
+		{http.MethodPut, "/api/transforms/drone", `{"translation": "up"}`},
+		{http.MethodPut, "/api/objects/drone", `not json`},
+		{http.MethodPut, "/api/objects/drone", `{"type": 5}`},
+		{http.MethodPut, "/api/objects/drone", `{"radius": 1, "uuid": [1]}`},
+		{http.MethodPatch, "/api/properties/drone", `{"value": 1}`},
+		{http.MethodPut, "/api/transforms/", `{}`},
+	} {
+		resp := request(t, test.method, srv.URL+test.path, test.body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s %s %s: got %s, want 400", test.method, test.path, test.body, resp.Status)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	_, srv := newTestServer(t)
+	resp := request(t, http.MethodGet, srv.URL+"/api/openapi.yaml", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/openapi.yaml: %s", resp.Status)
+	}
+	for _, route := range []string{"/api/scene:", "/api/objects/{path}:", "/api/transforms/{path}:", "/api/properties/{path}:"} {
+		if !strings.Contains(string(openAPIDocument), route) {
+			t.Errorf("OpenAPI document does not describe %s", route)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/nats-io/nats.go"
+)
+
+// ROS messages are accepted as JSON or CBOR, bare or wrapped in a rosbridge
+// `{"op": "publish", "topic": ..., "msg": ...}` envelope, on these subjects:
+//
+//	meshcat.ros.tf             tf2_msgs/TFMessage, from /tf and /tf_static
+//	meshcat.ros.transform      geometry_msgs/TransformStamped
+//	meshcat.ros.pose.<path>    geometry_msgs/PoseStamped of <path> in header.frame_id
+//	meshcat.ros.joint_states   sensor_msgs/JointState, for the joints in ROSConfig.Joints
+//
+// TF frames are nested under their parent frames below ROSConfig.Root, so the
+// transform from `map` to `base_link` is set at `ros/map/base_link`.
+const rosSubjectPrefix = "meshcat.ros."
+
+// ROSConfig configures how ROS messages map to scene paths.
+type ROSConfig struct {
+	// Root is the scene path TF frames are placed under.
+	Root string `env:"MESHCAT_ROS_ROOT" flag:"ros-root" desc:"scene path ROS TF frames are placed under" yaml:"root" toml:"root"`
+	// Joints maps the joint names of JointState messages to the scene paths
+	// they move. Joints not listed are ignored.
+	Joints map[string]ROSJoint `yaml:"joints" toml:"joints"`
+}
+
+// ROSJoint is a joint moved by JointState messages.
+type ROSJoint struct {
+	// Path is the scene path the joint's motion is applied to.
+	Path string `yaml:"path" toml:"path"`
+	// Type is "revolute", the default, or "prismatic".
+	Type string `yaml:"type" toml:"type"`
+	// Axis is the joint axis, [0, 0, 1] by default.
+	Axis []float64 `yaml:"axis" toml:"axis"`
+}
+
+func DefaultROSConfig() ROSConfig {
+	return ROSConfig{Root: "ros"}
+}
+
+func (cfg ROSConfig) Validate() error {
+	var errs []error
+	for name, joint := range cfg.Joints {
+		if joint.Path == "" {
+			errs = append(errs, fmt.Errorf("ROS joint %q needs a scene path", name))
+		}
+		switch joint.Type {
+		case "", "revolute", "prismatic":
+		default:
+			errs = append(errs, fmt.Errorf("ROS joint %q: unknown type %q, expected revolute or prismatic", name, joint.Type))
+		}
+		if joint.Axis != nil {
+			if len(joint.Axis) != 3 {
+				errs = append(errs, fmt.Errorf("ROS joint %q: axis must have 3 values, got %d", name, len(joint.Axis)))
+			} else if vectorNorm(joint.Axis) == 0 {
+				errs = append(errs, fmt.Errorf("ROS joint %q: axis is zero", name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type rosHeader struct {
+	FrameID string `json:"frame_id"`
+}
+
+type rosVector3 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+type rosQuaternion struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+	W float64 `json:"w"`
+}
+
+type rosPose struct {
+	Position    rosVector3    `json:"position"`
+	Orientation rosQuaternion `json:"orientation"`
+}
+
+// rosPoseStamped is a geometry_msgs/PoseStamped.
+type rosPoseStamped struct {
+	Header rosHeader `json:"header"`
+	Pose   rosPose   `json:"pose"`
+}
+
+type rosTransform struct {
+	Translation rosVector3    `json:"translation"`
+	Rotation    rosQuaternion `json:"rotation"`
+}
+
+// rosTransformStamped is a geometry_msgs/TransformStamped.
+type rosTransformStamped struct {
+	Header       rosHeader    `json:"header"`
+	ChildFrameID string       `json:"child_frame_id"`
+	Transform    rosTransform `json:"transform"`
+}
+
+// rosTFMessage is a tf2_msgs/TFMessage.
+type rosTFMessage struct {
+	Transforms []rosTransformStamped `json:"transforms"`
+}
+
+// rosJointState is a sensor_msgs/JointState.
+type rosJointState struct {
+	Header   rosHeader `json:"header"`
+	Name     []string  `json:"name"`
+	Position rosFloats `json:"position"`
+}
+
+// rosFloats is a float64[] field. rosbridge's CBOR encoding sends these as
+// RFC 8746 typed arrays rather than CBOR arrays.
+type rosFloats []float64
+
+const (
+	cborTagFloat32LE = 85
+	cborTagFloat64LE = 86
+)
+
+func (f *rosFloats) UnmarshalCBOR(data []byte) error {
+	if len(data) == 0 || data[0]>>5 != 6 {
+		return cbor.Unmarshal(data, (*[]float64)(f))
+	}
+	var tag cbor.RawTag
+	if err := cbor.Unmarshal(data, &tag); err != nil {
+		return err
+	}
+	var b []byte
+	if err := cbor.Unmarshal(tag.Content, &b); err != nil {
+		return fmt.Errorf("typed array tag %d: %v", tag.Number, err)
+	}
+	switch tag.Number {
+	case cborTagFloat64LE:
+		if len(b)%8 != 0 {
+			return fmt.Errorf("float64 typed array of %d bytes", len(b))
+		}
+		values := make([]float64, len(b)/8)
+		for i := range values {
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[8*i:]))
+		}
+		*f = values
+	case cborTagFloat32LE:
+		if len(b)%4 != 0 {
+			return fmt.Errorf("float32 typed array of %d bytes", len(b))
+		}
+		values := make([]float64, len(b)/4)
+		for i := range values {
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:])))
+		}
+		*f = values
+	default:
+		return fmt.Errorf("unsupported typed array tag %d", tag.Number)
+	}
+	return nil
+}
+
+// decodeROS decodes a ROS message, JSON or CBOR, bare or in a rosbridge
+// publish envelope, into v.
+func decodeROS(data []byte, v interface{}) error {
+	if text := bytes.TrimSpace(data); len(text) > 0 && text[0] == '{' {
+		var envelope struct {
+			Op  string          `json:"op"`
+			Msg json.RawMessage `json:"msg"`
+		}
+		if err := json.Unmarshal(text, &envelope); err != nil {
+			return err
+		}
+		if envelope.Op != "" {
+			if envelope.Op != "publish" {
+				return fmt.Errorf("unexpected rosbridge op %q", envelope.Op)
+			}
+			text = envelope.Msg
+		}
+		return json.Unmarshal(text, v)
+	}
+	var envelope struct {
+		Op  string          `json:"op"`
+		Msg cbor.RawMessage `json:"msg"`
+	}
+	if err := cbor.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+	if envelope.Op != "" {
+		if envelope.Op != "publish" {
+			return fmt.Errorf("unexpected rosbridge op %q", envelope.Op)
+		}
+		data = envelope.Msg
+	}
+	return cbor.Unmarshal(data, v)
+}
+
+// rosFrames is the TF tree seen so far, used to nest frames under their parents.
+type rosFrames struct {
+	mu      sync.Mutex
+	parents map[string]string
+	// placed is where each frame's transform, and each pose, was last set.
+	placed map[string]*rosPlacement
+	// changes counts changes to the tree, checked the last time placements
+	// were checked for having moved.
+	changes, checked int
+}
+
+// rosPlacement is a transform set in the scene at the path of frame plus
+// suffix, so it can follow the frame when the frame moves in the tree.
+type rosPlacement struct {
+	frame, suffix string
+	path          string
+	transform     TransformationCommand
+}
+
+// rosMove is a transform to move from one scene path to another.
+type rosMove struct {
+	from, to  string
+	transform TransformationCommand
+}
+
+// setParent records the parent of child, returning the previous parent if
+// child moved in the tree.
+func (f *rosFrames) setParent(child, parent string) (previous string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.parents == nil {
+		f.parents = map[string]string{}
+	}
+	previous = f.parents[child]
+	f.parents[child] = parent
+	if previous == parent {
+		return ""
+	}
+	f.changes++
+	return previous
+}
+
+// place records that transform is set, under key, at the path of frame plus
+// suffix below root. It returns that path and the transforms placed earlier
+// whose path has changed since, e.g. because a frame was published before
+// its parent, in parent-first order.
+func (f *rosFrames) place(root, key, frame, suffix string, transform TransformationCommand) (string, []rosMove) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.placed == nil {
+		f.placed = map[string]*rosPlacement{}
+	}
+	var moved []rosMove
+	path := f.pathLocked(root, frame) + suffix
+	if p, ok := f.placed[key]; ok && p.path != path {
+		moved = append(moved, rosMove{from: p.path, to: path, transform: transform})
+	}
+	f.placed[key] = &rosPlacement{frame: frame, suffix: suffix, path: path, transform: transform}
+	if f.checked != f.changes {
+		f.checked = f.changes
+		for k, p := range f.placed {
+			if k == key {
+				continue
+			}
+			if to := f.pathLocked(root, p.frame) + p.suffix; to != p.path {
+				moved = append(moved, rosMove{from: p.path, to: to, transform: p.transform})
+				p.path = to
+			}
+		}
+	}
+	sort.Slice(moved, func(i, j int) bool { return moved[i].from < moved[j].from })
+	return path, moved
+}
+
+// path is the scene path of frame: its ancestors from the root of its tree,
+// below root.
+func (f *rosFrames) path(root, frame string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pathLocked(root, frame)
+}
+
+func (f *rosFrames) pathLocked(root, frame string) string {
+	chain := []string{frame}
+	seen := map[string]bool{frame: true}
+	for parent, ok := f.parents[frame]; ok && !seen[parent]; parent, ok = f.parents[parent] {
+		chain = append(chain, parent)
+		seen[parent] = true
+	}
+	segments := []string{}
+	if root != "" {
+		segments = append(segments, root)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		segments = append(segments, chain[i])
+	}
+	return strings.Join(segments, "/")
+}
+
+// rosFrameID trims the leading "/" of ROS 1 frame ids.
+func rosFrameID(id string) string {
+	return strings.Trim(id, "/")
+}
+
+func rosTransformation(translation rosVector3, rotation rosQuaternion) (TransformationCommand, error) {
+	q, err := normalizeQuaternion([]float64{rotation.X, rotation.Y, rotation.Z, rotation.W})
+	if err != nil {
+		return TransformationCommand{}, err
+	}
+	return normalizeTransformation(TransformationCommand{
+		Translation: []float64{translation.X, translation.Y, translation.Z},
+		Rotation:    q,
+	})
+}
+
+func (s *Server) rosSubscription() (*nats.Subscription, error) {
+	sub, err := s.NATS.Subscribe(rosSubjectPrefix+">", s.observed(func(msg *nats.Msg) {
+		if err := s.applyROS(msg.Subject, msg.Data); err != nil {
+			s.commandFailed(msg, "", err)
+		}
+	}))
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", rosSubjectPrefix+">", "error", err)
+	}
+	return sub, err
+}
+
+// applyROS applies the ROS message published on subject.
+func (s *Server) applyROS(subject string, data []byte) error {
+	kind := strings.TrimPrefix(subject, rosSubjectPrefix)
+	switch {
+	case kind == "tf":
+		var tf rosTFMessage
+		if err := decodeROS(data, &tf); err != nil {
+			return invalidCommand("unable to decode TFMessage: %v", err)
+		}
+		var errs []error
+		for _, t := range tf.Transforms {
+			errs = append(errs, s.applyROSTransform(t))
+		}
+		return errors.Join(errs...)
+	case kind == "transform":
+		var t rosTransformStamped
+		if err := decodeROS(data, &t); err != nil {
+			return invalidCommand("unable to decode TransformStamped: %v", err)
+		}
+		return s.applyROSTransform(t)
+	case strings.HasPrefix(kind, "pose."):
+		var pose rosPoseStamped
+		if err := decodeROS(data, &pose); err != nil {
+			return invalidCommand("unable to decode PoseStamped: %v", err)
+		}
+		return s.applyROSPose(subjectPath(kind, "pose."), pose)
+	case kind == "joint_states":
+		var state rosJointState
+		if err := decodeROS(data, &state); err != nil {
+			return invalidCommand("unable to decode JointState: %v", err)
+		}
+		return s.applyJointState(state)
+	default:
+		return invalidCommand("no ROS message is accepted on %s", subject)
+	}
+}
+
+// applyROSTransform sets the transform of a TF child frame relative to its parent.
+func (s *Server) applyROSTransform(t rosTransformStamped) error {
+	parent, child := rosFrameID(t.Header.FrameID), rosFrameID(t.ChildFrameID)
+	if child == "" {
+		return invalidCommand("transform needs a child_frame_id")
+	}
+	if parent != "" {
+		if previous := s.rosFrames.setParent(child, parent); previous != "" {
+			s.Logger.Warn("TF frame moved to a new parent", "subsystem", "ros", "frame", child, "from", previous, "to", parent)
+		}
+	}
+	transformation_matrix, err := rosTransformation(t.Transform.Translation, t.Transform.Rotation)
+	if err != nil {
+		return invalidCommand("frame %s: %v", child, err)
+	}
+	return s.placeROS("frame "+child, child, "", transformation_matrix)
+}
+
+// applyROSPose places the object at path below its header frame.
+func (s *Server) applyROSPose(path string, pose rosPoseStamped) error {
+	if path == "" {
+		return invalidCommand("pose needs a path, e.g. meshcat.ros.pose.drone1")
+	}
+	transformation_matrix, err := rosTransformation(pose.Pose.Position, pose.Pose.Orientation)
+	if err != nil {
+		return invalidCommand("%v", err)
+	}
+	if frame := rosFrameID(pose.Header.FrameID); frame != "" {
+		return s.placeROS("pose "+path, frame, "/"+path, transformation_matrix)
+	}
+	if s.ROS.Root != "" {
+		path = s.ROS.Root + "/" + path
+	}
+	return s.setTransform(path, transformation_matrix)
+}
+
+// placeROS sets transform at the path of frame plus suffix, first moving
+// whatever the TF tree has moved since it was set: the old paths are deleted
+// so no stale copies are left behind, and the transforms set again at the new
+// ones, since static frames are not published again.
+func (s *Server) placeROS(key, frame, suffix string, transform TransformationCommand) error {
+	path, moved := s.rosFrames.place(s.ROS.Root, key, frame, suffix, transform)
+	var errs []error
+	for _, m := range moved {
+		s.Logger.Debug("TF frame moved", "subsystem", "ros", "from", m.from, "to", m.to)
+		errs = append(errs, s.applyDelete(m.from))
+	}
+	for _, m := range moved {
+		if m.to != path {
+			errs = append(errs, s.setTransform(m.to, m.transform))
+		}
+	}
+	errs = append(errs, s.setTransform(path, transform))
+	return errors.Join(errs...)
+}
+
+// applyJointState moves the configured joints to their positions: a rotation
+// about the axis for revolute joints, a translation along it for prismatic ones.
+func (s *Server) applyJointState(state rosJointState) error {
+	if len(state.Position) < len(state.Name) {
+		return invalidCommand("JointState has %d names but %d positions", len(state.Name), len(state.Position))
+	}
+	var errs []error
+	for i, name := range state.Name {
+		joint, ok := s.ROS.Joints[name]
+		if !ok {
+			continue
+		}
+		axis := []float64{0, 0, 1}
+		if joint.Axis != nil {
+			norm := vectorNorm(joint.Axis)
+			axis = []float64{joint.Axis[0] / norm, joint.Axis[1] / norm, joint.Axis[2] / norm}
+		}
+		position := state.Position[i]
+		transformation_matrix := TransformationCommand{
+			Translation: []float64{0, 0, 0},
+			Rotation:    []float64{0, 0, 0, 1},
+		}
+		if joint.Type == "prismatic" {
+			transformation_matrix.Translation = []float64{axis[0] * position, axis[1] * position, axis[2] * position}
+		} else {
+			sin, cos := math.Sincos(position / 2)
+			transformation_matrix.Rotation = []float64{axis[0] * sin, axis[1] * sin, axis[2] * sin, cos}
+		}
+		errs = append(errs, s.setTransform(joint.Path, transformation_matrix))
+	}
+	return errors.Join(errs...)
+}
+
+func vectorNorm(v []float64) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestDecodeROS(t *testing.T) {
+	bare := `{"header": {"frame_id": "map"}, "child_frame_id": "base_link",
+		"transform": {"translation": {"x": 1, "y": 2, "z": 3}, "rotation": {"x": 0, "y": 0, "z": 0, "w": 1}}}`
+	wrapped := `{"op": "publish", "topic": "/transform", "msg": ` + bare + `}`
+	for _, payload := range []string{bare, wrapped} {
+		var ts rosTransformStamped
+		if err := decodeROS([]byte(payload), &ts); err != nil {
+			t.Fatalf("decodeROS: %v", err)
+		}
+		if ts.Header.FrameID != "map" || ts.ChildFrameID != "base_link" || ts.Transform.Translation.Y != 2 {
+			t.Errorf("decoded %+v", ts)
+		}
+	}
+	if err := decodeROS([]byte(`{"op": "subscribe", "topic": "/tf"}`), &rosTFMessage{}); err == nil {
+		t.Error("expected an error for a subscribe op")
+	}
+
+	// rosbridge's CBOR compression sends float64[] as a little endian typed array.
+	positions := make([]byte, 16)
+	binary.LittleEndian.PutUint64(positions, math.Float64bits(0.5))
+	binary.LittleEndian.PutUint64(positions[8:], math.Float64bits(-1.5))
+	data, err := cbor.Marshal(map[string]interface{}{
+		"op":    "publish",
+		"topic": "/joint_states",
+		"msg": map[string]interface{}{
+			"name":     []string{"shoulder", "elbow"},
+			"position": cbor.Tag{Number: cborTagFloat64LE, Content: positions},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state rosJointState
+	if err := decodeROS(data, &state); err != nil {
+		t.Fatalf("decodeROS CBOR: %v", err)
+	}
+	if len(state.Name) != 2 || !floatsEqual(state.Position, []float64{0.5, -1.5}) {
+		t.Errorf("decoded %+v", state)
+	}
+
+	data, err = cbor.Marshal(map[string]interface{}{"name": []string{"a"}, "position": []float64{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decodeROS(data, &state); err != nil || !floatsEqual(state.Position, []float64{2}) {
+		t.Errorf("plain CBOR array: %v, %v", state.Position, err)
+	}
+}
+
+func TestROSFramesPath(t *testing.T) {
+	var frames rosFrames
+	frames.setParent("base_link", "odom")
+	frames.setParent("odom", "map")
+	if got := frames.path("ros", "base_link"); got != "ros/map/odom/base_link" {
+		t.Errorf("path = %q", got)
+	}
+	if got := frames.path("", "map"); got != "map" {
+		t.Errorf("root path = %q", got)
+	}
+	if previous := frames.setParent("base_link", "world"); previous != "odom" {
+		t.Errorf("setParent returned %q; want the previous parent", previous)
+	}
+	// A cycle must not hang.
+	frames.setParent("map", "base_link")
+	frames.path("ros", "base_link")
+}
+
+// sceneTransform returns the translation and rotation set at path.
+func sceneTransform(t *testing.T, s *Server, path string) (translation, rotation []float64) {
+	t.Helper()
+	for _, entry := range s.Scene.Snapshot() {
+		if entry.Path != path {
+			continue
+		}
+		var cmd SetTransformationCommand
+		if err := msgpack.Unmarshal(entry.Data, &cmd); err != nil {
+			t.Fatal(err)
+		}
+		return cmd.Object.Translation, cmd.Object.Rotation
+	}
+	t.Fatalf("no transform at %s in %+v", path, s.Scene.Snapshot())
+	return nil, nil
+}
+
+func TestROSMessagesReachScene(t *testing.T) {
+	s, _ := newTestServer(t, func(cfg *Config) {
+		cfg.ROS.Joints = map[string]ROSJoint{
+			"wrist":  {Path: "arm/wrist", Axis: []float64{0, 0, 2}},
+			"slider": {Path: "arm/slider", Type: "prismatic", Axis: []float64{1, 0, 0}},
+		}
+	})
+
+	tf := `{"transforms": [
+		{"header": {"frame_id": "map"}, "child_frame_id": "odom",
+		 "transform": {"translation": {"x": 1, "y": 0, "z": 0}, "rotation": {"x": 0, "y": 0, "z": 0, "w": 1}}},
+		{"header": {"frame_id": "odom"}, "child_frame_id": "/base_link",
+		 "transform": {"translation": {"x": 0, "y": 2, "z": 0}, "rotation": {"x": 0, "y": 0, "z": 0, "w": 2}}}
+	]}`
+	if err := s.applyROS("meshcat.ros.tf", []byte(tf)); err != nil {
+		t.Fatalf("tf: %v", err)
+	}
+	translation, rotation := sceneTransform(t, s, "/ros/map/odom/base_link")
+	if !floatsEqual(translation, []float64{0, 2, 0}) || !floatsEqual(rotation, []float64{0, 0, 0, 1}) {
+		t.Errorf("base_link translation %v rotation %v", translation, rotation)
+	}
+
+	pose := `{"header": {"frame_id": "odom"},
+		"pose": {"position": {"x": 5, "y": 6, "z": 7}, "orientation": {"x": 0, "y": 0, "z": 0, "w": 1}}}`
+	if err := s.applyROS("meshcat.ros.pose.drone1", []byte(pose)); err != nil {
+		t.Fatalf("pose: %v", err)
+	}
+	if translation, _ := sceneTransform(t, s, "/ros/map/odom/drone1"); !floatsEqual(translation, []float64{5, 6, 7}) {
+		t.Errorf("drone1 translation %v", translation)
+	}
+
+	joints := `{"name": ["wrist", "unknown", "slider"], "position": [3.141592653589793, 1, 0.25]}`
+	if err := s.applyROS("meshcat.ros.joint_states", []byte(joints)); err != nil {
+		t.Fatalf("joint_states: %v", err)
+	}
+	if _, rotation := sceneTransform(t, s, "/arm/wrist"); !floatsEqual(rotation, []float64{0, 0, 1, math.Cos(math.Pi / 2)}) {
+		t.Errorf("wrist rotation %v", rotation)
+	}
+	if translation, _ := sceneTransform(t, s, "/arm/slider"); !floatsEqual(translation, []float64{0.25, 0, 0}) {
+		t.Errorf("slider translation %v", translation)
+	}
+
+	for subject, payload := range map[string]string{
+		"meshcat.ros.transform":    `{"header": {"frame_id": "map"}, "transform": {}}`,
+		"meshcat.ros.pose":         pose,
+		"meshcat.ros.unknown":      `{}`,
+		"meshcat.ros.joint_states": `{"name": ["wrist"], "position": []}`,
+	} {
+		if err := s.applyROS(subject, []byte(payload)); err == nil {
+			t.Errorf("%s: expected an error", subject)
+		}
+	}
+}
+
+func TestROSOverNATS(t *testing.T) {
+	s, _ := newTestServer(t)
+	transform := `{"op": "publish", "topic": "/tf_static", "msg": {"header": {"frame_id": "world"}, "child_frame_id": "camera",
+		"transform": {"translation": {"x": 0, "y": 0, "z": 1}, "rotation": {"x": 0, "y": 0, "z": 0, "w": 1}}}}`
+	if err := s.NATS.Publish("meshcat.ros.transform", []byte(transform)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s.Scene.Len() == 1 })
+	if translation, _ := sceneTransform(t, s, "/ros/world/camera"); !floatsEqual(translation, []float64{0, 0, 1}) {
+		t.Errorf("camera translation %v", translation)
+	}
+}
+
+func TestROSFrameFollowsLateParent(t *testing.T) {
+	s, _ := newTestServer(t)
+	child := `{"header": {"frame_id": "odom"}, "child_frame_id": "base_link",
+		"transform": {"translation": {"x": 0, "y": 2, "z": 0}, "rotation": {"x": 0, "y": 0, "z": 0, "w": 1}}}`
+	if err := s.applyROS("meshcat.ros.transform", []byte(child)); err != nil {
+		t.Fatal(err)
+	}
+	pose := `{"header": {"frame_id": "odom"},
+		"pose": {"position": {"x": 5, "y": 6, "z": 7}, "orientation": {"x": 0, "y": 0, "z": 0, "w": 1}}}`
+	if err := s.applyROS("meshcat.ros.pose.drone1", []byte(pose)); err != nil {
+		t.Fatal(err)
+	}
+	sceneTransform(t, s, "/ros/odom/base_link")
+
+	// The parent arrives last, as it may from tf_static, which is not sent again.
+	parent := `{"header": {"frame_id": "map"}, "child_frame_id": "odom",
+		"transform": {"translation": {"x": 1, "y": 0, "z": 0}, "rotation": {"x": 0, "y": 0, "z": 0, "w": 1}}}`
+	if err := s.applyROS("meshcat.ros.transform", []byte(parent)); err != nil {
+		t.Fatal(err)
+	}
+	if translation, _ := sceneTransform(t, s, "/ros/map/odom/base_link"); !floatsEqual(translation, []float64{0, 2, 0}) {
+		t.Errorf("base_link translation %v", translation)
+	}
+	if translation, _ := sceneTransform(t, s, "/ros/map/odom/drone1"); !floatsEqual(translation, []float64{5, 6, 7}) {
+		t.Errorf("drone1 translation %v", translation)
+	}
+	for _, entry := range s.Scene.Snapshot() {
+		if strings.HasPrefix(entry.Path, "/ros/odom") {
+			t.Errorf("stale entry at %s", entry.Path)
+		}
+	}
+}
@@ -1,27 +1,92 @@
 package internal
 
 import (
-	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 func (s *Server) Routes() {
-	s.Router.GET("/ws", s.serveWs())
-	s.Router.GET("/data/*", s.StaticHandler("web/meshcat/data"))
-	s.Router.GET("/*", s.StaticHandler("web/meshcat/dist"))
+	viewer := s.RequireRole(RoleViewer)
+	control := s.RequireRole(RoleControl)
+
+	// Probes and metrics are unauthenticated, for Kubernetes and Prometheus.
+	s.Router.GET("/healthz", s.HealthHandler())
+	s.Router.GET("/readyz", s.ReadyHandler())
+	s.Router.GET("/metrics", s.MetricsHandler())
+	s.Router.GET("/api/openapi.yaml", s.OpenAPIHandler())
+	s.Router.GET("/ws", s.serveWs(), viewer)
+	s.Router.GET("/api/share", s.ShareLinkHandler(), control)
+	s.Router.GET("/api/status", s.StatusHandler(), viewer)
+	s.Router.GET("/api/export/html", s.ExportHandler(), viewer)
+	s.Router.GET("/api/scene", s.SceneHandler(), viewer)
+	s.Router.PUT("/api/objects/*", s.SetObjectHandler(), control)
+	s.Router.DELETE("/api/objects/*", s.DeleteObjectHandler(), control)
+	s.Router.PUT("/api/transforms/*", s.SetTransformHandler(), control)
+	s.Router.PATCH("/api/properties/*", s.SetPropertyHandler(), control)
+	s.Router.GET("/api/recordings", s.ListRecordingsHandler(), control)
+	s.Router.POST("/api/recordings", s.StartRecordingHandler(), control)
+	s.Router.POST("/api/recordings/stop", s.StopRecordingHandler(), control)
+	s.Router.GET("/api/recordings/:session/:file", s.DownloadRecordingHandler(), control)
+	s.Router.GET("/data/*", s.StaticHandler(s.HTTP.DataDir), viewer)
+	s.Router.GET("/*", s.StaticHandler(s.HTTP.StaticDir), viewer)
 
 	s.Router.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
-		LogStatus: true,
-		LogURI:    true,
-		BeforeNextFunc: func(c echo.Context) {
-			c.Set("customValueFromContext", 42)
-		},
-		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			value, _ := c.Get("customValueFromContext").(int)
-			fmt.Printf("REQUEST: uri: %v, status: %v, custom-value: %v\n", v.URI, v.Status, value)
-			return nil
-		},
+		LogMethod:     true,
+		LogURI:        true,
+		LogStatus:     true,
+		LogLatency:    true,
+		LogRemoteIP:   true,
+		LogError:      true,
+		HandleError:   true,
+		LogValuesFunc: s.logRequest,
 	}))
 }
+
+// logRequest writes one line per HTTP request. Probe and scrape requests are
+// logged at debug level so they do not drown out the rest.
+func (s *Server) logRequest(c echo.Context, v middleware.RequestLoggerValues) error {
+	level := slog.LevelInfo
+	path := c.Request().URL.Path
+	switch {
+	case v.Status >= http.StatusInternalServerError:
+		level = slog.LevelError
+	case path == "/healthz" || path == "/readyz" || path == "/metrics":
+		level = slog.LevelDebug
+	}
+	attrs := []slog.Attr{
+		slog.String("subsystem", "http"),
+		slog.String("method", v.Method),
+		slog.String("path", redactedURI(c.Request().URL)),
+		slog.Int("status", v.Status),
+		slog.Duration("latency", v.Latency),
+		slog.String("remote_ip", v.RemoteIP),
+	}
+	if v.Error != nil {
+		attrs = append(attrs, slog.String("error", v.Error.Error()))
+	}
+	s.Logger.LogAttrs(c.Request().Context(), level, "request", attrs...)
+	return nil
+}
+
+// redactedURI returns the request URI with credentials passed in the query
+// string blanked out, so they do not end up in the logs.
+func redactedURI(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for _, param := range []string{tokenParam, shareParam} {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.RequestURI()
+	}
+	r := *u
+	r.RawQuery = query.Encode()
+	return r.RequestURI()
+}
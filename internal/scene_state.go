@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// SceneKey identifies the piece of scene state a command replaces: the last
+// set_object, set_transform or set_animation at a path, or the last value of
+// one property at a path.
+type SceneKey struct {
+	Type     string `json:"type" msgpack:"type"`
+	Path     string `json:"path" msgpack:"path"`
+	Property string `json:"property,omitempty" msgpack:"property,omitempty"`
+}
+
+// SceneEntry is an encoded meshcat command together with the state it replaces.
+type SceneEntry struct {
+	SceneKey
+	Data []byte `json:"data" msgpack:"data"`
+}
+
+// statefulCommands are the command types whose latest value makes up the scene.
+var statefulCommands = map[string]int{
+	"set_object":             0,
+	"set_object_from_server": 0,
+	"set_transform":          1,
+	"set_property":           2,
+	"set_animation":          3,
+}
+
+// normalizePath maps the equivalent forms "a/b", "/a/b" and "/a/b/" to "/a/b".
+func normalizePath(path string) string {
+	return "/" + strings.Trim(path, "/")
+}
+
+// SceneKeyOf reads the scene key from an encoded command of type kind.
+func SceneKeyOf(kind string, data []byte) (SceneKey, error) {
+	var cmd struct {
+		Path     string `msgpack:"path"`
+		Property string `msgpack:"property"`
+	}
+	if err := msgpack.Unmarshal(data, &cmd); err != nil {
+		return SceneKey{}, fmt.Errorf("unable to decode %s command: %v", kind, err)
+	}
+	return SceneKey{Type: kind, Path: cmd.Path, Property: cmd.Property}, nil
+}
+
+func (k SceneKey) normalized() SceneKey {
+	k.Path = normalizePath(k.Path)
+	return k
+}
+
+// SceneState holds the latest scene commands so the scene can be replayed to
+// viewers that connect later, persisted, or exported.
+type SceneState struct {
+	mu      sync.RWMutex
+	entries map[SceneKey]SceneEntry
+}
+
+func NewSceneState() *SceneState {
+	return &SceneState{entries: map[SceneKey]SceneEntry{}}
+}
+
+// Apply records a command. A "delete" removes everything at and below its
+// path and returns the keys that were removed; stateless commands are ignored.
+func (ss *SceneState) Apply(key SceneKey, data []byte) (removed []SceneKey) {
+	key = key.normalized()
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if key.Type == "delete" {
+		for k := range ss.entries {
+			if under(k.Path, key.Path) {
+				delete(ss.entries, k)
+				removed = append(removed, k)
+			}
+		}
+		return removed
+	}
+	if _, ok := statefulCommands[key.Type]; !ok {
+		return nil
+	}
+	ss.entries[key] = SceneEntry{SceneKey: key, Data: data}
+	return nil
+}
+
+// under reports whether path is root or one of its descendants.
+func under(path, root string) bool {
+	return root == "/" || path == root || strings.HasPrefix(path, root+"/")
+}
+
+// Len returns the number of entries in the scene.
+func (ss *SceneState) Len() int {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return len(ss.entries)
+}
+
+// Snapshot returns the scene as commands in replay order: objects before
+// transforms before properties and animations, parents before children.
+func (ss *SceneState) Snapshot() []SceneEntry {
+	ss.mu.RLock()
+	snapshot := make([]SceneEntry, 0, len(ss.entries))
+	for _, entry := range ss.entries {
+		snapshot = append(snapshot, entry)
+	}
+	ss.mu.RUnlock()
+	sort.Slice(snapshot, func(i, j int) bool {
+		a, b := snapshot[i], snapshot[j]
+		if statefulCommands[a.Type] != statefulCommands[b.Type] {
+			return statefulCommands[a.Type] < statefulCommands[b.Type]
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Property < b.Property
+	})
+	return snapshot
+}
+
+// Reset replaces the scene with entries.
+func (ss *SceneState) Reset(entries []SceneEntry) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.entries = make(map[SceneKey]SceneEntry, len(entries))
+	for _, entry := range entries {
+		entry.SceneKey = entry.SceneKey.normalized()
+		ss.entries[entry.SceneKey] = entry
+	}
+}
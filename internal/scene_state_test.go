@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSceneStateApply(t *testing.T) {
+	ss := NewSceneState()
+	ss.Apply(SceneKey{Type: "set_transform", Path: "drone1/body"}, []byte("t1"))
+	ss.Apply(SceneKey{Type: "set_object", Path: "/drone1/body/"}, []byte("o1"))
+	ss.Apply(SceneKey{Type: "set_object", Path: "drone1"}, []byte("o0"))
+	ss.Apply(SceneKey{Type: "set_property", Path: "drone1", Property: "visible"}, []byte("p1"))
+	ss.Apply(SceneKey{Type: "set_object", Path: "drone2"}, []byte("o2"))
+	// The latest command for a key replaces the previous one.
+	ss.Apply(SceneKey{Type: "set_transform", Path: "/drone1/body"}, []byte("t2"))
+	// Stateless commands are not recorded.
+	ss.Apply(SceneKey{Type: "set_status", Path: "drone1"}, []byte("s"))
+
+	var got []string
+	for _, entry := range ss.Snapshot() {
+		got = append(got, entry.Path+":"+string(entry.Data))
+	}
+	want := []string{"/drone1:o0", "/drone1/body:o1", "/drone2:o2", "/drone1/body:t2", "/drone1:p1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot = %v; want %v", got, want)
+	}
+
+	removed := ss.Apply(SceneKey{Type: "delete", Path: "drone1"}, nil)
+	if len(removed) != 4 {
+		t.Errorf("delete removed %v; want 4 keys", removed)
+	}
+	if ss.Len() != 1 {
+		t.Errorf("Len after delete = %d; want 1", ss.Len())
+	}
+	ss.Apply(SceneKey{Type: "delete", Path: "/"}, nil)
+	if ss.Len() != 0 {
+		t.Errorf("Len after deleting root = %d; want 0", ss.Len())
+	}
+}
+
+func TestEscapeKeyToken(t *testing.T) {
+	for in, want := range map[string]string{
+		"/drone1/body": "/drone1/body",
+		"/a.b/c d":     "/a=2Eb/c=20d",
+		"/x=y":         "/x=3Dy",
+	} {
+		if got := escapeKeyToken(in); got != want {
+			t.Errorf("escapeKeyToken(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// PersistenceConfig configures the JetStream key-value bucket the scene state
+// is persisted in, so it survives restarts and can be shared between replicas.
+type PersistenceConfig struct {
+	Enabled bool   `env:"MESHCAT_PERSIST_SCENE" flag:"persist-scene" desc:"persist the scene state in a JetStream key-value bucket" yaml:"enabled" toml:"enabled"`
+	Bucket  string `env:"MESHCAT_SCENE_BUCKET" yaml:"bucket" toml:"bucket"`
+	// Scene namespaces the keys, so several scenes can share a bucket.
+	Scene string `env:"MESHCAT_SCENE" flag:"scene" desc:"name of the persisted scene" yaml:"scene" toml:"scene"`
+	// TTL expires entries that have not been updated for this long, 0 keeps them forever.
+	TTL time.Duration `env:"MESHCAT_SCENE_TTL" yaml:"ttl" toml:"ttl"`
+	// History is the number of values kept per key, at most 64.
+	History  uint8 `env:"MESHCAT_SCENE_HISTORY" yaml:"history" toml:"history"`
+	MaxBytes int64 `env:"MESHCAT_SCENE_MAX_BYTES" yaml:"max_bytes" toml:"max_bytes"`
+	Replicas int   `env:"MESHCAT_SCENE_REPLICAS" yaml:"replicas" toml:"replicas"`
+	// Storage is "file" or "memory".
+	Storage string `env:"MESHCAT_SCENE_STORAGE" yaml:"storage" toml:"storage"`
+}
+
+func DefaultPersistenceConfig() PersistenceConfig {
+	return PersistenceConfig{
+		Bucket:   "meshcat_scene",
+		Scene:    "default",
+		History:  1,
+		MaxBytes: -1,
+		Replicas: 1,
+		Storage:  "file",
+	}
+}
+
+func (cfg PersistenceConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Storage != "file" && cfg.Storage != "memory" {
+		return fmt.Errorf("scene storage must be file or memory, got %q", cfg.Storage)
+	}
+	if cfg.History < 1 || cfg.History > 64 {
+		return fmt.Errorf("scene history must be between 1 and 64, got %d", cfg.History)
+	}
+	if cfg.Scene == "" || escapeKeyToken(cfg.Scene) != cfg.Scene {
+		return fmt.Errorf("scene name %q may only contain letters, digits, '-', '_' and '/'", cfg.Scene)
+	}
+	return nil
+}
+
+// SceneStore persists SceneState entries in a JetStream key-value bucket
+// under keys of the form `<scene>.<command>.<path>[.<property>]`.
+type SceneStore struct {
+	js    jetstream.JetStream
+	kv    jetstream.KeyValue
+	scene string
+	put   string
+
+	// origin tags the values this store writes, so its watcher can tell them
+	// from other replicas'.
+	origin  string
+	onError func(error)
+	watcher jetstream.KeyWatcher
+}
+
+// storedEntry is the value persisted for a scene key, also carried by delete
+// markers so watchers know which key was deleted and by whom.
+type storedEntry struct {
+	SceneEntry
+	Origin string `msgpack:"origin,omitempty"`
+}
+
+// kvOperationHeader marks a message published to the bucket as a delete, the
+// way KeyValue.Delete does.
+const kvOperationHeader = "KV-Operation"
+
+func NewSceneStore(ctx context.Context, nc *nats.Conn, cfg PersistenceConfig, onError func(error)) (*SceneStore, error) {
+	js, err := jetstream.New(nc, jetstream.WithPublishAsyncErrHandler(func(_ jetstream.JetStream, _ *nats.Msg, err error) {
+		onError(err)
+	}))
+	if err != nil {
+		return nil, err
+	}
+	storage := jetstream.FileStorage
+	if cfg.Storage == "memory" {
+		storage = jetstream.MemoryStorage
+	}
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      cfg.Bucket,
+		Description: "go-meshcat scene state",
+		History:     cfg.History,
+		TTL:         cfg.TTL,
+		MaxBytes:    cfg.MaxBytes,
+		Replicas:    cfg.Replicas,
+		Storage:     storage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open scene bucket %s: %v", cfg.Bucket, err)
+	}
+	return &SceneStore{js: js, kv: kv, scene: cfg.Scene, put: "$KV." + cfg.Bucket + ".", origin: uuid.NewString(), onError: onError}, nil
+}
+
+// escapeKeyToken escapes everything but the characters valid in a key token as `=XX`.
+func escapeKeyToken(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "=%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func (st *SceneStore) key(k SceneKey) string {
+	key := st.scene + "." + k.Type + "." + escapeKeyToken(k.Path)
+	if k.Property != "" {
+		key += "." + escapeKeyToken(k.Property)
+	}
+	return key
+}
+
+// Put persists entry without waiting for the acknowledgement, so high-rate
+// transforms are not slowed down by the round trip. Failures are reported to
+// the error handler passed to NewSceneStore.
+func (st *SceneStore) Put(entry SceneEntry) error {
+	b, err := msgpack.Marshal(storedEntry{SceneEntry: entry, Origin: st.origin})
+	if err != nil {
+		return err
+	}
+	_, err = st.js.PublishAsync(st.put+st.key(entry.SceneKey), b)
+	return err
+}
+
+// Delete removes the persisted entries for keys, without waiting for the
+// acknowledgements, like Put.
+func (st *SceneStore) Delete(keys []SceneKey) error {
+	for _, k := range keys {
+		b, err := msgpack.Marshal(storedEntry{SceneEntry: SceneEntry{SceneKey: k}, Origin: st.origin})
+		if err != nil {
+			return err
+		}
+		msg := nats.NewMsg(st.put + st.key(k))
+		msg.Header.Set(kvOperationHeader, "DEL")
+		msg.Data = b
+		if _, err := st.js.PublishMsgAsync(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads every persisted entry of the scene.
+func (st *SceneStore) Load(ctx context.Context) ([]SceneEntry, error) {
+	w, err := st.kv.Watch(ctx, st.scene+".>", jetstream.IgnoreDeletes())
+	if err != nil {
+		return nil, err
+	}
+	defer w.Stop()
+	return readInitial(ctx, w)
+}
+
+// Watch reads every persisted entry of the scene like Load, then keeps
+// calling onChange with the entries other replicas put or delete, until Stop
+// is called. Deleted entries have no data.
+func (st *SceneStore) Watch(ctx context.Context, onChange func(entry SceneEntry, deleted bool)) ([]SceneEntry, error) {
+	// The watcher outlives ctx, which only bounds reading the initial values.
+	w, err := st.kv.Watch(context.Background(), st.scene+".>")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readInitial(ctx, w)
+	if err != nil {
+		w.Stop()
+		return nil, err
+	}
+	st.watcher = w
+	go func() {
+		// Updates is closed once the watcher is stopped.
+		for kve := range w.Updates() {
+			var stored storedEntry
+			if err := msgpack.Unmarshal(kve.Value(), &stored); err != nil {
+				st.onError(fmt.Errorf("unable to decode scene entry %s: %v", kve.Key(), err))
+				continue
+			}
+			if stored.Origin == st.origin {
+				continue
+			}
+			deleted := kve.Operation() != jetstream.KeyValuePut
+			if deleted {
+				stored.Data = nil
+			}
+			onChange(stored.SceneEntry, deleted)
+		}
+	}()
+	return entries, nil
+}
+
+// Stop stops watching the bucket for other replicas' changes.
+func (st *SceneStore) Stop() error {
+	if st.watcher == nil {
+		return nil
+	}
+	if err := st.watcher.Stop(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) && !errors.Is(err, nats.ErrBadSubscription) {
+		return err
+	}
+	return nil
+}
+
+// readInitial reads the values a watcher starts with, leaving out deleted keys.
+func readInitial(ctx context.Context, w jetstream.KeyWatcher) ([]SceneEntry, error) {
+	var entries []SceneEntry
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case kve := <-w.Updates():
+			// A nil entry marks the end of the initial values.
+			if kve == nil {
+				return entries, nil
+			}
+			if kve.Operation() != jetstream.KeyValuePut {
+				continue
+			}
+			var entry SceneEntry
+			if err := msgpack.Unmarshal(kve.Value(), &entry); err != nil {
+				return nil, fmt.Errorf("unable to decode scene entry %s: %v", kve.Key(), err)
+			}
+			entries = append(entries, entry)
+		}
+	}
+}
+
+// Flush waits until every Put has been acknowledged, or ctx expires.
+func (st *SceneStore) Flush(ctx context.Context) error {
+	select {
+	case <-st.js.PublishAsyncComplete():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// openSceneStore connects the scene state to its bucket, restores what was
+// persisted by a previous run and follows the changes other replicas make.
+func (s *Server) openSceneStore(ctx context.Context, cfg PersistenceConfig) error {
+	store, err := NewSceneStore(ctx, s.NATS, cfg, func(err error) {
+		s.Logger.Error("unable to persist scene state", "subsystem", "store", "error", err)
+	})
+	if err != nil {
+		return err
+	}
+	entries, err := store.Watch(ctx, s.applyStored)
+	if err != nil {
+		return fmt.Errorf("unable to load scene %s: %v", cfg.Scene, err)
+	}
+	s.Scene.Reset(entries)
+	s.store = store
+	s.Logger.Info("restored scene", "subsystem", "store", "bucket", cfg.Bucket, "scene", cfg.Scene, "entries", len(entries))
+	return nil
+}
+
+// dispatch applies an encoded command to the scene state, persists the
+// change and forwards the command to the viewers.
+func (s *Server) dispatch(key SceneKey, data []byte) error {
+	removed := s.Scene.Apply(key, data)
+	if s.store != nil {
+		var err error
+		if key.Type == "delete" {
+			err = s.store.Delete(removed)
+		} else if _, ok := statefulCommands[key.Type]; ok {
+			err = s.store.Put(SceneEntry{SceneKey: key.normalized(), Data: data})
+		}
+		if err != nil {
+			s.Logger.Error("unable to persist scene state", "subsystem", "store", "command", key.Type, "path", key.Path, "error", err)
+		}
+	}
+	return s.Hub.WriteCommand(key.Type, data)
+}
+
+// applyStored applies a change another replica persisted to the scene state
+// and forwards it to the viewers. A deleted entry deletes its whole path, as
+// the other replica's delete did; the first of its keys to arrive does it.
+func (s *Server) applyStored(entry SceneEntry, deleted bool) {
+	if !deleted {
+		s.Scene.Apply(entry.SceneKey, entry.Data)
+		s.Hub.WriteCommand(entry.Type, entry.Data)
+		return
+	}
+	if removed := s.Scene.Apply(SceneKey{Type: "delete", Path: entry.Path}, nil); len(removed) == 0 {
+		return
+	}
+	b, err := msgpack.Marshal(Delete{Command{Type: "delete", Path: entry.Path}})
+	if err != nil {
+		s.Logger.Error("unable to encode delete", "subsystem", "store", "path", entry.Path, "error", err)
+		return
+	}
+	s.Hub.WriteCommand("delete", b)
+}
+
+// LoadPersistedScene reads the persisted scene without starting a server,
+// e.g. to export it. With embedded NATS the server must not be running, since
+// it holds the JetStream store.
+func LoadPersistedScene(ctx context.Context, cfg Config) ([]SceneEntry, error) {
+	if !cfg.Persistence.Enabled {
+		return nil, fmt.Errorf("scene persistence is not enabled")
+	}
+	url := cfg.NATS.URL
+	if cfg.NATS.Embedded.Enabled {
+		ns, err := StartEmbeddedNATS(cfg.NATS.Embedded)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			ns.Shutdown()
+			ns.WaitForShutdown()
+		}()
+		url = ns.ClientURL()
+	}
+	nc, err := nats.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+	store, err := NewSceneStore(ctx, nc, cfg.Persistence, func(error) {})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scene := NewSceneState()
+	scene.Reset(entries)
+	return scene.Snapshot(), nil
+}
@@ -4,60 +4,186 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff"
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
+	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 	"github.com/pkg/errors"
+	"google.golang.org/grpc"
 )
 
 type Server struct {
 	Router *echo.Echo
 	NATS   *nats.Conn
-	Hub    *Hub
-	Logger *slog.Logger
-	Q      WorkQueue
+	// NATSServer is the embedded NATS server, nil when connecting to an external one.
+	NATSServer *server.Server
+	Hub        *Hub
+	Logger     *slog.Logger
+	Q          WorkQueue
+	WS         WSConfig
+	Auth       AuthConfig
+	HTTP       HTTPConfig
+	GRPC       GRPCConfig
+	ROS        ROSConfig
+	Vehicles   map[string]VehicleConfig
+	// Scene is the latest state of the scene, replayed to viewers as they connect.
+	Scene *SceneState
+	// Recordings records viewer traffic and NATS inputs to session files.
+	Recordings *Recordings
+	Metrics    *Metrics
+	// Sim simulates the vehicles driven by control commands, nil if disabled.
+	Sim *Sim
+	// Clock is the simulation time missions, playbacks and Sim run on.
+	Clock *Clock
+
+	// store persists Scene, nil unless persistence is enabled.
+	store    *SceneStore
+	upgrader *websocket.Upgrader
+	redirect *http.Server
+	grpc     *grpc.Server
+	// grpcQuit is closed to end the gRPC event streams on shutdown.
+	grpcQuit chan struct{}
+	link     linkMonitor
+	recorder atomic.Pointer[Recorder]
+	// logSampler rate-limits the per-message debug logs.
+	logSampler *logSampler
+	// rosFrames is the ROS TF tree, which nests frames under their parents.
+	rosFrames rosFrames
+
+	playbacksMu sync.Mutex
+	playbacks   map[string]*Playback
+	missionsMu  sync.Mutex
+	missions    map[string]*missionRun
+	subsMu      sync.Mutex
+	subs        []*subscription
 }
 
-func NewServer(ctx context.Context) (*Server, error) {
-	r := echo.New()
-	nc, err := nats_connect()
-	if err != nil {
-		return nil, err
+// NATSConfig configures the connection to the NATS server.
+type NATSConfig struct {
+	URL string `env:"NATS_URL" flag:"nats-url" desc:"NATS server URL" yaml:"url" toml:"url"`
+	// MaxConnectRetries bounds the connection attempts at startup, 0 retries until MaxConnectTime.
+	MaxConnectRetries int `env:"MAX_NATS_CONNECT_RETRIES" flag:"nats-connect-retries" desc:"connection attempts at startup, 0 for no limit" yaml:"max_connect_retries" toml:"max_connect_retries"`
+	// MaxConnectTime bounds the total time spent retrying at startup.
+	MaxConnectTime time.Duration `env:"NATS_MAX_CONNECT_TIME" yaml:"max_connect_time" toml:"max_connect_time"`
+	// MaxReconnects bounds reconnect attempts after the connection is lost, -1 retries forever.
+	MaxReconnects int           `env:"NATS_MAX_RECONNECTS" yaml:"max_reconnects" toml:"max_reconnects"`
+	ReconnectWait time.Duration `env:"NATS_RECONNECT_WAIT" yaml:"reconnect_wait" toml:"reconnect_wait"`
+	// ReconnectBufSize is the number of bytes of publishes buffered while reconnecting.
+	ReconnectBufSize int `env:"NATS_RECONNECT_BUFFER_SIZE" yaml:"reconnect_buffer_size" toml:"reconnect_buffer_size"`
+	// Embedded runs a NATS server in-process; URL is then ignored.
+	Embedded EmbeddedNATSConfig `yaml:"embedded" toml:"embedded"`
+}
+
+func DefaultNATSConfig() NATSConfig {
+	return NATSConfig{
+		URL:              nats.DefaultURL,
+		MaxConnectTime:   1 * time.Minute,
+		MaxReconnects:    -1,
+		ReconnectWait:    2 * time.Second,
+		ReconnectBufSize: 8 * 1024 * 1024,
+		Embedded:         DefaultEmbeddedNATSConfig(),
 	}
+}
 
+func NewServer(ctx context.Context, cfg Config) (*Server, error) {
 	s := &Server{
-		Router: r,
-		NATS:   nc,
+		Router:   echo.New(),
+		Hub:      NewHub(),
+		Logger:   NewLogger(cfg.Log, os.Stdout),
+		WS:       cfg.WS,
+		Auth:     cfg.Auth,
+		HTTP:     cfg.HTTP,
+		GRPC:     cfg.GRPC,
+		ROS:      cfg.ROS,
+		Vehicles: cfg.Vehicles,
+		grpcQuit: make(chan struct{}),
+		Scene:    NewSceneState(),
+		upgrader: newUpgrader(cfg.WS, cfg.Auth),
+
+		logSampler: newLogSampler(cfg.Log.SampleInterval),
+	}
+	s.Recordings = NewRecordings(cfg.Recording, s.setRecorder, s.Scene.Snapshot)
+	s.Metrics = NewMetrics()
+	s.Hub.metrics = s.Metrics
+	if cfg.NATS.Embedded.Enabled {
+		ns, err := StartEmbeddedNATS(cfg.NATS.Embedded)
+		if err != nil {
+			return nil, err
+		}
+		s.NATSServer = ns
+		cfg.NATS.URL = ns.ClientURL()
+	}
+	nc, err := nats_connect(cfg.NATS, s.natsOptions(cfg.NATS)...)
+	if err != nil {
+		if s.NATSServer != nil {
+			s.NATSServer.Shutdown()
+		}
+		return nil, err
+	}
+	s.NATS = nc
+	s.setLinkState(LinkConnected, nil, "telemetry link up")
+	if cfg.Persistence.Enabled {
+		if err := s.openSceneStore(ctx, cfg.Persistence); err != nil {
+			nc.Close()
+			if s.NATSServer != nil {
+				s.NATSServer.Shutdown()
+			}
+			return nil, err
+		}
+	}
+	s.Clock = NewClock(cfg.Clock, s.broadcastClock)
+	s.Clock.Start()
+	s.InitializeWorkQueue(cfg.Workers.Workers, cfg.Workers.QueueSize, nc)
+	s.Metrics.register(s)
+	if cfg.Sim.Step > 0 {
+		s.Sim = NewSim(cfg.Sim, cfg.Vehicles, s.Clock, s.publishSimPose)
+		s.Sim.Start()
 	}
-	s.InitializeWorkQueue(10, 100, nc)
-	s.Hub = NewHub()
-	s.Logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
 	s.Routes()
-	s.NATSSubscriptions()
+	if err := s.NATSSubscriptions(); err != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		s.Shutdown(shutdownCtx)
+		return nil, fmt.Errorf("unable to subscribe to meshcat subjects: %v", err)
+	}
+	if cfg.MQTT.Compat {
+		if err := s.restoreRetained(ctx, cfg.MQTT); err != nil {
+			s.Logger.Error("unable to restore MQTT retained messages", "subsystem", "mqtt", "error", err)
+		}
+	}
 	return s, nil
 }
 
-func nats_connect() (*nats.Conn, error) {
+// natsLogger returns the logger for a message received on a subscription.
+func (s *Server) natsLogger(msg *nats.Msg) *slog.Logger {
+	return s.Logger.With("subsystem", "nats", "subject", msg.Subject)
+}
+
+func nats_connect(cfg NATSConfig, opts ...nats.Option) (*nats.Conn, error) {
 	expBackoff := backoff.NewExponentialBackOff()
-	expBackoff.MaxElapsedTime = 1 * time.Minute // Maximum total retry time
-	var nc *nats.Conn
-	nats_url, err := Getenv("NATS_URL", nats.DefaultURL)
-	if err != nil {
-		return nil, err
+	expBackoff.MaxElapsedTime = cfg.MaxConnectTime // Maximum total retry time
+	var policy backoff.BackOff = expBackoff
+	if cfg.MaxConnectRetries > 0 {
+		policy = backoff.WithMaxRetries(expBackoff, uint64(cfg.MaxConnectRetries-1))
 	}
-	err = backoff.Retry(
+	var nc *nats.Conn
+	err := backoff.Retry(
 		func() (err error) {
-			nc, err = nats.Connect(nats_url)
+			nc, err = nats.Connect(cfg.URL, opts...)
 			if err != nil {
-				slog.Debug(fmt.Sprintf("failed to connect to NATS %v", err))
+				slog.Debug("failed to connect to NATS", "subsystem", "nats", "url", cfg.URL, "error", err)
 				return errors.Wrap(err, "failed to connect to NATS")
 			}
 			return nil
-		}, expBackoff)
+		}, policy)
 	if err != nil {
 		return nc, errors.Wrap(err, "failed to connect to NATS")
 	} else {
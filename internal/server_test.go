@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// newTestServer starts a Server backed by an embedded NATS server on a free
+// port, serving its router from an httptest server.
+func newTestServer(t *testing.T, configure ...func(*Config)) (*Server, *httptest.Server) {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.NATS.Embedded.Enabled = true
+	cfg.NATS.Embedded.Port = -1
+	cfg.NATS.Embedded.StoreDir = t.TempDir()
+	cfg.Workers.Workers = 2
+	for _, c := range configure {
+		c(&cfg)
+	}
+	s, err := NewServer(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	srv := httptest.NewServer(s.Router)
+	t.Cleanup(func() {
+		srv.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+	})
+	return s, srv
+}
+
+func dialViewer(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	// Give the hub a moment to register the client before publishing.
+	time.Sleep(20 * time.Millisecond)
+	return conn
+}
+
+// readCommand reads viewer messages until one of the given command type arrives.
+func readCommand(t *testing.T, conn *websocket.Conn, kind string, v interface{}) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", kind, err)
+		}
+		var cmd Command
+		if err := msgpack.Unmarshal(data, &cmd); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if cmd.Type != kind {
+			continue
+		}
+		if err := msgpack.Unmarshal(data, v); err != nil {
+			t.Fatalf("decode %s: %v", kind, err)
+		}
+		return
+	}
+}
+
+// readLinkStatus reads viewer messages until a NATS link status arrives,
+// skipping the clock's.
+func readLinkStatus(t *testing.T, conn *websocket.Conn, status *SetStatus) {
+	t.Helper()
+	for {
+		readCommand(t, conn, "set_object", status)
+		if status.Path == statusPath {
+			return
+		}
+	}
+}
+
+func TestEmbeddedNATSTransformReachesViewer(t *testing.T) {
+	s, srv := newTestServer(t)
+	conn := dialViewer(t, srv)
+
+	if err := s.NATS.Publish("meshcat.transformations.drone1.body", []byte(`{"translation": [1, 2, 3]}`)); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	var cmd SetTransformationCommand
+	readCommand(t, conn, "set_transform", &cmd)
+	if cmd.Path != "drone1/body" {
+		t.Errorf("got %s on %s; want set_transform on drone1/body", cmd.Type, cmd.Path)
+	}
+	if len(cmd.Object.Translation) != 3 || cmd.Object.Translation[2] != 3 {
+		t.Errorf("translation = %v", cmd.Object.Translation)
+	}
+}
+
+func TestNATSReconnectStatus(t *testing.T) {
+	s, srv := newTestServer(t, func(cfg *Config) {
+		cfg.NATS.ReconnectWait = 20 * time.Millisecond
+	})
+	conn := dialViewer(t, srv)
+	var status SetStatus
+	readLinkStatus(t, conn, &status)
+	if status.Object.Object.UserData.State != LinkConnected {
+		t.Fatalf("initial state = %s", status.Object.Object.UserData.State)
+	}
+
+	embedded := DefaultEmbeddedNATSConfig()
+	embedded.Port = s.NATSServer.Addr().(*net.TCPAddr).Port
+	embedded.StoreDir = s.NATSServer.StoreDir()
+	s.NATSServer.Shutdown()
+	s.NATSServer.WaitForShutdown()
+
+	readLinkStatus(t, conn, &status)
+	if status.Object.Object.UserData.State != LinkDisconnected || status.Object.Object.UserData.Message != "telemetry link lost" {
+		t.Fatalf("state after server shutdown = %+v", status.Object.Object.UserData)
+	}
+	rec := httptest.NewRecorder()
+	s.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	if !strings.Contains(rec.Body.String(), `"state":"disconnected"`) {
+		t.Errorf("GET /api/status = %s", rec.Body.String())
+	}
+
+	ns, err := StartEmbeddedNATS(embedded)
+	if err != nil {
+		t.Fatalf("restart embedded NATS: %v", err)
+	}
+	s.NATSServer = ns
+	readLinkStatus(t, conn, &status)
+	if status.Object.Object.UserData.State != LinkConnected || status.Object.Object.UserData.Reconnects != 1 {
+		t.Fatalf("state after restart = %+v", status.Object.Object.UserData)
+	}
+
+	// Subscriptions are back once the reconnect has been verified.
+	if err := s.NATS.FlushTimeout(time.Second); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	s.NATS.Publish("meshcat.transformations.drone1", []byte(`{"translation": [0, 0, 1]}`))
+	var cmd SetTransformationCommand
+	readCommand(t, conn, "set_transform", &cmd)
+	if cmd.Path != "drone1" {
+		t.Errorf("transform path after reconnect = %s", cmd.Path)
+	}
+}
+
+func TestScenePersistsAcrossRestart(t *testing.T) {
+	storeDir := t.TempDir()
+	persist := func(cfg *Config) {
+		cfg.NATS.Embedded.StoreDir = storeDir
+		cfg.Persistence.Enabled = true
+	}
+	s, _ := newTestServer(t, persist)
+	s.NATS.Publish("meshcat.transformations.drone1.body", []byte(`{"translation": [1, 2, 3]}`))
+	s.NATS.Publish("meshcat.transformations.drone2", []byte(`{"translation": [4, 5, 6]}`))
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Scene.Len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	restarted, srv := newTestServer(t, persist)
+	if restarted.Scene.Len() != 2 {
+		t.Fatalf("restored %d scene entries; want 2", restarted.Scene.Len())
+	}
+	conn := dialViewer(t, srv)
+	var cmd SetTransformationCommand
+	readCommand(t, conn, "set_transform", &cmd)
+	if cmd.Path != "drone1/body" || cmd.Object.Translation[0] != 1 {
+		t.Errorf("replayed %s on %s with %v", cmd.Type, cmd.Path, cmd.Object.Translation)
+	}
+}
+
+func TestSceneSharedBetweenReplicas(t *testing.T) {
+	primary, _ := newTestServer(t, func(cfg *Config) {
+		cfg.Persistence.Enabled = true
+	})
+	replica, srv := newTestServer(t, func(cfg *Config) {
+		cfg.NATS.Embedded.Enabled = false
+		cfg.NATS.URL = primary.NATSServer.ClientURL()
+		cfg.Persistence.Enabled = true
+	})
+	conn := dialViewer(t, srv)
+
+	if err := primary.apply(SetProperty{Command: Command{Type: "set_property", Path: "/drone1"}, Property: "visible", Value: false}); err != nil {
+		t.Fatal(err)
+	}
+	var prop SetProperty
+	readCommand(t, conn, "set_property", &prop)
+	if prop.Path != "/drone1" || replica.Scene.Len() != 1 {
+		t.Errorf("replica got %+v with %d scene entries", prop, replica.Scene.Len())
+	}
+
+	if err := primary.applyDelete("/drone1"); err != nil {
+		t.Fatal(err)
+	}
+	var del Delete
+	readCommand(t, conn, "delete", &del)
+	if del.Path != "/drone1" || replica.Scene.Len() != 0 {
+		t.Errorf("replica got %+v with %d scene entries", del, replica.Scene.Len())
+	}
+	// The primary does not apply its own changes a second time.
+	if n := primary.Scene.Len(); n != 0 {
+		t.Errorf("primary has %d scene entries", n)
+	}
+}
+
+func TestRecordSession(t *testing.T) {
+	dir := t.TempDir()
+	s, srv := newTestServer(t, func(cfg *Config) {
+		cfg.Recording.Dir = dir
+	})
+	msg, err := s.NATS.Request("meshcat.recording.start", []byte(`{"session": "bug-42"}`), time.Second)
+	if err != nil {
+		t.Fatalf("start request: %v", err)
+	}
+	var reply RecordingReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil || reply.Recording == nil {
+		t.Fatalf("start reply = %s, %v", msg.Data, err)
+	}
+
+	conn := dialViewer(t, srv)
+	s.NATS.Publish("meshcat.transformations.drone1", []byte(`{"translation": [0, 0, 1]}`))
+	var cmd SetTransformationCommand
+	readCommand(t, conn, "set_transform", &cmd)
+
+	resp, err := http.Post(srv.URL+"/api/recordings/stop", "application/json", nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("stop: %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	f, err := os.Open(filepath.Join(dir, "bug-42", reply.Recording.File))
+	if err != nil {
+		t.Fatalf("open recording: %v", err)
+	}
+	defer f.Close()
+	rr, err := NewRecordingReader(f)
+	if err != nil {
+		t.Fatalf("NewRecordingReader: %v", err)
+	}
+	seen := map[string]bool{}
+	for {
+		frame, err := rr.Next()
+		if err != nil {
+			break
+		}
+		seen[frame.Source+" "+frame.Subject] = true
+	}
+	for _, want := range []string{"nats meshcat.transformations.drone1", "viewer set_transform"} {
+		if !seen[want] {
+			t.Errorf("recording is missing %q, has %v", want, seen)
+		}
+	}
+}
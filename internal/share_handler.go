@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxShareLinkTTL = 30 * 24 * time.Hour
+
+type ShareLink struct {
+	URL     string    `json:"url"`
+	Role    string    `json:"role"`
+	Expires time.Time `json:"expires"`
+}
+
+// ShareLinkHandler issues a signed viewer link, e.g. `GET /api/share?role=viewer&ttl=24h`.
+func (s *Server) ShareLinkHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.Auth.ShareSecret == "" {
+			return echo.NewHTTPError(http.StatusNotFound, "share links are not enabled")
+		}
+		role := RoleViewer
+		if v := c.QueryParam("role"); v != "" {
+			var err error
+			if role, err = ParseRole(v); err != nil || role == RoleNone {
+				return echo.NewHTTPError(http.StatusBadRequest, "role must be viewer or control")
+			}
+		}
+		ttl := 24 * time.Hour
+		if v := c.QueryParam("ttl"); v != "" {
+			var err error
+			if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 || ttl > maxShareLinkTTL {
+				return echo.NewHTTPError(http.StatusBadRequest, "ttl must be a positive duration of at most 720h")
+			}
+		}
+		expires := time.Now().Add(ttl).Truncate(time.Second)
+		token := ShareLinkAuth{Secret: []byte(s.Auth.ShareSecret)}.NewShareToken(role, expires)
+		link := url.URL{
+			Scheme:   c.Scheme(),
+			Host:     c.Request().Host,
+			Path:     "/",
+			RawQuery: url.Values{shareParam: {token}}.Encode(),
+		}
+		return c.JSON(http.StatusOK, ShareLink{URL: link.String(), Role: role.String(), Expires: expires})
+	}
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Shutdown stops the server in dependency order, giving up on whatever is
+// left once ctx expires:
+//
+//  1. stop accepting HTTP requests and websocket upgrades,
+//  2. send close frames to the connected viewers,
+//  3. drain the NATS subscriptions so no new commands or missions arrive,
+//  4. stop the vehicle simulation and the clock broadcasts,
+//  5. let in-flight missions finish, cancelling them at the deadline,
+//  6. close the active session recording,
+//  7. stop following other replicas' scene changes and wait for the persisted
+//     scene state to be acknowledged,
+//  8. drain the NATS connection so mission publishes are flushed, and close it,
+//  9. stop the embedded NATS server, if any.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if s.redirect != nil {
+		if err := s.redirect.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("redirect listener: %w", err))
+		}
+	}
+	if s.Router != nil {
+		if err := s.Router.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("http server: %w", err))
+		}
+	}
+	if err := s.stopGRPC(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("grpc server: %w", err))
+	}
+	if s.Hub != nil {
+		if err := s.Hub.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("websocket clients: %w", err))
+		}
+	}
+	if err := s.drainSubscriptions(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("nats subscriptions: %w", err))
+	}
+	s.Sim.Stop()
+	s.Clock.Stop()
+	if err := s.Q.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("work queue: %w", err))
+	}
+	if s.Recordings != nil {
+		if err := s.Recordings.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("recording: %w", err))
+		}
+	}
+	if s.store != nil {
+		if err := s.store.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("scene store watcher: %w", err))
+		}
+		if err := s.store.Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("scene store: %w", err))
+		}
+	}
+	if s.NATS != nil {
+		if err := drainConn(ctx, s.NATS); err != nil {
+			errs = append(errs, fmt.Errorf("nats connection: %w", err))
+		}
+	}
+	if s.NATSServer != nil {
+		s.NATSServer.Shutdown()
+		s.NATSServer.WaitForShutdown()
+	}
+	return errors.Join(errs...)
+}
+
+// drainSubscriptions unsubscribes from every subject, letting callbacks for
+// messages already received complete.
+func (s *Server) drainSubscriptions(ctx context.Context) error {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	for _, tracked := range s.subs {
+		if err := tracked.sub.Drain(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) && !errors.Is(err, nats.ErrBadSubscription) {
+			return err
+		}
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for _, tracked := range s.subs {
+		for tracked.sub.IsValid() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	}
+	return nil
+}
+
+// drainConn drains nc and waits for it to close, closing it outright if ctx expires.
+func drainConn(ctx context.Context, nc *nats.Conn) error {
+	if nc.IsClosed() {
+		return nil
+	}
+	closed := make(chan struct{})
+	nc.SetClosedHandler(func(*nats.Conn) { close(closed) })
+	if err := nc.Drain(); err != nil {
+		nc.Close()
+		return err
+	}
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		nc.Close()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,385 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/friend0/transformations"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// gravity is the gravitational acceleration in m/s².
+	gravity = 9.81
+	// maxSteering bounds the steering angle of a bicycle, in radians.
+	maxSteering = math.Pi / 3
+	// attitudeLag is the time constant in seconds with which a quadrotor
+	// reaches a commanded attitude.
+	attitudeLag = 0.1
+	// quadrotorDrag is the linear drag of a quadrotor, in 1/s.
+	quadrotorDrag = 0.3
+)
+
+// SimConfig configures the vehicle dynamics simulation. The vehicles it
+// simulates are the ones with a model in the vehicles config, and those
+// spawned by a control command.
+type SimConfig struct {
+	// Step is the fixed integration step, 0 to disable the simulation.
+	Step time.Duration `env:"MESHCAT_SIM_STEP" flag:"sim-step" desc:"vehicle simulation step, 0 disables the simulation" yaml:"step" toml:"step"`
+	// CommandTimeout is how long a control command holds. A vehicle not
+	// commanded since gets the zero command, stopping or, for a quadrotor,
+	// cutting its thrust.
+	CommandTimeout time.Duration `env:"MESHCAT_SIM_COMMAND_TIMEOUT" flag:"sim-command-timeout" desc:"time a vehicle control command holds" yaml:"command_timeout" toml:"command_timeout"`
+}
+
+func DefaultSimConfig() SimConfig {
+	return SimConfig{Step: 10 * time.Millisecond, CommandTimeout: 500 * time.Millisecond}
+}
+
+func (cfg SimConfig) Validate() error {
+	if cfg.Step < 0 || cfg.CommandTimeout <= 0 {
+		return fmt.Errorf("invalid simulation timing: step %v, command timeout %v", cfg.Step, cfg.CommandTimeout)
+	}
+	return nil
+}
+
+// ControlCommand drives a simulated vehicle, published on
+// `meshcat.control.<path>`. Every model reads its own fields.
+type ControlCommand struct {
+	// Model spawns the vehicle, at Position, if it is not simulated yet.
+	Model    string    `json:"model,omitempty"`
+	Position []float64 `json:"position,omitempty"`
+	// Velocity [vx, vy, vz] in m/s drives a point mass, or Acceleration in
+	// m/s² if Velocity is unset.
+	Velocity     []float64 `json:"velocity,omitempty"`
+	Acceleration []float64 `json:"acceleration,omitempty"`
+	// Speed in m/s drives a unicycle, turning at YawRate in rad/s, or a
+	// bicycle, steering at Steering rad.
+	Speed    float64 `json:"speed,omitempty"`
+	YawRate  float64 `json:"yaw_rate,omitempty"`
+	Steering float64 `json:"steering,omitempty"`
+	// Thrust in N drives a quadrotor, tilting to Attitude [roll, pitch, yaw]
+	// in rad, or level if it is unset.
+	Thrust   float64   `json:"thrust,omitempty"`
+	Attitude []float64 `json:"attitude,omitempty"`
+}
+
+func (c ControlCommand) validate() error {
+	var errs []error
+	for name, v := range map[string][]float64{"position": c.Position, "velocity": c.Velocity, "acceleration": c.Acceleration, "attitude": c.Attitude} {
+		if v != nil && len(v) != 3 {
+			errs = append(errs, fmt.Errorf("%s must have 3 values, got %d", name, len(v)))
+		}
+	}
+	if c.Thrust < 0 {
+		errs = append(errs, fmt.Errorf("thrust must not be negative, got %v", c.Thrust))
+	}
+	return errors.Join(errs...)
+}
+
+// VehicleState is the state of a simulated vehicle.
+type VehicleState struct {
+	Path     string     `json:"path"`
+	Model    string     `json:"model"`
+	Position [3]float64 `json:"position"`
+	Velocity [3]float64 `json:"velocity"`
+	// Attitude is [roll, pitch, yaw] in rad.
+	Attitude [3]float64 `json:"attitude"`
+}
+
+// ControlReply is the response to control commands.
+type ControlReply struct {
+	State *VehicleState `json:"state,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// vehicleModels advance a vehicle's state by dt seconds under a command.
+var vehicleModels = map[string]func(s *VehicleState, v VehicleConfig, c ControlCommand, dt float64){
+	"point_mass": stepPointMass,
+	"unicycle":   stepUnicycle,
+	"bicycle":    stepBicycle,
+	"quadrotor":  stepQuadrotor,
+}
+
+func stepPointMass(s *VehicleState, _ VehicleConfig, c ControlCommand, dt float64) {
+	for axis := range s.Velocity {
+		switch {
+		case c.Velocity != nil:
+			s.Velocity[axis] = c.Velocity[axis]
+		case c.Acceleration != nil:
+			s.Velocity[axis] += c.Acceleration[axis] * dt
+		}
+		s.Position[axis] += s.Velocity[axis] * dt
+	}
+}
+
+// stepUnicycle drives a differential drive robot, turning on the spot.
+func stepUnicycle(s *VehicleState, _ VehicleConfig, c ControlCommand, dt float64) {
+	s.Attitude[2] = wrapAngle(s.Attitude[2] + c.YawRate*dt)
+	driveForward(s, c.Speed, dt)
+}
+
+// stepBicycle drives a car-like vehicle, turning about its rear axle.
+func stepBicycle(s *VehicleState, v VehicleConfig, c ControlCommand, dt float64) {
+	steering := math.Max(-maxSteering, math.Min(maxSteering, c.Steering))
+	s.Attitude[2] = wrapAngle(s.Attitude[2] + c.Speed/limitOr(v.Wheelbase, 1)*math.Tan(steering)*dt)
+	driveForward(s, c.Speed, dt)
+}
+
+// driveForward moves a ground vehicle along its heading.
+func driveForward(s *VehicleState, speed, dt float64) {
+	yaw := s.Attitude[2]
+	s.Velocity = [3]float64{speed * math.Cos(yaw), speed * math.Sin(yaw), 0}
+	s.Position[0] += s.Velocity[0] * dt
+	s.Position[1] += s.Velocity[1] * dt
+}
+
+// stepQuadrotor flies a quadrotor whose attitude controller follows the
+// commanded attitude with a lag, thrusting along its body z axis. It rests
+// on the ground at z = 0.
+func stepQuadrotor(s *VehicleState, v VehicleConfig, c ControlCommand, dt float64) {
+	target := [3]float64{0, 0, s.Attitude[2]}
+	if c.Attitude != nil {
+		target = [3]float64(c.Attitude)
+	}
+	blend := 1 - math.Exp(-dt/attitudeLag)
+	for axis := range s.Attitude {
+		s.Attitude[axis] = wrapAngle(s.Attitude[axis] + wrapAngle(target[axis]-s.Attitude[axis])*blend)
+	}
+	roll, pitch, yaw := s.Attitude[0], s.Attitude[1], s.Attitude[2]
+	thrust := c.Thrust / limitOr(v.Mass, 1)
+	accel := [3]float64{
+		thrust * (math.Cos(yaw)*math.Sin(pitch)*math.Cos(roll) + math.Sin(yaw)*math.Sin(roll)),
+		thrust * (math.Sin(yaw)*math.Sin(pitch)*math.Cos(roll) - math.Cos(yaw)*math.Sin(roll)),
+		thrust*math.Cos(pitch)*math.Cos(roll) - gravity,
+	}
+	for axis := range s.Velocity {
+		s.Velocity[axis] += (accel[axis] - quadrotorDrag*s.Velocity[axis]) * dt
+		s.Position[axis] += s.Velocity[axis] * dt
+	}
+	if s.Position[2] <= 0 {
+		s.Position[2] = 0
+		s.Velocity = [3]float64{0, 0, math.Max(s.Velocity[2], 0)}
+	}
+}
+
+// wrapAngle wraps a to [-π, π).
+func wrapAngle(a float64) float64 {
+	return a - 2*math.Pi*math.Floor((a+math.Pi)/(2*math.Pi))
+}
+
+// pose is the position and, unless it is a point mass, the orientation of
+// the vehicle.
+func (s VehicleState) pose() []float64 {
+	if s.Model == "point_mass" {
+		return s.Position[:]
+	}
+	q, _ := transformations.EulerToQuaternion(s.Attitude)
+	return append(s.Position[:], q...)
+}
+
+type simVehicle struct {
+	state     VehicleState
+	config    VehicleConfig
+	command   ControlCommand
+	commanded time.Time
+	// published is the last pose published, to publish changes only.
+	published []float64
+}
+
+// Sim integrates the vehicle models at a fixed step, publishing the poses
+// of the vehicles that moved.
+type Sim struct {
+	cfg SimConfig
+	// clock is the time the simulation steps on.
+	clock *Clock
+	// publish sets the pose of the vehicle at path.
+	publish func(path string, pose []float64)
+
+	mu       sync.Mutex
+	vehicles map[string]*simVehicle
+	// configs are the configured vehicles, which may set a vehicle's model
+	// and its parameters.
+	configs map[string]VehicleConfig
+	// started is set between Start and Stop. The stepping itself only runs,
+	// with cancel and done set, once there is a vehicle to step.
+	started bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewSim creates the simulation of the vehicles with a model in vehicles,
+// stepping on clock.
+func NewSim(cfg SimConfig, vehicles map[string]VehicleConfig, clock *Clock, publish func(path string, pose []float64)) *Sim {
+	sim := &Sim{cfg: cfg, clock: clock, publish: publish, vehicles: map[string]*simVehicle{}, configs: vehicles}
+	for path, v := range vehicles {
+		if v.Model != "" {
+			sim.spawn(path, v, v.Position)
+		}
+	}
+	return sim
+}
+
+// spawn starts simulating the vehicle at path, at rest at position.
+func (sim *Sim) spawn(path string, v VehicleConfig, position []float64) *simVehicle {
+	vehicle := &simVehicle{state: VehicleState{Path: path, Model: v.Model}, config: v}
+	if position != nil {
+		vehicle.state.Position = [3]float64(position)
+	}
+	sim.vehicles[path] = vehicle
+	if sim.started && sim.cancel == nil {
+		sim.run()
+	}
+	return vehicle
+}
+
+// Start steps the simulation in the background until Stop, once every Step
+// of the clock's time, so it slows down, speeds up and pauses with it. Until
+// the first vehicle is spawned there is nothing to step, and nothing runs.
+func (sim *Sim) Start() {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.started = true
+	if len(sim.vehicles) > 0 && sim.cancel == nil {
+		sim.run()
+	}
+}
+
+// run starts stepping the simulation. sim.mu must be held.
+func (sim *Sim) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	sim.cancel, sim.done = cancel, make(chan struct{})
+	go func() {
+		defer close(sim.done)
+		next := sim.clock.Now()
+		for {
+			next = next.Add(sim.cfg.Step)
+			if !sim.clock.SleepUntil(ctx, next) {
+				return
+			}
+			sim.Advance(next)
+		}
+	}()
+}
+
+// Stop stops stepping the simulation.
+func (sim *Sim) Stop() {
+	if sim == nil {
+		return
+	}
+	sim.mu.Lock()
+	cancel, done := sim.cancel, sim.done
+	sim.started, sim.cancel, sim.done = false, nil, nil
+	sim.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Advance steps every vehicle once, at time now, and publishes those that
+// moved.
+func (sim *Sim) Advance(now time.Time) {
+	type update struct {
+		path string
+		pose []float64
+	}
+	var updates []update
+	sim.mu.Lock()
+	for path, vehicle := range sim.vehicles {
+		command := vehicle.command
+		if now.Sub(vehicle.commanded) > sim.cfg.CommandTimeout {
+			command = ControlCommand{}
+		}
+		vehicleModels[vehicle.state.Model](&vehicle.state, vehicle.config, command, sim.cfg.Step.Seconds())
+		if pose := vehicle.state.pose(); !slices.Equal(pose, vehicle.published) {
+			vehicle.published = pose
+			updates = append(updates, update{path, pose})
+		}
+	}
+	sim.mu.Unlock()
+	for _, u := range updates {
+		sim.publish(u.path, u.pose)
+	}
+}
+
+// Control commands the vehicle at path from now on, spawning it if the
+// command or the vehicle's config sets its model.
+func (sim *Sim) Control(path string, c ControlCommand, now time.Time) (VehicleState, error) {
+	if err := c.validate(); err != nil {
+		return VehicleState{}, err
+	}
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	vehicle := sim.vehicles[path]
+	if vehicle == nil {
+		v := sim.configs[path]
+		if c.Model != "" {
+			v.Model = c.Model
+		}
+		if _, ok := vehicleModels[v.Model]; !ok {
+			return VehicleState{}, fmt.Errorf("no simulated vehicle at %s; spawn one with a model of %s", path, simModelNames)
+		}
+		position := c.Position
+		if position == nil {
+			position = v.Position
+		}
+		vehicle = sim.spawn(path, v, position)
+	}
+	vehicle.command, vehicle.commanded = c, now
+	return vehicle.state, nil
+}
+
+const simModelNames = "point_mass, unicycle, bicycle or quadrotor"
+
+// controlSubscription serves the control commands on `meshcat.control.<path>`,
+// replying with the vehicle's state.
+func (s *Server) controlSubscription() (*nats.Subscription, error) {
+	if s.Sim == nil {
+		return nil, nil
+	}
+	sub, err := s.NATS.Subscribe("meshcat.control.>", s.observed(s.handleControl))
+	if err != nil {
+		s.Logger.Error("unable to subscribe", "subsystem", "nats", "subject", "meshcat.control.>", "error", err)
+	}
+	return sub, err
+}
+
+func (s *Server) handleControl(msg *nats.Msg) {
+	logger := s.natsLogger(msg)
+	path := subjectPath(msg.Subject, "meshcat.control.")
+	var reply ControlReply
+	var c ControlCommand
+	if err := json.Unmarshal(msg.Data, &c); err != nil {
+		reply.Error = fmt.Sprintf("invalid control command: %v", err)
+	} else if state, err := s.Sim.Control(path, c, s.Clock.Now()); err != nil {
+		reply.Error = err.Error()
+	} else {
+		reply.State = &state
+	}
+	if reply.Error != "" {
+		logger.Warn("control command failed", "path", path, "error", reply.Error)
+	}
+	if msg.Reply == "" {
+		return
+	}
+	b, _ := json.Marshal(reply)
+	if err := msg.Respond(b); err != nil {
+		logger.Error("unable to reply", "error", err)
+	}
+}
+
+// publishSimPose publishes the pose of a simulated vehicle through the
+// transformation pipeline, as missions do.
+func (s *Server) publishSimPose(path string, pose []float64) {
+	w := NatsMissionWriter{Conn: s.NATS, Path: pathSubject("meshcat.transformations.", path)}
+	if err := transform_publisher(pose, w); err != nil {
+		s.Logger.Error("unable to publish vehicle pose", "subsystem", "sim", "path", path, "error", err)
+	}
+}
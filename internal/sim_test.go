@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// simulate steps a vehicle of model for seconds under command c.
+func simulate(model string, v VehicleConfig, c ControlCommand, seconds float64) VehicleState {
+	const dt = 0.001
+	s := VehicleState{Model: model}
+	for range int(math.Round(seconds / dt)) {
+		vehicleModels[model](&s, v, c, dt)
+	}
+	return s
+}
+
+func TestVehicleModels(t *testing.T) {
+	near := func(got, want []float64, tolerance float64) bool {
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > tolerance {
+				return false
+			}
+		}
+		return true
+	}
+
+	if s := simulate("point_mass", VehicleConfig{}, ControlCommand{Velocity: []float64{1, 2, 0}}, 1); !near(s.Position[:], []float64{1, 2, 0}, 1e-9) {
+		t.Errorf("point mass at velocity: %+v", s)
+	}
+	if s := simulate("point_mass", VehicleConfig{}, ControlCommand{Acceleration: []float64{0, 0, 2}}, 1); !near(s.Position[:], []float64{0, 0, 1}, 1e-2) {
+		t.Errorf("point mass accelerating: %+v", s)
+	}
+
+	// A quarter turn on a circle of radius 2/π.
+	if s := simulate("unicycle", VehicleConfig{}, ControlCommand{Speed: 1, YawRate: math.Pi / 2}, 1); !near(s.Position[:], []float64{2 / math.Pi, 2 / math.Pi, 0}, 1e-3) || math.Abs(s.Attitude[2]-math.Pi/2) > 1e-9 {
+		t.Errorf("unicycle: %+v", s)
+	}
+	// Steering at 45° on a 2 m wheelbase turns at half a radian per second.
+	if s := simulate("bicycle", VehicleConfig{Wheelbase: 2}, ControlCommand{Speed: 1, Steering: math.Pi / 4}, 1); math.Abs(s.Attitude[2]-0.5) > 1e-9 {
+		t.Errorf("bicycle: %+v", s)
+	}
+	// Steering is limited.
+	if s := simulate("bicycle", VehicleConfig{}, ControlCommand{Speed: 1, Steering: 3}, 0.1); math.Abs(s.Attitude[2]-0.1*math.Tan(maxSteering)) > 1e-9 {
+		t.Errorf("bicycle steering past the limit: %+v", s)
+	}
+
+	quad := VehicleConfig{Mass: 2}
+	if s := simulate("quadrotor", quad, ControlCommand{}, 1); s.Position != [3]float64{} {
+		t.Errorf("quadrotor without thrust left the ground: %+v", s)
+	}
+	if s := simulate("quadrotor", quad, ControlCommand{Thrust: 2 * 2 * gravity}, 1); s.Position[2] < 4 || s.Position[2] > gravity/2 {
+		t.Errorf("quadrotor climbing at 1 g: %+v", s)
+	}
+	// Pitched forward at twice its weight, it accelerates along +x.
+	s := simulate("quadrotor", quad, ControlCommand{Thrust: 2 * 2 * gravity, Attitude: []float64{0, 0.3, 0}}, 1)
+	if s.Position[0] <= 0 || math.Abs(s.Position[1]) > 1e-9 || math.Abs(s.Attitude[1]-0.3) > 1e-3 {
+		t.Errorf("pitched quadrotor: %+v", s)
+	}
+}
+
+func TestSimCommandTimeout(t *testing.T) {
+	var published [][]float64
+	sim := NewSim(SimConfig{Step: 100 * time.Millisecond, CommandTimeout: 300 * time.Millisecond}, nil, nil, func(path string, pose []float64) {
+		published = append(published, pose)
+	})
+	if _, err := sim.Control("rover", ControlCommand{Speed: 1}, time.Now()); err == nil {
+		t.Error("controlled a vehicle without a model")
+	}
+	start := time.Now()
+	if _, err := sim.Control("rover", ControlCommand{Model: "unicycle", Speed: 1}, start); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 6 {
+		sim.Advance(start.Add(time.Duration(i) * 100 * time.Millisecond))
+	}
+	// Driven for 4 steps, then stopped and no longer published.
+	if len(published) != 4 || math.Abs(published[3][0]-0.4) > 1e-9 {
+		t.Errorf("published %v", published)
+	}
+}
+
+func TestSimControl(t *testing.T) {
+	s, _ := newTestServer(t, func(cfg *Config) {
+		cfg.Vehicles = map[string]VehicleConfig{"car": {Model: "bicycle", Position: []float64{1, 2, 0}}}
+	})
+	msg, err := s.NATS.Request("meshcat.control.car", []byte(`{"speed": 2}`), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply ControlReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil || reply.State == nil || reply.State.Model != "bicycle" {
+		t.Fatalf("reply %s: %v", msg.Data, err)
+	}
+	waitFor(t, func() bool {
+		for _, entry := range s.Scene.Snapshot() {
+			if entry.Path == "/car" {
+				translation, _ := sceneTransform(t, s, "/car")
+				return translation[0] > 1 && translation[1] == 2
+			}
+		}
+		return false
+	})
+
+	msg, err = s.NATS.Request("meshcat.control.ghost", []byte(`{"speed": 2}`), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(msg.Data, &reply); err != nil || reply.Error == "" {
+		t.Errorf("controlled a vehicle without a model: %s", msg.Data)
+	}
+}
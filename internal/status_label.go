@@ -0,0 +1,68 @@
+package internal
+
+import "github.com/google/uuid"
+
+// statusRoot is the scene path the server's status labels live under.
+const statusRoot = "/meshcat/status"
+
+// StatusLabel is a three.js object showing a line of text on a plane, drawn
+// with the viewer's "_text" texture. The status it shows is kept, structured,
+// in the object's userData.
+type StatusLabel[T any] struct {
+	Metadata   SceneMetadata        `json:"metadata" msgpack:"metadata"`
+	Geometries []LabelGeometry      `json:"geometries" msgpack:"geometries"`
+	Textures   []TextTexture        `json:"textures" msgpack:"textures"`
+	Materials  []LabelMaterial      `json:"materials" msgpack:"materials"`
+	Object     StatusLabelObject[T] `json:"object" msgpack:"object"`
+}
+
+type StatusLabelObject[T any] struct {
+	Object
+	UserData T `json:"userData" msgpack:"userData"`
+}
+
+// LabelGeometry is the plane a label's text is drawn on.
+type LabelGeometry struct {
+	SceneElement
+	Width  float32 `json:"width" msgpack:"width"`
+	Height float32 `json:"height" msgpack:"height"`
+}
+
+// TextTexture renders text onto a canvas in the viewer.
+type TextTexture struct {
+	SceneElement
+	Text     string `json:"text" msgpack:"text"`
+	FontSize int    `json:"font_size" msgpack:"font_size"`
+	FontFace string `json:"font_face" msgpack:"font_face"`
+}
+
+type LabelMaterial struct {
+	SceneElement
+	Map         string `json:"map" msgpack:"map"`
+	Transparent bool   `json:"transparent" msgpack:"transparent"`
+	Side        int    `json:"side" msgpack:"side"`
+}
+
+// newStatusLabel builds a label showing text, standing upright at the given
+// height above the origin.
+func newStatusLabel[T any](text string, height float32, status T) StatusLabel[T] {
+	geometry := uuid.NewString()
+	texture := uuid.NewString()
+	material := uuid.NewString()
+	return StatusLabel[T]{
+		Metadata:   default_scene_metadata(),
+		Geometries: []LabelGeometry{{SceneElement: SceneElement{Uuid: geometry, Type: "PlaneGeometry"}, Width: 2, Height: 0.25}},
+		Textures:   []TextTexture{{SceneElement: SceneElement{Uuid: texture, Type: "_text"}, Text: text, FontSize: 48, FontFace: "sans-serif"}},
+		Materials:  []LabelMaterial{{SceneElement: SceneElement{Uuid: material, Type: "MeshBasicMaterial"}, Map: texture, Transparent: true, Side: 2}},
+		Object: StatusLabelObject[T]{
+			Object: Object{
+				SceneElement: SceneElement{Uuid: uuid.NewString(), Type: "Mesh"},
+				GeometryUUID: geometry,
+				MaterialUUID: material,
+				// The plane is turned from the xy into the xz plane, to face the default camera.
+				Matrix: []float32{1, 0, 0, 0, 0, 0, 1, 0, 0, -1, 0, 0, 0, 0, height, 1},
+			},
+			UserData: status,
+		},
+	}
+}
@@ -0,0 +1,308 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/friend0/transformations"
+)
+
+// Heading sets the yaw of a mission's poses. Vehicles turn about the vertical
+// axis only, so a heading never pitches or rolls them.
+type Heading struct {
+	// Mode is "travel", facing the direction of travel, "point", facing
+	// Point, "fixed", holding Yaw, or "none", publishing positions only.
+	Mode string `json:"mode"`
+	// Point is the [x, y] point of interest; a 3rd value is ignored.
+	Point []float64 `json:"point"`
+	// Yaw is the fixed heading in radians, counter-clockwise from +x.
+	Yaw float64 `json:"yaw"`
+}
+
+func (h Heading) validate() error {
+	switch h.Mode {
+	case "travel", "fixed", "none":
+	case "point":
+		if len(h.Point) != 2 && len(h.Point) != 3 {
+			return fmt.Errorf("heading point must have 2 or 3 values, got %d", len(h.Point))
+		}
+	default:
+		return fmt.Errorf("heading mode must be travel, point, fixed or none, got %q", h.Mode)
+	}
+	return nil
+}
+
+// pose is a waypoint with its orientation and the time until the next one.
+type pose struct {
+	position []float64
+	// rotation is nil when only the position is published.
+	rotation transformations.Quaternion
+	delay    time.Duration
+}
+
+// waypoint encodes p in the form WaypointIterator publishes, leaving out the
+// delay when it is the mission's interval.
+func (p pose) waypoint(interval time.Duration) []float64 {
+	wp := append([]float64{}, p.position...)
+	wp = append(wp, p.rotation...)
+	if p.delay != interval {
+		wp = append(wp, float64(p.delay)/float64(time.Millisecond))
+	}
+	return wp
+}
+
+// waypointDelay is the time after wp, its last value if it carries a delay.
+func waypointDelay(wp []float64, interval time.Duration) time.Duration {
+	if len(wp) == 4 || len(wp) == 8 {
+		return time.Duration(wp[len(wp)-1] * float64(time.Millisecond))
+	}
+	return interval
+}
+
+// missionDuration is the time from the first waypoint to the last.
+func missionDuration(waypoints [][]float64, interval time.Duration) time.Duration {
+	var d time.Duration
+	for _, wp := range waypoints[:max(len(waypoints)-1, 0)] {
+		d += waypointDelay(wp, interval)
+	}
+	return d
+}
+
+// missionPoses turns the waypoints of a mission into the poses MissionWork
+// publishes, and the interval between them: oriented by its heading unless
+// the waypoints carry their own orientation, timed by its profile and
+// interpolated at its publish rate.
+func missionPoses(waypoints [][]float64, interval time.Duration, base missionBase) ([][]float64, time.Duration) {
+	if len(waypoints) == 0 {
+		return waypoints, interval
+	}
+	heading := Heading{Mode: "travel"}
+	if base.Heading != nil {
+		heading = *base.Heading
+	}
+	poses := make([]pose, len(waypoints))
+	for i, wp := range waypoints {
+		poses[i] = pose{position: wp[:3], delay: waypointDelay(wp, interval)}
+		if len(wp) >= 7 {
+			poses[i].rotation = transformations.Normalize(wp[3:7])
+		}
+	}
+	orient := poses[0].rotation == nil && heading.Mode != "none"
+	// Along a linear path, the vehicle turns at waypoints while moving on to
+	// the next; along a smooth one, it follows the curve.
+	smooth := base.smooth()
+	if orient && !smooth {
+		applyHeading(poses, heading)
+	}
+	rate := base.publishRate()
+	if rate > 0 {
+		interval = seconds(1 / rate)
+	}
+	switch {
+	case base.Profile != nil:
+		if smooth {
+			// Only the shape of the curve is kept, the profile times it.
+			poses = interpolatePoses(poses, rate, base.Interpolation)
+		}
+		poses = retimePoses(poses, *base.Profile, rate)
+	case rate > 0:
+		poses = interpolatePoses(poses, rate, base.Interpolation)
+	}
+	if orient && smooth {
+		applyHeading(poses, heading)
+	}
+	if base.Profile != nil && len(poses) > 1 {
+		interval = poses[0].delay
+	}
+	out := make([][]float64, len(poses))
+	for i, p := range poses {
+		out[i] = p.waypoint(interval)
+	}
+	return out, interval
+}
+
+// applyHeading sets the yaw of every pose. While the vehicle is not moving
+// horizontally, or is right above the point of interest, it keeps its yaw.
+func applyHeading(poses []pose, h Heading) {
+	yaw := h.Yaw
+	facing := func(dx, dy float64) bool {
+		if math.Hypot(dx, dy) < 1e-9 {
+			return false
+		}
+		yaw = math.Atan2(dy, dx)
+		return true
+	}
+	if h.Mode == "travel" {
+		// Start facing the first movement, so the vehicle does not spin on departure.
+		for i := 1; i < len(poses); i++ {
+			if facing(poses[i].position[0]-poses[0].position[0], poses[i].position[1]-poses[0].position[1]) {
+				break
+			}
+		}
+	}
+	for i := range poses {
+		switch h.Mode {
+		case "travel":
+			// The central difference follows the tangent of sampled curves.
+			prev, next := poses[max(i-1, 0)].position, poses[min(i+1, len(poses)-1)].position
+			facing(next[0]-prev[0], next[1]-prev[1])
+		case "point":
+			facing(h.Point[0]-poses[i].position[0], h.Point[1]-poses[i].position[1])
+		}
+		poses[i].rotation, _ = transformations.EulerToQuaternion([3]float64{0, 0, yaw})
+	}
+}
+
+// interpolatePoses publishes rate poses per second between consecutive
+// poses, moving along the interpolation and turning along the shortest arc
+// with SLERP.
+func interpolatePoses(poses []pose, rate float64, interpolation string) []pose {
+	knots := make([]float64, len(poses))
+	points := make([][]float64, len(poses))
+	for i, p := range poses {
+		points[i] = p.position
+		if i > 0 {
+			knots[i] = knots[i-1] + poses[i-1].delay.Seconds()
+		}
+	}
+	curve := newSpline(interpolation, knots, points)
+	var out []pose
+	for i := 0; i+1 < len(poses); i++ {
+		a, b := poses[i], poses[i+1]
+		times := Resample(knots[i], knots[i+1], rate)
+		steps := len(times) - 1
+		for _, t := range times[:steps] {
+			p := pose{position: curve.at(i, t), delay: a.delay / time.Duration(steps)}
+			if a.rotation != nil {
+				p.rotation = transformations.Slerp(a.rotation, b.rotation, curve.progress(i, t))
+			}
+			out = append(out, p)
+		}
+	}
+	return append(out, poses[len(poses)-1])
+}
+
+// spline is a piecewise curve through points, reached at the times in knots.
+// Every segment but a linear one is a Hermite polynomial, set by the
+// positions and velocities at its ends.
+type spline struct {
+	interpolation string
+	knots         []float64
+	points        [][]float64
+	// velocities are the velocities at the points, nil for linear segments.
+	velocities [][]float64
+}
+
+func newSpline(interpolation string, knots []float64, points [][]float64) spline {
+	s := spline{interpolation: interpolation, knots: knots, points: points}
+	switch interpolation {
+	case "catmull_rom", "min_snap":
+		s.velocities = catmullRomVelocities(knots, points)
+	case "hermite":
+		s.velocities = monotoneVelocities(knots, points)
+	}
+	return s
+}
+
+// progress is the fraction of segment i covered at time t.
+func (s spline) progress(i int, t float64) float64 {
+	if d := s.knots[i+1] - s.knots[i]; d > 0 {
+		return (t - s.knots[i]) / d
+	}
+	return 0
+}
+
+// at is the position on segment i at time t.
+func (s spline) at(i int, t float64) []float64 {
+	u := s.progress(i, t)
+	d := s.knots[i+1] - s.knots[i]
+	p0, p1 := s.points[i], s.points[i+1]
+	// Weights of p0, p1 and of the velocities, scaled to u, at both ends.
+	var h0, h1, g0, g1 float64
+	switch {
+	case s.velocities == nil:
+		h0, h1 = 1-u, u
+	case s.interpolation == "min_snap":
+		// The septic that minimizes snap with no acceleration or jerk at its
+		// ends, so the vehicle never jerks when passing a waypoint.
+		h1 = u * u * u * u * (35 - 84*u + 70*u*u - 20*u*u*u)
+		h0 = 1 - h1
+		g0 = septicVelocity(u)
+		g1 = -septicVelocity(1 - u)
+	default:
+		h0 = 2*u*u*u - 3*u*u + 1
+		h1 = -2*u*u*u + 3*u*u
+		g0 = u*u*u - 2*u*u + u
+		g1 = u*u*u - u*u
+	}
+	p := make([]float64, len(p0))
+	for axis := range p {
+		p[axis] = h0*p0[axis] + h1*p1[axis]
+		if s.velocities != nil {
+			p[axis] += d * (g0*s.velocities[i][axis] + g1*s.velocities[i+1][axis])
+		}
+	}
+	return p
+}
+
+// septicVelocity weighs the starting velocity of a min_snap segment.
+func septicVelocity(u float64) float64 {
+	u4 := u * u * u * u
+	return u + u4*(-20+45*u-36*u*u+10*u*u*u)
+}
+
+// catmullRomVelocities points the velocity at every waypoint from the
+// previous waypoint to the next, or along the first or last segment.
+func catmullRomVelocities(knots []float64, points [][]float64) [][]float64 {
+	velocities := make([][]float64, len(points))
+	for i := range points {
+		prev, next := max(i-1, 0), min(i+1, len(points)-1)
+		velocities[i] = make([]float64, len(points[i]))
+		dt := knots[next] - knots[prev]
+		if dt <= 0 {
+			continue
+		}
+		for axis := range velocities[i] {
+			velocities[i][axis] = (points[next][axis] - points[prev][axis]) / dt
+		}
+	}
+	return velocities
+}
+
+// monotoneVelocities are the Fritsch-Carlson velocities, with which the curve
+// never overshoots the waypoints: it stops at every waypoint where an axis
+// turns back, and eases through the others.
+func monotoneVelocities(knots []float64, points [][]float64) [][]float64 {
+	velocities := make([][]float64, len(points))
+	for i := range points {
+		velocities[i] = make([]float64, len(points[i]))
+	}
+	slope := func(i, axis int) float64 {
+		if dt := knots[i+1] - knots[i]; dt > 0 {
+			return (points[i+1][axis] - points[i][axis]) / dt
+		}
+		return 0
+	}
+	last := len(points) - 1
+	for axis := range velocities[0] {
+		for i := range points {
+			switch {
+			case last == 0:
+			case i == 0:
+				velocities[i][axis] = slope(0, axis)
+			case i == last:
+				velocities[i][axis] = slope(last-1, axis)
+			default:
+				before, after := slope(i-1, axis), slope(i, axis)
+				if before*after <= 0 {
+					continue
+				}
+				h0, h1 := knots[i]-knots[i-1], knots[i+1]-knots[i]
+				w0, w1 := 2*h1+h0, h1+2*h0
+				velocities[i][axis] = (w0 + w1) / (w0/before + w1/after)
+			}
+		}
+	}
+	return velocities
+}
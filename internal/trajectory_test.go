@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// yawOf returns the yaw of a published pose.
+func yawOf(wp []float64) float64 {
+	x, y, z, w := wp[3], wp[4], wp[5], wp[6]
+	return math.Atan2(2*(w*z+x*y), 1-2*(y*y+z*z))
+}
+
+func missionWork(t *testing.T, spec string) MissionWork {
+	t.Helper()
+	mission, err := ParseMission([]byte(spec))
+	if err != nil {
+		t.Fatalf("%s: %v", spec, err)
+	}
+	return NewMissionWork(nil, "meshcat.transformations.drone1", mission)
+}
+
+func TestMissionHeading(t *testing.T) {
+	// Orbiting counter-clockwise from +x, the vehicle faces along +y, give or
+	// take half a step at the first waypoint, which has no predecessor.
+	orbit := missionWork(t, `{"type": "orbit", "samples": 8}`)
+	if wp := orbit.Waypoints[0]; len(wp) != 7 || math.Abs(yawOf(wp)-math.Pi/2) > math.Pi/8+1e-9 {
+		t.Errorf("orbit starts at %v", wp)
+	}
+	if wp := orbit.Waypoints[2]; math.Abs(math.Abs(yawOf(wp))-math.Pi) > 1e-9 {
+		t.Errorf("orbit is at %v after a quarter turn", wp)
+	}
+
+	point := missionWork(t, `{"type": "line", "from": [1, 0, 1], "to": [0, 1, 1], "samples": 2, "heading": {"mode": "point", "point": [0, 0]}}`)
+	if yaw := yawOf(point.Waypoints[0]); math.Abs(yaw-math.Pi) > 1e-9 {
+		t.Errorf("facing the origin from +x, got yaw %v", yaw)
+	}
+	if yaw := yawOf(point.Waypoints[1]); math.Abs(yaw+math.Pi/2) > 1e-9 {
+		t.Errorf("facing the origin from +y, got yaw %v", yaw)
+	}
+
+	fixed := missionWork(t, `{"type": "orbit", "samples": 4, "heading": {"mode": "fixed", "yaw": 1}}`)
+	for _, wp := range fixed.Waypoints {
+		if math.Abs(yawOf(wp)-1) > 1e-9 {
+			t.Errorf("fixed heading published %v", wp)
+		}
+	}
+
+	none := missionWork(t, `{"type": "orbit", "samples": 4, "heading": {"mode": "none"}}`)
+	if len(none.Waypoints[0]) != 3 {
+		t.Errorf("no heading published %v", none.Waypoints[0])
+	}
+
+	// Waypoints with their own orientation keep it, normalized.
+	oriented := missionWork(t, `{"type": "waypoints", "points": [[0, 0, 1, 0, 0, 2, 0], [1, 0, 1, 0, 0, 0, 1, 250]]}`)
+	if !floatsEqual(oriented.Waypoints[0], []float64{0, 0, 1, 0, 0, 1, 0}) || !floatsEqual(oriented.Waypoints[1], []float64{1, 0, 1, 0, 0, 0, 1, 250}) {
+		t.Errorf("oriented waypoints %v", oriented.Waypoints)
+	}
+}
+
+func TestMissionPublishRate(t *testing.T) {
+	// Half a turn at 10 Hz between two waypoints a second apart.
+	work := missionWork(t, `{"type": "waypoints", "interval": 1, "publish_rate": 10, "points": [[0, 0, 1, 0, 0, 0, 1], [1, 0, 1, 0, 0, 1, 0]]}`)
+	if len(work.Waypoints) != 11 {
+		t.Fatalf("got %d poses", len(work.Waypoints))
+	}
+	mid := work.Waypoints[5]
+	if !floatsEqual(mid[:3], []float64{0.5, 0, 1}) || math.Abs(yawOf(mid)-math.Pi/2) > 1e-9 || len(mid) != 7 || work.Interval != 100*time.Millisecond {
+		t.Errorf("halfway pose %v", mid)
+	}
+	if d := missionDuration(work.Waypoints, work.Interval); d != time.Second {
+		t.Errorf("interpolated mission takes %v", d)
+	}
+}
+
+func TestMissionHeadingErrors(t *testing.T) {
+	tests := map[string]string{
+		`{"type": "orbit", "heading": {"mode": "sideways"}}`:                                      "heading mode",
+		`{"type": "orbit", "heading": {"mode": "point"}}`:                                         "heading point",
+		`{"type": "orbit", "publish_rate": -1}`:                                                   "publish_rate",
+		`{"type": "waypoints", "points": [[0, 0, 1, 0, 0, 0, 0]]}`:                                "point 0",
+		`{"type": "waypoints", "points": [[0, 0, 1, 0, 0]]}`:                                      "point 0",
+		`{"type": "orbit", "publish_rate": 1e6, "period": 1000}`:                                  "more than the limit",
+		`{"type": "waypoints", "heading": {"mode": "travel"}, "points": [[0, 0, 1, 0, 0, 0, 1]]}`: "heading",
+	}
+	for spec, want := range tests {
+		_, err := ParseMission([]byte(spec))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v; want an error containing %q", spec, err, want)
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	if got := Resample(0, 0.3, 10); !floatsEqual(got, []float64{0, 0.1, 0.2, 0.3}) {
+		t.Errorf("0.3 s at 10 Hz: %v", got)
+	}
+	if got := Resample(1, 1, 10); !floatsEqual(got, []float64{1, 1}) {
+		t.Errorf("an instant: %v", got)
+	}
+}
+
+func TestMissionInterpolation(t *testing.T) {
+	points := [][]float64{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {2, 1, 1}, {2, 2, 1}}
+	for _, interpolation := range []string{"linear", "catmull_rom", "hermite", "min_snap"} {
+		spec := `{"type": "waypoints", "heading": {"mode": "none"}, "interpolation": "` + interpolation +
+			`", "points": [[0, 0, 1], [1, 0, 1], [1, 1, 1], [2, 1, 1], [2, 2, 1]]}`
+		work := missionWork(t, spec)
+		// 5 points a second apart give 4 s of motion at the default 60 Hz,
+		// or just the waypoints when linear.
+		if interpolation == "linear" {
+			if len(work.Waypoints) != 5 {
+				t.Errorf("linear: got %d poses", len(work.Waypoints))
+			}
+			continue
+		}
+		if len(work.Waypoints) != 4*60+1 {
+			t.Fatalf("%s: got %d poses", interpolation, len(work.Waypoints))
+		}
+		for i, point := range points {
+			if wp := work.Waypoints[i*60]; !floatsEqual(wp[:3], point) {
+				t.Errorf("%s: passes waypoint %d at %v", interpolation, i, wp)
+			}
+		}
+		// Catmull-Rom velocities swing out before turning towards the third
+		// waypoint; the monotone Hermite curve holds y until then.
+		if y := work.Waypoints[30][1]; (y >= 0) != (interpolation == "hermite") {
+			t.Errorf("%s: halfway along the first segment at %v", interpolation, work.Waypoints[30])
+		}
+		for _, wp := range work.Waypoints {
+			// The monotone Hermite curve never leaves the box spanned by the waypoints.
+			if interpolation == "hermite" && (wp[0] < -1e-9 || wp[0] > 2+1e-9 || wp[1] < -1e-9 || wp[1] > 2+1e-9) {
+				t.Errorf("hermite overshoots to %v", wp)
+			}
+		}
+		if interpolation == "min_snap" {
+			// No acceleration when passing a waypoint.
+			before, at, after := work.Waypoints[59], work.Waypoints[60], work.Waypoints[61]
+			if accel := (before[0] - 2*at[0] + after[0]) * 60 * 60; math.Abs(accel) > 0.01 {
+				t.Errorf("min_snap accelerates at %v through waypoint 1", accel)
+			}
+		}
+	}
+	if _, err := ParseMission([]byte(`{"type": "orbit", "interpolation": "bezier"}`)); err == nil || !strings.Contains(err.Error(), "interpolation") {
+		t.Errorf("unknown interpolation: %v", err)
+	}
+}
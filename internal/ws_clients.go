@@ -2,18 +2,13 @@ package internal
 
 import (
 	"bytes"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 )
 
-const (
-  pingPeriod  = (pongWait * 9) / 10
-	maxMessageSize = 8192
-)
-
 var (
 	newline = []byte{'\n'}
 	space   = []byte{' '}
@@ -22,9 +17,26 @@ var (
 type Client struct {
 	hub *Hub
 
+	// id identifies the client in metrics.
+	id string
+
 	conn *websocket.Conn
 
-	send chan []byte
+	cfg WSConfig
+
+	// role decides whether the client may send inbound events.
+	role Role
+
+	send chan outbound
+
+	// welcome, when set, is called by the hub as the client registers and
+	// returns the commands to queue ahead of any broadcast.
+	welcome func() []outbound
+	// registered is closed once the hub has registered the client, and set
+	// up its send channel.
+	registered chan struct{}
+
+	logger *slog.Logger
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -34,22 +46,28 @@ type Client struct {
 // reads from this goroutine.
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.Unregister(c)
 		c.conn.Close()
 	}()
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	c.conn.SetReadLimit(c.cfg.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait))
+	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait)); return nil })
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+				c.logger.Warn("connection closed unexpectedly", "error", err)
 			}
 			break
 		}
+		if c.role < RoleControl {
+			c.logger.Debug("dropping inbound message from read-only client")
+			continue
+		}
 		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
-		c.hub.broadcast <- message
+		if err := c.hub.Write(message); err != nil {
+			break
+		}
 	}
 }
 
@@ -59,39 +77,34 @@ func (c *Client) readPump() {
 // application ensures that there is at most one writer to a connection by
 // executing all writes from this goroutine.
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.cfg.pingPeriod())
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.hub.writers.Done()
 	}()
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteWait))
 			if !ok {
 				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMessage := []byte{}
+				if c.hub.closed() {
+					closeMessage = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.BinaryMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued chat messages to the current websocket message.
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(newline)
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			// Every command is a msgpack document of its own, so each one
+			// gets its own frame rather than being joined into one message.
+			c.setCompression(message)
+			if err := c.conn.WriteMessage(websocket.BinaryMessage, message.data); err != nil {
 				return
 			}
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -99,21 +112,64 @@ func (c *Client) writePump() {
 	}
 }
 
+// setCompression picks the compression level for the next frame from the
+// kind of command it carries. It is a no-op when permessage-deflate was not
+// negotiated.
+func (c *Client) setCompression(m outbound) {
+	level := c.cfg.CompressionLevel(m.kind)
+	c.conn.EnableWriteCompression(level != 0)
+	if level != 0 {
+		c.conn.SetCompressionLevel(level)
+	}
+}
+
 // serveWs handles websocket requests from the peer.
 func (s *Server) serveWs() echo.HandlerFunc {
-  return func(c echo.Context) error {
-    conn, err := upgrader.Upgrade(c.Response().Writer, c.Request(), nil)
-    if err != nil {
-      log.Println(err)
-      return err
-    }
-    client := &Client{hub: s.Hub, conn: conn, send: make(chan []byte, 256)}
-    client.hub.register <- client
-
-    // Allow collection of memory referenced by the caller by doing all work in
-    // new goroutines.
-    go client.writePump()
-    go client.readPump()
-    return nil
-  }
+	return func(c echo.Context) error {
+		conn, err := s.upgrader.Upgrade(c.Response().Writer, c.Request(), nil)
+		if err != nil {
+			s.Logger.Warn("unable to upgrade connection", "subsystem", "websocket", "remote_ip", c.RealIP(), "error", err)
+			return err
+		}
+		id := conn.RemoteAddr().String()
+		client := &Client{
+			hub:    s.Hub,
+			id:     id,
+			conn:   conn,
+			cfg:    s.WS,
+			role:   RoleFromContext(c),
+			logger: s.Logger.With("subsystem", "websocket", "client", id),
+		}
+		// The hub takes the snapshot as it registers the client, so no command
+		// can fall between the snapshot and the first broadcast.
+		client.welcome = func() []outbound {
+			var initial []outbound
+			// Queue the link and clock status first so the viewer can flag a scene that
+			// is not receiving telemetry, and show the simulation time.
+			if status, err := encodeStatus(s.LinkStatus()); err == nil {
+				initial = append(initial, outbound{kind: "set_object", data: status})
+			}
+			if status, err := encodeClockStatus(s.Clock.Status()); err == nil {
+				initial = append(initial, outbound{kind: "set_object", data: status})
+			}
+			// Then replay the current scene, so late joiners see what everyone else sees.
+			for _, entry := range s.Scene.Snapshot() {
+				initial = append(initial, outbound{kind: entry.Type, data: entry.Data})
+			}
+			return initial
+		}
+		if err := client.hub.Register(client); err != nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(s.WS.WriteWait))
+			conn.Close()
+			return nil
+		}
+
+		// Allow collection of memory referenced by the caller by doing all work in
+		// new goroutines.
+		go client.writePump()
+		go client.readPump()
+		return nil
+	}
 }
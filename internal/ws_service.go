@@ -1,83 +1,360 @@
 package internal
 
 import (
+	"compress/flate"
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-var writeWait = 10 * time.Second
+// WSConfig holds the tunables for viewer websocket connections.
+type WSConfig struct {
+	ReadBufferSize  int `env:"MESHCAT_WS_READ_BUFFER_SIZE" yaml:"read_buffer_size" toml:"read_buffer_size"`
+	WriteBufferSize int `env:"MESHCAT_WS_WRITE_BUFFER_SIZE" yaml:"write_buffer_size" toml:"write_buffer_size"`
+	// MaxMessageSize bounds inbound messages, e.g. screenshots sent back by the viewer.
+	MaxMessageSize int64         `env:"MESHCAT_WS_MAX_MESSAGE_SIZE" yaml:"max_message_size" toml:"max_message_size"`
+	WriteWait      time.Duration `env:"MESHCAT_WS_WRITE_WAIT" yaml:"write_wait" toml:"write_wait"`
+	PongWait       time.Duration `env:"MESHCAT_WS_PONG_WAIT" yaml:"pong_wait" toml:"pong_wait"`
+	// SendBufferSize is the number of outbound messages queued per client before it is dropped.
+	SendBufferSize int `env:"MESHCAT_WS_SEND_BUFFER_SIZE" yaml:"send_buffer_size" toml:"send_buffer_size"`
 
-const pongWait = 60 * time.Second
+	// EnableCompression negotiates permessage-deflate with the viewer.
+	EnableCompression bool `env:"MESHCAT_WS_COMPRESSION" yaml:"compression" toml:"compression"`
+	// CompressionLevels maps a meshcat command type to a flate level.
+	// A level of 0 (flate.NoCompression) sends that command type uncompressed.
+	CompressionLevels map[string]int `env:"MESHCAT_WS_COMPRESSION_LEVELS" yaml:"compression_levels" toml:"compression_levels"`
+	// DefaultCompressionLevel is used for command types missing from CompressionLevels.
+	DefaultCompressionLevel int `env:"MESHCAT_WS_COMPRESSION_LEVEL" yaml:"compression_level" toml:"compression_level"`
+}
+
+// DefaultWSConfig returns the settings the server used before they were configurable,
+// with compression tuned for the meshcat command mix: mesh uploads compress well,
+// high-rate transforms are small and mostly float noise.
+func DefaultWSConfig() WSConfig {
+	return WSConfig{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   8192,
+		MaxMessageSize:    8192,
+		WriteWait:         10 * time.Second,
+		PongWait:          60 * time.Second,
+		SendBufferSize:    256,
+		EnableCompression: true,
+		CompressionLevels: map[string]int{
+			"set_object":             flate.DefaultCompression,
+			"set_object_from_server": flate.BestSpeed,
+			"set_animation":          flate.DefaultCompression,
+			"set_property":           flate.BestSpeed,
+			"set_transform":          flate.NoCompression,
+			"delete":                 flate.NoCompression,
+		},
+		DefaultCompressionLevel: flate.BestSpeed,
+	}
+}
+
+// Validate checks that the limits are usable and that all compression levels are accepted by flate.
+func (cfg WSConfig) Validate() error {
+	if cfg.MaxMessageSize <= 0 {
+		return fmt.Errorf("websocket max message size must be positive, got %d", cfg.MaxMessageSize)
+	}
+	if cfg.PongWait <= 0 || cfg.WriteWait <= 0 {
+		return fmt.Errorf("websocket pong and write waits must be positive")
+	}
+	if cfg.SendBufferSize <= 0 {
+		return fmt.Errorf("websocket send buffer size must be positive, got %d", cfg.SendBufferSize)
+	}
+	if !validCompressionLevel(cfg.DefaultCompressionLevel) {
+		return fmt.Errorf("invalid default compression level %d", cfg.DefaultCompressionLevel)
+	}
+	for kind, level := range cfg.CompressionLevels {
+		if !validCompressionLevel(level) {
+			return fmt.Errorf("invalid compression level %d for %s", level, kind)
+		}
+	}
+	return nil
+}
+
+func validCompressionLevel(level int) bool {
+	return flate.HuffmanOnly <= level && level <= flate.BestCompression
+}
+
+// CompressionLevel returns the flate level used when sending a command of the given type.
+func (cfg WSConfig) CompressionLevel(kind string) int {
+	if level, ok := cfg.CompressionLevels[kind]; ok {
+		return level
+	}
+	return cfg.DefaultCompressionLevel
+}
+
+func (cfg WSConfig) pingPeriod() time.Duration {
+	return (cfg.PongWait * 9) / 10
+}
+
+// outbound is a message queued for the viewers, tagged with the meshcat
+// command type so the writer can pick a compression level.
+type outbound struct {
+	kind string
+	data []byte
+	// queued is when the command was written to the hub.
+	queued time.Time
+}
 
 type Hub struct {
 	// Registered clients
 	clients map[*Client]bool
 
 	// Messages to broadcast to clients.
-	broadcast chan []byte
+	broadcast chan outbound
 
 	// Register requests from the clients.
 	register chan *Client
 
 	// Unregister requests from clients.
 	unregister chan *Client
+
+	// done is closed to shut the hub down, stopped once run has returned.
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+
+	// writers tracks the clients' write pumps so Close can wait for close
+	// frames to go out. It is only added to from run.
+	writers sync.WaitGroup
+
+	// count mirrors len(clients) for readers outside run.
+	count atomic.Int64
+
+	// recorder, when set, records every command written to the hub.
+	recorder atomic.Pointer[Recorder]
+
+	// inspect runs functions inside run, where clients may be read.
+	inspect chan func()
+
+	metrics *Metrics
+
+	// watchers receive a copy of every command written to the hub.
+	watchersMu sync.Mutex
+	watchers   map[chan outbound]struct{}
 }
 
+var errHubClosed = errors.New("hub closed")
+
 func NewHub() *Hub {
-  hub := &Hub{
-		broadcast:  make(chan []byte),
+	hub := &Hub{
+		broadcast:  make(chan outbound),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		inspect:    make(chan func()),
+		watchers:   make(map[chan outbound]struct{}),
 	}
-  go hub.run()
-  return hub
+	go hub.run()
+	return hub
 }
 
 func (h *Hub) run() {
+	defer close(h.stopped)
 	for {
 		select {
+		case <-h.done:
+			for client := range h.clients {
+				delete(h.clients, client)
+				close(client.send)
+			}
+			return
 		case client := <-h.register:
+			if client.welcome != nil {
+				initial := client.welcome()
+				client.send = make(chan outbound, client.cfg.SendBufferSize+len(initial))
+				for _, m := range initial {
+					client.send <- m
+				}
+			}
 			h.clients[client] = true
+			h.writers.Add(1)
+			h.count.Store(int64(len(h.clients)))
+			close(client.registered)
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send)
 			}
+			h.count.Store(int64(len(h.clients)))
 		case message := <-h.broadcast:
-      fmt.Println("got a message for broadcast")
 			for client := range h.clients {
 				select {
 				case client.send <- message:
 				default:
 					close(client.send)
 					delete(h.clients, client)
+					h.metrics.clientDropped()
 				}
 			}
+			h.count.Store(int64(len(h.clients)))
+			h.metrics.broadcast(message.queued)
+		case f := <-h.inspect:
+			f()
 		}
 	}
 }
 
 func (h *Hub) Write(message []byte) error {
-  fmt.Println("Got here...")
-  h.broadcast <- message
-  fmt.Println("got here too")
-  return nil
-}
-
-// Define the WebSocket upgrader
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 8192,
-	WriteBufferPool: &sync.Pool{},
-	CheckOrigin: func(r *http.Request) bool {
+	return h.WriteCommand("", message)
+}
+
+// WriteCommand broadcasts an encoded meshcat command of the given type, e.g. "set_object".
+func (h *Hub) WriteCommand(kind string, message []byte) error {
+	if h.closed() {
+		return errHubClosed
+	}
+	if r := h.recorder.Load(); r != nil {
+		r.Record(SourceViewer, kind, message)
+	}
+	m := outbound{kind: kind, data: message, queued: time.Now()}
+	select {
+	case h.broadcast <- m:
+	case <-h.done:
+		return errHubClosed
+	}
+	h.watchersMu.Lock()
+	for w := range h.watchers {
+		select {
+		case w <- m:
+		default:
+			// A slow watcher misses commands rather than holding up the viewers.
+		}
+	}
+	h.watchersMu.Unlock()
+	return nil
+}
+
+// watch returns a channel receiving the commands written to the hub, queuing
+// up to size of them, and a function to stop watching.
+func (h *Hub) watch(size int) (<-chan outbound, func()) {
+	w := make(chan outbound, size)
+	h.watchersMu.Lock()
+	h.watchers[w] = struct{}{}
+	h.watchersMu.Unlock()
+	return w, func() {
+		h.watchersMu.Lock()
+		delete(h.watchers, w)
+		h.watchersMu.Unlock()
+	}
+}
+
+// SetRecorder starts recording the commands written to the hub, or stops
+// when r is nil.
+func (h *Hub) SetRecorder(r *Recorder) {
+	h.recorder.Store(r)
+}
+
+// Register adds a client to the hub, failing once the hub has shut down.
+func (h *Hub) Register(client *Client) error {
+	client.registered = make(chan struct{})
+	select {
+	case h.register <- client:
+		// The hub may still be setting up client.send, which the caller's
+		// writePump reads next.
+		<-client.registered
+		return nil
+	case <-h.done:
+		return errHubClosed
+	}
+}
+
+// Unregister removes a client from the hub.
+func (h *Hub) Unregister(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+	}
+}
+
+// Clients returns the number of connected viewers.
+func (h *Hub) Clients() int {
+	return int(h.count.Load())
+}
+
+// ClientStats describes the send queue of a connected viewer.
+type ClientStats struct {
+	ID       string
+	Queued   int
+	Capacity int
+}
+
+// do runs f inside the hub's event loop, failing if the hub has shut down or
+// does not get to it before ctx expires.
+func (h *Hub) do(ctx context.Context, f func()) error {
+	ran := make(chan struct{})
+	select {
+	case h.inspect <- func() { f(); close(ran) }:
+	case <-h.done:
+		return errHubClosed
+	case <-ctx.Done():
+		return fmt.Errorf("hub is not responding: %w", ctx.Err())
+	}
+	<-ran
+	return nil
+}
+
+// Ping checks that the hub's event loop is running and responsive.
+func (h *Hub) Ping(ctx context.Context) error {
+	return h.do(ctx, func() {})
+}
+
+// ClientStats returns the send queue of every connected viewer.
+func (h *Hub) ClientStats(ctx context.Context) ([]ClientStats, error) {
+	var stats []ClientStats
+	err := h.do(ctx, func() {
+		for client := range h.clients {
+			stats = append(stats, ClientStats{ID: client.id, Queued: len(client.send), Capacity: cap(client.send)})
+		}
+	})
+	return stats, err
+}
+
+func (h *Hub) closed() bool {
+	select {
+	case <-h.done:
 		return true
-		// return origin == "http://localhost:8080"
-	},
+	default:
+		return false
+	}
+}
+
+// Close stops the hub and waits, until ctx expires, for every client to be
+// sent a going-away close frame.
+func (h *Hub) Close(ctx context.Context) error {
+	h.closeOnce.Do(func() { close(h.done) })
+	flushed := make(chan struct{})
+	go func() {
+		<-h.stopped
+		h.writers.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newUpgrader builds the websocket upgrader for the given configuration.
+func newUpgrader(cfg WSConfig, auth AuthConfig) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		WriteBufferPool:   &sync.Pool{},
+		EnableCompression: cfg.EnableCompression,
+		CheckOrigin:       auth.CheckOrigin,
+	}
 }
 
 // func wsprocess(ws *websocket.Conn) {
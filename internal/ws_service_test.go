@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"compress/flate"
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+func TestLoadWSConfig(t *testing.T) {
+	t.Setenv("MESHCAT_WS_MAX_MESSAGE_SIZE", "4194304")
+	t.Setenv("MESHCAT_WS_PONG_WAIT", "30s")
+	t.Setenv("MESHCAT_WS_COMPRESSION", "false")
+	t.Setenv("MESHCAT_WS_COMPRESSION_LEVELS", "set_object=9, set_property=0")
+
+	config, _, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	cfg := config.WS
+	if cfg.MaxMessageSize != 4194304 {
+		t.Errorf("MaxMessageSize = %d; want 4194304", cfg.MaxMessageSize)
+	}
+	if cfg.PongWait != 30*time.Second || cfg.pingPeriod() != 27*time.Second {
+		t.Errorf("PongWait = %v, pingPeriod = %v", cfg.PongWait, cfg.pingPeriod())
+	}
+	if cfg.EnableCompression {
+		t.Errorf("EnableCompression = true; want false")
+	}
+	if cfg.WriteWait != DefaultWSConfig().WriteWait {
+		t.Errorf("WriteWait = %v; want default", cfg.WriteWait)
+	}
+
+	tests := []struct {
+		kind  string
+		level int
+	}{
+		{"set_object", flate.BestCompression},
+		{"set_property", flate.NoCompression},
+		{"set_transform", flate.NoCompression},
+		{"unknown", flate.BestSpeed},
+	}
+	for _, test := range tests {
+		if got := cfg.CompressionLevel(test.kind); got != test.level {
+			t.Errorf("CompressionLevel(%q) = %d; want %d", test.kind, got, test.level)
+		}
+	}
+}
+
+func TestLoadWSConfigInvalid(t *testing.T) {
+	for key, value := range map[string]string{
+		"MESHCAT_WS_COMPRESSION_LEVELS": "set_object=12",
+		"MESHCAT_WS_PONG_WAIT":          "soon",
+		"MESHCAT_WS_MAX_MESSAGE_SIZE":   "-1",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, _, err := LoadConfig(nil); err == nil {
+				t.Errorf("expected an error for %s=%s", key, value)
+			}
+		})
+	}
+}
+
+func TestHubCloseSendsCloseFrame(t *testing.T) {
+	s := Server{Router: echo.New(), Hub: NewHub(), Logger: slog.Default(), WS: DefaultWSConfig(), Scene: NewSceneState()}
+	s.upgrader = newUpgrader(s.WS, s.Auth)
+	s.Router.GET("/ws", s.serveWs())
+	srv := httptest.NewServer(s.Router)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Hub.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	for err == nil {
+		// Skip the link status queued for every new viewer.
+		_, _, err = conn.ReadMessage()
+	}
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected a going-away close frame, got %v", err)
+	}
+	r, err := NewRecorder(t.TempDir(), "late", time.Second, nil)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	defer r.Close()
+	s.Hub.SetRecorder(r)
+	if err := s.Hub.Write([]byte("late")); err == nil {
+		t.Errorf("expected Write to fail on a closed hub")
+	}
+	if n := r.Info().Frames; n != 0 {
+		t.Errorf("closed hub recorded %d frames", n)
+	}
+}
@@ -0,0 +1,4 @@
+// Package meshcatpb is the gRPC API of go-meshcat, generated from meshcat.proto.
+package meshcatpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative meshcat.proto
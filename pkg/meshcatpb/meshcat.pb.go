@@ -0,0 +1,925 @@
+// The gRPC API of go-meshcat. It mirrors the NATS subjects and REST routes:
+// every call goes through the same command pipeline, so its changes are
+// persisted, recorded and pushed to the viewers like any other.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.33.0
+// 	protoc        (unknown)
+// source: meshcat.proto
+
+package meshcatpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CommandReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *CommandReply) Reset() {
+	*x = CommandReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CommandReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandReply) ProtoMessage() {}
+
+func (x *CommandReply) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandReply.ProtoReflect.Descriptor instead.
+func (*CommandReply) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{0}
+}
+
+type SetObjectRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	// geometry takes the same fields as the JSON geometry on NATS, e.g.
+	// {"radius": 0.5} or {"width": 1, "height": 1, "depth": 1}.
+	Geometry *structpb.Struct `protobuf:"bytes,2,opt,name=geometry,proto3" json:"geometry,omitempty"`
+}
+
+func (x *SetObjectRequest) Reset() {
+	*x = SetObjectRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetObjectRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetObjectRequest) ProtoMessage() {}
+
+func (x *SetObjectRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetObjectRequest.ProtoReflect.Descriptor instead.
+func (*SetObjectRequest) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SetObjectRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SetObjectRequest) GetGeometry() *structpb.Struct {
+	if x != nil {
+		return x.Geometry
+	}
+	return nil
+}
+
+// SetTransformRequest is either a 4x4 matrix, or a translation and a rotation
+// given as euler angles [roll, pitch, yaw] or a quaternion [x, y, z, w].
+type SetTransformRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Path        string    `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Matrix      []float64 `protobuf:"fixed64,2,rep,packed,name=matrix,proto3" json:"matrix,omitempty"`
+	Translation []float64 `protobuf:"fixed64,3,rep,packed,name=translation,proto3" json:"translation,omitempty"`
+	Rotation    []float64 `protobuf:"fixed64,4,rep,packed,name=rotation,proto3" json:"rotation,omitempty"`
+	Scale       []float64 `protobuf:"fixed64,5,rep,packed,name=scale,proto3" json:"scale,omitempty"`
+}
+
+func (x *SetTransformRequest) Reset() {
+	*x = SetTransformRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetTransformRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTransformRequest) ProtoMessage() {}
+
+func (x *SetTransformRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTransformRequest.ProtoReflect.Descriptor instead.
+func (*SetTransformRequest) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetTransformRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SetTransformRequest) GetMatrix() []float64 {
+	if x != nil {
+		return x.Matrix
+	}
+	return nil
+}
+
+func (x *SetTransformRequest) GetTranslation() []float64 {
+	if x != nil {
+		return x.Translation
+	}
+	return nil
+}
+
+func (x *SetTransformRequest) GetRotation() []float64 {
+	if x != nil {
+		return x.Rotation
+	}
+	return nil
+}
+
+func (x *SetTransformRequest) GetScale() []float64 {
+	if x != nil {
+		return x.Scale
+	}
+	return nil
+}
+
+type SetPropertyRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Path     string          `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Property string          `protobuf:"bytes,2,opt,name=property,proto3" json:"property,omitempty"`
+	Value    *structpb.Value `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (x *SetPropertyRequest) Reset() {
+	*x = SetPropertyRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetPropertyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetPropertyRequest) ProtoMessage() {}
+
+func (x *SetPropertyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetPropertyRequest.ProtoReflect.Descriptor instead.
+func (*SetPropertyRequest) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SetPropertyRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SetPropertyRequest) GetProperty() string {
+	if x != nil {
+		return x.Property
+	}
+	return ""
+}
+
+func (x *SetPropertyRequest) GetValue() *structpb.Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeleteRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+type AnimationOptions struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Play        bool  `protobuf:"varint,1,opt,name=play,proto3" json:"play,omitempty"`
+	Repetitions int32 `protobuf:"varint,2,opt,name=repetitions,proto3" json:"repetitions,omitempty"`
+}
+
+func (x *AnimationOptions) Reset() {
+	*x = AnimationOptions{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AnimationOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnimationOptions) ProtoMessage() {}
+
+func (x *AnimationOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnimationOptions.ProtoReflect.Descriptor instead.
+func (*AnimationOptions) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AnimationOptions) GetPlay() bool {
+	if x != nil {
+		return x.Play
+	}
+	return false
+}
+
+func (x *AnimationOptions) GetRepetitions() int32 {
+	if x != nil {
+		return x.Repetitions
+	}
+	return 0
+}
+
+type SetAnimationRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	// animations are meshcat animation clips, as sent by meshcat-python.
+	Animations *structpb.ListValue `protobuf:"bytes,2,opt,name=animations,proto3" json:"animations,omitempty"`
+	Options    *AnimationOptions   `protobuf:"bytes,3,opt,name=options,proto3" json:"options,omitempty"`
+}
+
+func (x *SetAnimationRequest) Reset() {
+	*x = SetAnimationRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetAnimationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetAnimationRequest) ProtoMessage() {}
+
+func (x *SetAnimationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetAnimationRequest.ProtoReflect.Descriptor instead.
+func (*SetAnimationRequest) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SetAnimationRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SetAnimationRequest) GetAnimations() *structpb.ListValue {
+	if x != nil {
+		return x.Animations
+	}
+	return nil
+}
+
+func (x *SetAnimationRequest) GetOptions() *AnimationOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type StreamPosesReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Applied  uint64 `protobuf:"varint,1,opt,name=applied,proto3" json:"applied,omitempty"`
+	Rejected uint64 `protobuf:"varint,2,opt,name=rejected,proto3" json:"rejected,omitempty"`
+}
+
+func (x *StreamPosesReply) Reset() {
+	*x = StreamPosesReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamPosesReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamPosesReply) ProtoMessage() {}
+
+func (x *StreamPosesReply) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamPosesReply.ProtoReflect.Descriptor instead.
+func (*StreamPosesReply) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamPosesReply) GetApplied() uint64 {
+	if x != nil {
+		return x.Applied
+	}
+	return 0
+}
+
+func (x *StreamPosesReply) GetRejected() uint64 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+type WatchViewerEventsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// types keeps only the given command types, e.g. "set_transform"; empty keeps all.
+	Types []string `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`
+	// path_prefix keeps only commands at or below the given scene path.
+	PathPrefix string `protobuf:"bytes,2,opt,name=path_prefix,json=pathPrefix,proto3" json:"path_prefix,omitempty"`
+}
+
+func (x *WatchViewerEventsRequest) Reset() {
+	*x = WatchViewerEventsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WatchViewerEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchViewerEventsRequest) ProtoMessage() {}
+
+func (x *WatchViewerEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchViewerEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchViewerEventsRequest) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *WatchViewerEventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *WatchViewerEventsRequest) GetPathPrefix() string {
+	if x != nil {
+		return x.PathPrefix
+	}
+	return ""
+}
+
+type ViewerEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Path string `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	// command is the msgpack encoded command, as sent to the viewers.
+	Command []byte                 `protobuf:"bytes,3,opt,name=command,proto3" json:"command,omitempty"`
+	Time    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=time,proto3" json:"time,omitempty"`
+}
+
+func (x *ViewerEvent) Reset() {
+	*x = ViewerEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_meshcat_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ViewerEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ViewerEvent) ProtoMessage() {}
+
+func (x *ViewerEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_meshcat_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ViewerEvent.ProtoReflect.Descriptor instead.
+func (*ViewerEvent) Descriptor() ([]byte, []int) {
+	return file_meshcat_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ViewerEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ViewerEvent) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ViewerEvent) GetCommand() []byte {
+	if x != nil {
+		return x.Command
+	}
+	return nil
+}
+
+func (x *ViewerEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+var File_meshcat_proto protoreflect.FileDescriptor
+
+var file_meshcat_proto_rawDesc = []byte{
+	0x0a, 0x0d, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12,
+	0x0a, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x1a, 0x1c, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x73, 0x74, 0x72,
+	0x75, 0x63, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x0e, 0x0a, 0x0c, 0x43, 0x6f,
+	0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x5b, 0x0a, 0x10, 0x53, 0x65,
+	0x74, 0x4f, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12,
+	0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61,
+	0x74, 0x68, 0x12, 0x33, 0x0a, 0x08, 0x67, 0x65, 0x6f, 0x6d, 0x65, 0x74, 0x72, 0x79, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x75, 0x63, 0x74, 0x52, 0x08, 0x67,
+	0x65, 0x6f, 0x6d, 0x65, 0x74, 0x72, 0x79, 0x22, 0x95, 0x01, 0x0a, 0x13, 0x53, 0x65, 0x74, 0x54,
+	0x72, 0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70,
+	0x61, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x61, 0x74, 0x72, 0x69, 0x78, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x01, 0x52, 0x06, 0x6d, 0x61, 0x74, 0x72, 0x69, 0x78, 0x12, 0x20, 0x0a, 0x0b, 0x74,
+	0x72, 0x61, 0x6e, 0x73, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x03, 0x28, 0x01,
+	0x52, 0x0b, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a,
+	0x08, 0x72, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x03, 0x28, 0x01, 0x52,
+	0x08, 0x72, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x63, 0x61,
+	0x6c, 0x65, 0x18, 0x05, 0x20, 0x03, 0x28, 0x01, 0x52, 0x05, 0x73, 0x63, 0x61, 0x6c, 0x65, 0x22,
+	0x72, 0x0a, 0x12, 0x53, 0x65, 0x74, 0x50, 0x72, 0x6f, 0x70, 0x65, 0x72, 0x74, 0x79, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x6f,
+	0x70, 0x65, 0x72, 0x74, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x72, 0x6f,
+	0x70, 0x65, 0x72, 0x74, 0x79, 0x12, 0x2c, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x22, 0x23, 0x0a, 0x0d, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x22, 0x48, 0x0a, 0x10, 0x41, 0x6e, 0x69, 0x6d,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x12, 0x0a, 0x04,
+	0x70, 0x6c, 0x61, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x70, 0x6c, 0x61, 0x79,
+	0x12, 0x20, 0x0a, 0x0b, 0x72, 0x65, 0x70, 0x65, 0x74, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0b, 0x72, 0x65, 0x70, 0x65, 0x74, 0x69, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x22, 0x9d, 0x01, 0x0a, 0x13, 0x53, 0x65, 0x74, 0x41, 0x6e, 0x69, 0x6d, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61,
+	0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x3a,
+	0x0a, 0x0a, 0x61, 0x6e, 0x69, 0x6d, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x52, 0x0a,
+	0x61, 0x6e, 0x69, 0x6d, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x36, 0x0a, 0x07, 0x6f, 0x70,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x6d, 0x65,
+	0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x41, 0x6e, 0x69, 0x6d, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x22, 0x48, 0x0a, 0x10, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x50, 0x6f, 0x73, 0x65,
+	0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x70, 0x70, 0x6c, 0x69, 0x65,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x61, 0x70, 0x70, 0x6c, 0x69, 0x65, 0x64,
+	0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x6a, 0x65, 0x63, 0x74, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x08, 0x72, 0x65, 0x6a, 0x65, 0x63, 0x74, 0x65, 0x64, 0x22, 0x51, 0x0a, 0x18,
+	0x57, 0x61, 0x74, 0x63, 0x68, 0x56, 0x69, 0x65, 0x77, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74,
+	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x79, 0x70, 0x65,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05, 0x74, 0x79, 0x70, 0x65, 0x73, 0x12, 0x1f,
+	0x0a, 0x0b, 0x70, 0x61, 0x74, 0x68, 0x5f, 0x70, 0x72, 0x65, 0x66, 0x69, 0x78, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0a, 0x70, 0x61, 0x74, 0x68, 0x50, 0x72, 0x65, 0x66, 0x69, 0x78, 0x22,
+	0x7f, 0x0a, 0x0b, 0x56, 0x69, 0x65, 0x77, 0x65, 0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x12,
+	0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e,
+	0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64,
+	0x12, 0x2e, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65,
+	0x32, 0x92, 0x04, 0x0a, 0x07, 0x4d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x12, 0x43, 0x0a, 0x09,
+	0x53, 0x65, 0x74, 0x4f, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x12, 0x1c, 0x2e, 0x6d, 0x65, 0x73, 0x68,
+	0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x74, 0x4f, 0x62, 0x6a, 0x65, 0x63, 0x74,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61,
+	0x74, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x12, 0x49, 0x0a, 0x0c, 0x53, 0x65, 0x74, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72,
+	0x6d, 0x12, 0x1f, 0x2e, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x53,
+	0x65, 0x74, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x18, 0x2e, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e,
+	0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x47, 0x0a, 0x0b,
+	0x53, 0x65, 0x74, 0x50, 0x72, 0x6f, 0x70, 0x65, 0x72, 0x74, 0x79, 0x12, 0x1e, 0x2e, 0x6d, 0x65,
+	0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x74, 0x50, 0x72, 0x6f, 0x70,
+	0x65, 0x72, 0x74, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x6d, 0x65,
+	0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x3d, 0x0a, 0x06, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x12,
+	0x19, 0x2e, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x44, 0x65, 0x6c,
+	0x65, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x6d, 0x65, 0x73,
+	0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x52,
+	0x65, 0x70, 0x6c, 0x79, 0x12, 0x49, 0x0a, 0x0c, 0x53, 0x65, 0x74, 0x41, 0x6e, 0x69, 0x6d, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1f, 0x2e, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76,
+	0x31, 0x2e, 0x53, 0x65, 0x74, 0x41, 0x6e, 0x69, 0x6d, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e,
+	0x76, 0x31, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12,
+	0x4e, 0x0a, 0x0b, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x50, 0x6f, 0x73, 0x65, 0x73, 0x12, 0x1f,
+	0x2e, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x74, 0x54,
+	0x72, 0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x1c, 0x2e, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x72,
+	0x65, 0x61, 0x6d, 0x50, 0x6f, 0x73, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x28, 0x01, 0x12,
+	0x54, 0x0a, 0x11, 0x57, 0x61, 0x74, 0x63, 0x68, 0x56, 0x69, 0x65, 0x77, 0x65, 0x72, 0x45, 0x76,
+	0x65, 0x6e, 0x74, 0x73, 0x12, 0x24, 0x2e, 0x6d, 0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2e, 0x76,
+	0x31, 0x2e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x56, 0x69, 0x65, 0x77, 0x65, 0x72, 0x45, 0x76, 0x65,
+	0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x17, 0x2e, 0x6d, 0x65, 0x73,
+	0x68, 0x63, 0x61, 0x74, 0x2e, 0x76, 0x31, 0x2e, 0x56, 0x69, 0x65, 0x77, 0x65, 0x72, 0x45, 0x76,
+	0x65, 0x6e, 0x74, 0x30, 0x01, 0x42, 0x2d, 0x5a, 0x2b, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x66, 0x72, 0x69, 0x65, 0x6e, 0x64, 0x30, 0x2f, 0x67, 0x6f, 0x2d, 0x6d,
+	0x65, 0x73, 0x68, 0x63, 0x61, 0x74, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x6d, 0x65, 0x73, 0x68, 0x63,
+	0x61, 0x74, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_meshcat_proto_rawDescOnce sync.Once
+	file_meshcat_proto_rawDescData = file_meshcat_proto_rawDesc
+)
+
+func file_meshcat_proto_rawDescGZIP() []byte {
+	file_meshcat_proto_rawDescOnce.Do(func() {
+		file_meshcat_proto_rawDescData = protoimpl.X.CompressGZIP(file_meshcat_proto_rawDescData)
+	})
+	return file_meshcat_proto_rawDescData
+}
+
+var file_meshcat_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_meshcat_proto_goTypes = []interface{}{
+	(*CommandReply)(nil),             // 0: meshcat.v1.CommandReply
+	(*SetObjectRequest)(nil),         // 1: meshcat.v1.SetObjectRequest
+	(*SetTransformRequest)(nil),      // 2: meshcat.v1.SetTransformRequest
+	(*SetPropertyRequest)(nil),       // 3: meshcat.v1.SetPropertyRequest
+	(*DeleteRequest)(nil),            // 4: meshcat.v1.DeleteRequest
+	(*AnimationOptions)(nil),         // 5: meshcat.v1.AnimationOptions
+	(*SetAnimationRequest)(nil),      // 6: meshcat.v1.SetAnimationRequest
+	(*StreamPosesReply)(nil),         // 7: meshcat.v1.StreamPosesReply
+	(*WatchViewerEventsRequest)(nil), // 8: meshcat.v1.WatchViewerEventsRequest
+	(*ViewerEvent)(nil),              // 9: meshcat.v1.ViewerEvent
+	(*structpb.Struct)(nil),          // 10: google.protobuf.Struct
+	(*structpb.Value)(nil),           // 11: google.protobuf.Value
+	(*structpb.ListValue)(nil),       // 12: google.protobuf.ListValue
+	(*timestamppb.Timestamp)(nil),    // 13: google.protobuf.Timestamp
+}
+var file_meshcat_proto_depIdxs = []int32{
+	10, // 0: meshcat.v1.SetObjectRequest.geometry:type_name -> google.protobuf.Struct
+	11, // 1: meshcat.v1.SetPropertyRequest.value:type_name -> google.protobuf.Value
+	12, // 2: meshcat.v1.SetAnimationRequest.animations:type_name -> google.protobuf.ListValue
+	5,  // 3: meshcat.v1.SetAnimationRequest.options:type_name -> meshcat.v1.AnimationOptions
+	13, // 4: meshcat.v1.ViewerEvent.time:type_name -> google.protobuf.Timestamp
+	1,  // 5: meshcat.v1.Meshcat.SetObject:input_type -> meshcat.v1.SetObjectRequest
+	2,  // 6: meshcat.v1.Meshcat.SetTransform:input_type -> meshcat.v1.SetTransformRequest
+	3,  // 7: meshcat.v1.Meshcat.SetProperty:input_type -> meshcat.v1.SetPropertyRequest
+	4,  // 8: meshcat.v1.Meshcat.Delete:input_type -> meshcat.v1.DeleteRequest
+	6,  // 9: meshcat.v1.Meshcat.SetAnimation:input_type -> meshcat.v1.SetAnimationRequest
+	2,  // 10: meshcat.v1.Meshcat.StreamPoses:input_type -> meshcat.v1.SetTransformRequest
+	8,  // 11: meshcat.v1.Meshcat.WatchViewerEvents:input_type -> meshcat.v1.WatchViewerEventsRequest
+	0,  // 12: meshcat.v1.Meshcat.SetObject:output_type -> meshcat.v1.CommandReply
+	0,  // 13: meshcat.v1.Meshcat.SetTransform:output_type -> meshcat.v1.CommandReply
+	0,  // 14: meshcat.v1.Meshcat.SetProperty:output_type -> meshcat.v1.CommandReply
+	0,  // 15: meshcat.v1.Meshcat.Delete:output_type -> meshcat.v1.CommandReply
+	0,  // 16: meshcat.v1.Meshcat.SetAnimation:output_type -> meshcat.v1.CommandReply
+	7,  // 17: meshcat.v1.Meshcat.StreamPoses:output_type -> meshcat.v1.StreamPosesReply
+	9,  // 18: meshcat.v1.Meshcat.WatchViewerEvents:output_type -> meshcat.v1.ViewerEvent
+	12, // [12:19] is the sub-list for method output_type
+	5,  // [5:12] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_meshcat_proto_init() }
+func file_meshcat_proto_init() {
+	if File_meshcat_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_meshcat_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CommandReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_meshcat_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetObjectRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_meshcat_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetTransformRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_meshcat_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetPropertyRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_meshcat_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_meshcat_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AnimationOptions); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_meshcat_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetAnimationRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_meshcat_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamPosesReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_meshcat_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WatchViewerEventsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_meshcat_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ViewerEvent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_meshcat_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_meshcat_proto_goTypes,
+		DependencyIndexes: file_meshcat_proto_depIdxs,
+		MessageInfos:      file_meshcat_proto_msgTypes,
+	}.Build()
+	File_meshcat_proto = out.File
+	file_meshcat_proto_rawDesc = nil
+	file_meshcat_proto_goTypes = nil
+	file_meshcat_proto_depIdxs = nil
+}
@@ -0,0 +1,420 @@
+// The gRPC API of go-meshcat. It mirrors the NATS subjects and REST routes:
+// every call goes through the same command pipeline, so its changes are
+// persisted, recorded and pushed to the viewers like any other.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: meshcat.proto
+
+package meshcatpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Meshcat_SetObject_FullMethodName         = "/meshcat.v1.Meshcat/SetObject"
+	Meshcat_SetTransform_FullMethodName      = "/meshcat.v1.Meshcat/SetTransform"
+	Meshcat_SetProperty_FullMethodName       = "/meshcat.v1.Meshcat/SetProperty"
+	Meshcat_Delete_FullMethodName            = "/meshcat.v1.Meshcat/Delete"
+	Meshcat_SetAnimation_FullMethodName      = "/meshcat.v1.Meshcat/SetAnimation"
+	Meshcat_StreamPoses_FullMethodName       = "/meshcat.v1.Meshcat/StreamPoses"
+	Meshcat_WatchViewerEvents_FullMethodName = "/meshcat.v1.Meshcat/WatchViewerEvents"
+)
+
+// MeshcatClient is the client API for Meshcat service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MeshcatClient interface {
+	// SetObject adds or replaces a geometry, like PUT /api/objects/<path>.
+	SetObject(ctx context.Context, in *SetObjectRequest, opts ...grpc.CallOption) (*CommandReply, error)
+	// SetTransform sets an object's transform, like meshcat.transformations.<path>.
+	SetTransform(ctx context.Context, in *SetTransformRequest, opts ...grpc.CallOption) (*CommandReply, error)
+	// SetProperty sets a property of an object, like meshcat.properties.<path>.
+	SetProperty(ctx context.Context, in *SetPropertyRequest, opts ...grpc.CallOption) (*CommandReply, error)
+	// Delete removes an object and everything below it.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*CommandReply, error)
+	// SetAnimation plays animation clips in the viewers.
+	SetAnimation(ctx context.Context, in *SetAnimationRequest, opts ...grpc.CallOption) (*CommandReply, error)
+	// StreamPoses applies a stream of high-rate transforms. Invalid poses are
+	// counted and skipped rather than ending the stream.
+	StreamPoses(ctx context.Context, opts ...grpc.CallOption) (Meshcat_StreamPosesClient, error)
+	// WatchViewerEvents streams the commands sent to the viewers.
+	WatchViewerEvents(ctx context.Context, in *WatchViewerEventsRequest, opts ...grpc.CallOption) (Meshcat_WatchViewerEventsClient, error)
+}
+
+type meshcatClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMeshcatClient(cc grpc.ClientConnInterface) MeshcatClient {
+	return &meshcatClient{cc}
+}
+
+func (c *meshcatClient) SetObject(ctx context.Context, in *SetObjectRequest, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Meshcat_SetObject_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *meshcatClient) SetTransform(ctx context.Context, in *SetTransformRequest, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Meshcat_SetTransform_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *meshcatClient) SetProperty(ctx context.Context, in *SetPropertyRequest, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Meshcat_SetProperty_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *meshcatClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Meshcat_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *meshcatClient) SetAnimation(ctx context.Context, in *SetAnimationRequest, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, Meshcat_SetAnimation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *meshcatClient) StreamPoses(ctx context.Context, opts ...grpc.CallOption) (Meshcat_StreamPosesClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Meshcat_ServiceDesc.Streams[0], Meshcat_StreamPoses_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &meshcatStreamPosesClient{ClientStream: stream}
+	return x, nil
+}
+
+type Meshcat_StreamPosesClient interface {
+	Send(*SetTransformRequest) error
+	CloseAndRecv() (*StreamPosesReply, error)
+	grpc.ClientStream
+}
+
+type meshcatStreamPosesClient struct {
+	grpc.ClientStream
+}
+
+func (x *meshcatStreamPosesClient) Send(m *SetTransformRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *meshcatStreamPosesClient) CloseAndRecv() (*StreamPosesReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StreamPosesReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *meshcatClient) WatchViewerEvents(ctx context.Context, in *WatchViewerEventsRequest, opts ...grpc.CallOption) (Meshcat_WatchViewerEventsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Meshcat_ServiceDesc.Streams[1], Meshcat_WatchViewerEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &meshcatWatchViewerEventsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Meshcat_WatchViewerEventsClient interface {
+	Recv() (*ViewerEvent, error)
+	grpc.ClientStream
+}
+
+type meshcatWatchViewerEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *meshcatWatchViewerEventsClient) Recv() (*ViewerEvent, error) {
+	m := new(ViewerEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MeshcatServer is the server API for Meshcat service.
+// All implementations must embed UnimplementedMeshcatServer
+// for forward compatibility
+type MeshcatServer interface {
+	// SetObject adds or replaces a geometry, like PUT /api/objects/<path>.
+	SetObject(context.Context, *SetObjectRequest) (*CommandReply, error)
+	// SetTransform sets an object's transform, like meshcat.transformations.<path>.
+	SetTransform(context.Context, *SetTransformRequest) (*CommandReply, error)
+	// SetProperty sets a property of an object, like meshcat.properties.<path>.
+	SetProperty(context.Context, *SetPropertyRequest) (*CommandReply, error)
+	// Delete removes an object and everything below it.
+	Delete(context.Context, *DeleteRequest) (*CommandReply, error)
+	// SetAnimation plays animation clips in the viewers.
+	SetAnimation(context.Context, *SetAnimationRequest) (*CommandReply, error)
+	// StreamPoses applies a stream of high-rate transforms. Invalid poses are
+	// counted and skipped rather than ending the stream.
+	StreamPoses(Meshcat_StreamPosesServer) error
+	// WatchViewerEvents streams the commands sent to the viewers.
+	WatchViewerEvents(*WatchViewerEventsRequest, Meshcat_WatchViewerEventsServer) error
+	mustEmbedUnimplementedMeshcatServer()
+}
+
+// UnimplementedMeshcatServer must be embedded to have forward compatible implementations.
+type UnimplementedMeshcatServer struct {
+}
+
+func (UnimplementedMeshcatServer) SetObject(context.Context, *SetObjectRequest) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetObject not implemented")
+}
+func (UnimplementedMeshcatServer) SetTransform(context.Context, *SetTransformRequest) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetTransform not implemented")
+}
+func (UnimplementedMeshcatServer) SetProperty(context.Context, *SetPropertyRequest) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetProperty not implemented")
+}
+func (UnimplementedMeshcatServer) Delete(context.Context, *DeleteRequest) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedMeshcatServer) SetAnimation(context.Context, *SetAnimationRequest) (*CommandReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetAnimation not implemented")
+}
+func (UnimplementedMeshcatServer) StreamPoses(Meshcat_StreamPosesServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamPoses not implemented")
+}
+func (UnimplementedMeshcatServer) WatchViewerEvents(*WatchViewerEventsRequest, Meshcat_WatchViewerEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchViewerEvents not implemented")
+}
+func (UnimplementedMeshcatServer) mustEmbedUnimplementedMeshcatServer() {}
+
+// UnsafeMeshcatServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MeshcatServer will
+// result in compilation errors.
+type UnsafeMeshcatServer interface {
+	mustEmbedUnimplementedMeshcatServer()
+}
+
+func RegisterMeshcatServer(s grpc.ServiceRegistrar, srv MeshcatServer) {
+	s.RegisterService(&Meshcat_ServiceDesc, srv)
+}
+
+func _Meshcat_SetObject_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetObjectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MeshcatServer).SetObject(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Meshcat_SetObject_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MeshcatServer).SetObject(ctx, req.(*SetObjectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Meshcat_SetTransform_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetTransformRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MeshcatServer).SetTransform(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Meshcat_SetTransform_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MeshcatServer).SetTransform(ctx, req.(*SetTransformRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Meshcat_SetProperty_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetPropertyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MeshcatServer).SetProperty(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Meshcat_SetProperty_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MeshcatServer).SetProperty(ctx, req.(*SetPropertyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Meshcat_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MeshcatServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Meshcat_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MeshcatServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Meshcat_SetAnimation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetAnimationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MeshcatServer).SetAnimation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Meshcat_SetAnimation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MeshcatServer).SetAnimation(ctx, req.(*SetAnimationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Meshcat_StreamPoses_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MeshcatServer).StreamPoses(&meshcatStreamPosesServer{ServerStream: stream})
+}
+
+type Meshcat_StreamPosesServer interface {
+	SendAndClose(*StreamPosesReply) error
+	Recv() (*SetTransformRequest, error)
+	grpc.ServerStream
+}
+
+type meshcatStreamPosesServer struct {
+	grpc.ServerStream
+}
+
+func (x *meshcatStreamPosesServer) SendAndClose(m *StreamPosesReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *meshcatStreamPosesServer) Recv() (*SetTransformRequest, error) {
+	m := new(SetTransformRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Meshcat_WatchViewerEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchViewerEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MeshcatServer).WatchViewerEvents(m, &meshcatWatchViewerEventsServer{ServerStream: stream})
+}
+
+type Meshcat_WatchViewerEventsServer interface {
+	Send(*ViewerEvent) error
+	grpc.ServerStream
+}
+
+type meshcatWatchViewerEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *meshcatWatchViewerEventsServer) Send(m *ViewerEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Meshcat_ServiceDesc is the grpc.ServiceDesc for Meshcat service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Meshcat_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "meshcat.v1.Meshcat",
+	HandlerType: (*MeshcatServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetObject",
+			Handler:    _Meshcat_SetObject_Handler,
+		},
+		{
+			MethodName: "SetTransform",
+			Handler:    _Meshcat_SetTransform_Handler,
+		},
+		{
+			MethodName: "SetProperty",
+			Handler:    _Meshcat_SetProperty_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Meshcat_Delete_Handler,
+		},
+		{
+			MethodName: "SetAnimation",
+			Handler:    _Meshcat_SetAnimation_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamPoses",
+			Handler:       _Meshcat_StreamPoses_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchViewerEvents",
+			Handler:       _Meshcat_WatchViewerEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "meshcat.proto",
+}
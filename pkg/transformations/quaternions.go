@@ -108,24 +108,68 @@ func QuaternionToRotationMatrix(q []float64) (mat.Dense, error) {
 // The Euler angles are represented as an array of 3 float64 values: [roll, pitch, yaw].
 // The function uses the aerospace sequence of rotations: ZYX, applied in order from right to left.
 //
-// The quaternion is calculated using the formula:
-// q = [c1*c2*c3 + s1*s2*s3, s1*c2*c3 - c1*s2*s3, c1*s2*c3 + s1*c2*s3, c1*c2*s3 - s1*s2*c3]
+// The quaternion, [x, y, z, w] like everywhere else, is calculated using the formula:
+// q = [s1*c2*c3 - c1*s2*s3, c1*s2*c3 + s1*c2*s3, c1*c2*s3 - s1*s2*c3, c1*c2*c3 + s1*s2*s3]
 // where c1 = cos(roll/2), s1 = sin(roll/2), c2 = cos(pitch/2), s2 = sin(pitch/2), c3 = cos(yaw/2), s3 = sin(yaw/2)
 //
 // Example usage:
 //
 //	e := [3]float64{0, 0, math.Pi/2}
 //	q := eulerToQuaternion(e)
-//	fmt.Println(q) // Outputs: [0 0 1 0]
+//	fmt.Println(q) // Outputs: [0 0 0.7071 0.7071]
 func EulerToQuaternion(e [3]float64) (Quaternion, error) {
 	c1, s1 := math.Cos(e[0]/2), math.Sin(e[0]/2)
 	c2, s2 := math.Cos(e[1]/2), math.Sin(e[1]/2)
 	c3, s3 := math.Cos(e[2]/2), math.Sin(e[2]/2)
 
 	return Quaternion([]float64{
-		c1*c2*c3 + s1*s2*s3,
 		s1*c2*c3 - c1*s2*s3,
 		c1*s2*c3 + s1*c2*s3,
 		c1*c2*s3 - s1*s2*c3,
+		c1*c2*c3 + s1*s2*s3,
 	}), nil
 }
+
+// Normalize scales q to unit length. The zero quaternion is returned as is.
+func Normalize(q Quaternion) Quaternion {
+	norm := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3])
+	if norm == 0 {
+		return q
+	}
+	return Quaternion{q[0] / norm, q[1] / norm, q[2] / norm, q[3] / norm}
+}
+
+// Slerp interpolates along the shortest arc between the unit quaternions q0
+// and q1, giving q0 at t = 0 and q1 at t = 1.
+//
+// Example usage:
+//
+//	q0, _ := EulerToQuaternion([3]float64{0, 0, 0})
+//	q1, _ := EulerToQuaternion([3]float64{0, 0, math.Pi / 2})
+//	fmt.Println(Slerp(q0, q1, 0.5)) // Outputs the yaw of π/4: [0 0 0.3827 0.9239]
+func Slerp(q0, q1 Quaternion, t float64) Quaternion {
+	dot := q0[0]*q1[0] + q0[1]*q1[1] + q0[2]*q1[2] + q0[3]*q1[3]
+	end := Quaternion{q1[0], q1[1], q1[2], q1[3]}
+	// q and -q are the same rotation; take the shorter way round.
+	if dot < 0 {
+		for i := range end {
+			end[i] = -end[i]
+		}
+		dot = -dot
+	}
+	var s0, s1 float64
+	if dot > 0.9995 {
+		// Nearly parallel: linear interpolation is accurate and avoids dividing by sin(theta) ~ 0.
+		s0, s1 = 1-t, t
+	} else {
+		theta := math.Acos(dot)
+		s0 = math.Sin((1-t)*theta) / math.Sin(theta)
+		s1 = math.Sin(t*theta) / math.Sin(theta)
+	}
+	return Normalize(Quaternion{
+		s0*q0[0] + s1*end[0],
+		s0*q0[1] + s1*end[1],
+		s0*q0[2] + s1*end[2],
+		s0*q0[3] + s1*end[3],
+	})
+}
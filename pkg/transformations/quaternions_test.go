@@ -0,0 +1,87 @@
+package transformations
+
+import (
+	"math"
+	"testing"
+)
+
+func quaternionsEqual(a, b Quaternion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEulerToQuaternion(t *testing.T) {
+	h := math.Sqrt2 / 2
+	for _, tc := range []struct {
+		name  string
+		euler [3]float64
+		want  Quaternion
+	}{
+		{"identity", [3]float64{0, 0, 0}, Quaternion{0, 0, 0, 1}},
+		{"90° yaw", [3]float64{0, 0, math.Pi / 2}, Quaternion{0, 0, h, h}},
+		{"90° pitch", [3]float64{0, math.Pi / 2, 0}, Quaternion{0, h, 0, h}},
+		{"90° roll", [3]float64{math.Pi / 2, 0, 0}, Quaternion{h, 0, 0, h}},
+		{"180° yaw", [3]float64{0, 0, math.Pi}, Quaternion{0, 0, 1, 0}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := EulerToQuaternion(tc.euler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !quaternionsEqual(got, tc.want) {
+				t.Errorf("EulerToQuaternion(%v) = %v; want %v", tc.euler, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSlerp(t *testing.T) {
+	identity := Quaternion{0, 0, 0, 1}
+	yaw90 := Quaternion{0, 0, math.Sin(math.Pi / 4), math.Cos(math.Pi / 4)}
+	yaw45 := Quaternion{0, 0, math.Sin(math.Pi / 8), math.Cos(math.Pi / 8)}
+	for _, tc := range []struct {
+		name   string
+		q0, q1 Quaternion
+		t      float64
+		want   Quaternion
+	}{
+		{"start", identity, yaw90, 0, identity},
+		{"end", identity, yaw90, 1, yaw90},
+		{"midpoint", identity, yaw90, 0.5, yaw45},
+		// -yaw90 is the same rotation; the shorter arc still passes yaw45.
+		{"shortest arc", identity, Quaternion{0, 0, -yaw90[2], -yaw90[3]}, 0.5, yaw45},
+		{"nearly parallel", identity, identity, 0.5, identity},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Slerp(tc.q0, tc.q1, tc.t); !quaternionsEqual(got, tc.want) {
+				t.Errorf("Slerp(%v, %v, %v) = %v; want %v", tc.q0, tc.q1, tc.t, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		q    Quaternion
+		want Quaternion
+	}{
+		{"unit", Quaternion{0, 0, 0, 1}, Quaternion{0, 0, 0, 1}},
+		{"scaled", Quaternion{0, 0, 0, 2}, Quaternion{0, 0, 0, 1}},
+		{"mixed", Quaternion{1, 1, 1, 1}, Quaternion{0.5, 0.5, 0.5, 0.5}},
+		{"zero", Quaternion{0, 0, 0, 0}, Quaternion{0, 0, 0, 0}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Normalize(tc.q); !quaternionsEqual(got, tc.want) {
+				t.Errorf("Normalize(%v) = %v; want %v", tc.q, got, tc.want)
+			}
+		})
+	}
+}